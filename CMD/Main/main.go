@@ -2,14 +2,24 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	_ "github.com/Pyramakerz/Library_Management_System/docs"
 
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	circulation "github.com/Pyramakerz/Library_Management_System/PKG/Circulation"
 	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
 	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
 	routes "github.com/Pyramakerz/Library_Management_System/PKG/Routes"
+	search "github.com/Pyramakerz/Library_Management_System/PKG/Search"
+	sip2 "github.com/Pyramakerz/Library_Management_System/PKG/Sip2"
+	trash "github.com/Pyramakerz/Library_Management_System/PKG/Trash"
 	"github.com/gofiber/fiber/v2"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
+	"gorm.io/gorm"
 )
 
 // @title Library Management System
@@ -18,6 +28,16 @@ import (
 
 // @host localhost:9090
 // @BasePath /
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description The access token returned by /api/auth/login, as "Bearer <token>"
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description An API key issued with /api/apikey, for the integrations
 func main() {
 	// 1) Start the Db Connection and Auto Migrate the models to be tables
 	config.Connect()
@@ -27,11 +47,78 @@ func main() {
 		fmt.Printf("Failed to connect to the database.")
 	}
 
-	err := db.AutoMigrate(&models.Book{}, &models.Author{})
+	err := db.AutoMigrate(&models.Book{}, &models.Author{}, &models.Patron{}, &models.Loan{}, &models.Revision{}, &models.AuditLog{}, &models.User{}, &models.RefreshToken{}, &models.Role{}, &models.Permission{}, &models.APIKey{}, &models.LoginState{}, &models.RecoveryCode{}, &models.RateLimitBucket{}, &models.OutboxMessage{}, &models.EmailTemplate{})
 	if err != nil {
 		fmt.Printf("Failed to migrate models: %v", err)
 	}
 
+	// Books created before the updated_at column existed get the migration time as their datestamp
+	db.Unscoped().Model(&models.Book{}).Where("updated_at IS NULL").Update("updated_at", time.Now())
+
+	// Books and authors created before the created_at columns existed are dated from the migration, UpdateColumn keeps updated_at as it is
+	db.Unscoped().Model(&models.Book{}).Where("created_at IS NULL").UpdateColumn("created_at", gorm.Expr("updated_at"))
+	db.Unscoped().Model(&models.Author{}).Where("created_at IS NULL").UpdateColumns(map[string]any{"created_at": time.Now(), "updated_at": time.Now()})
+
+	// Books of the authors soft deleted before the cascade existed go to the trash with their author, at the same time so they are restored together
+	db.Exec("UPDATE books SET deleted_at = (SELECT authors.deleted_at FROM authors WHERE authors.id = books.author_id) " +
+		"WHERE books.deleted_at IS NULL AND books.author_id IN (SELECT id FROM authors WHERE deleted_at IS NOT NULL)")
+
+	// The permissions and the member, librarian and admin roles are created once, they are edited with /api/role
+	if err := auth.Seed(db); err != nil {
+		fmt.Printf("Failed to create the roles: %v\n", err)
+	}
+	var admin models.Role
+	db.Where("name = ?", auth.RoleAdmin).First(&admin)
+
+	// The users created before the roles existed could do everything, they are admins until they are given another role
+	var usersWithRole int64
+	db.Model(&models.User{}).Where("role_id IS NOT NULL").Count(&usersWithRole)
+	if usersWithRole == 0 && admin.ID != 0 {
+		db.Model(&models.User{}).Where("role_id IS NULL").Update("role_id", admin.ID)
+	}
+
+	// The first user is an admin created from ADMIN_USERNAME and ADMIN_PASSWORD, the other ones are created with /api/user
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if username, password := config.Getenv("ADMIN_USERNAME", ""), config.Getenv("ADMIN_PASSWORD", ""); users == 0 && username != "" && password != "" {
+		hash, err := auth.HashPassword(password)
+		if err == nil {
+			user := models.User{Username: username, PasswordHash: hash}
+			if admin.ID != 0 {
+				user.RoleID = &admin.ID
+			}
+			err = db.Create(&user).Error
+		}
+		if err != nil {
+			fmt.Printf("Failed to create the first user: %v\n", err)
+		}
+	} else if users == 0 {
+		fmt.Println("There is no user, set ADMIN_USERNAME and ADMIN_PASSWORD to create the first one")
+	}
+
+	// Keep the autocomplete index in sync with any change on books or authors
+	search.Watch(db)
+
+	// The soft-deleted books and authors are hard deleted once the retention (TRASH_RETENTION_DAYS) is over
+	trash.Schedule(db, time.Hour)
+
+	// The notifications written to the outbox by the handlers are sent with the NOTIFIER, failures are retried with a backoff
+	outbox.Schedule(db, notify.Default())
+
+	// The patrons are told by email when a loan is due soon (DUE_SOON_DAYS) and when it is overdue
+	circulation.ScheduleNotices(db, time.Hour)
+
+	// The patrons of the directory (LDAP_URL) are synced every LDAP_SYNC_INTERVAL_MINUTES
+	ldap.Schedule(db)
+
+	// The self-checkout kiosks talk SIP2 on their own TCP port next to the API
+	go func() {
+		address := config.Getenv("SIP2_ADDRESS", "localhost:6001")
+		if err := sip2.NewServer(db).ListenAndServe(address); err != nil {
+			fmt.Printf("SIP2 server stopped: %v\n", err)
+		}
+	}()
+
 	// 2) Set the routes
 	app := fiber.New()
 
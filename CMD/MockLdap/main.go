@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
+)
+
+// A local directory to try the LDAP login and the patron sync without OpenLDAP, with a service account and two members.
+// Run the API with the LDAP_ variables printed on startup and log in as jdoe or asmith with the password "secret".
+func main() {
+	address := config.Getenv("MOCK_LDAP_ADDRESS", "localhost:3389")
+	base := "dc=example,dc=com"
+
+	member := func(uid, name, barcode string) ldap.MockEntry {
+		return ldap.MockEntry{
+			DN: "uid=" + uid + ",ou=people," + base,
+			Attributes: map[string][]string{
+				"objectClass":    {"inetOrPerson"},
+				"uid":            {uid},
+				"cn":             {name},
+				"mail":           {uid + "@example.com"},
+				"employeeNumber": {barcode},
+			},
+			Password: "secret",
+		}
+	}
+	server := ldap.NewMockServer(
+		ldap.MockEntry{DN: "cn=library," + base, Attributes: map[string][]string{"cn": {"library"}}, Password: "library"},
+		member("jdoe", "John Doe", "L1001"),
+		member("asmith", "Alice Smith", "L1002"),
+	)
+
+	fmt.Printf("Mock LDAP server on %s\n", address)
+	fmt.Printf("LDAP_URL=ldap://%s LDAP_BASE_DN=%s LDAP_BIND_DN=cn=library,%s LDAP_BIND_PASSWORD=library\n", address, base, base)
+	if err := server.ListenAndServe(address); err != nil {
+		fmt.Printf("Mock LDAP server stopped: %v\n", err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	oidc "github.com/Pyramakerz/Library_Management_System/PKG/Oidc"
+)
+
+// A local OpenID provider to try the single sign-on without a real identity provider, every login is the user of the
+// MOCK_OIDC_ environment variables. Run the API with the OIDC_ variables printed on startup.
+func main() {
+	address := config.Getenv("MOCK_OIDC_ADDRESS", "localhost:9998")
+	issuer := "http://" + address
+	clientID := config.Getenv("MOCK_OIDC_CLIENT_ID", "library")
+
+	username := config.Getenv("MOCK_OIDC_USERNAME", "librarian")
+	user := oidc.MockUser{
+		Subject:  config.Getenv("MOCK_OIDC_SUBJECT", username),
+		Username: username,
+		Email:    config.Getenv("MOCK_OIDC_EMAIL", username+"@example.com"),
+		Groups:   strings.Split(config.Getenv("MOCK_OIDC_GROUPS", "lms-staff"), ","),
+	}
+
+	provider, err := oidc.NewMockProvider(issuer, clientID, user)
+	if err != nil {
+		fmt.Printf("Failed to create the mock provider: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Mock OpenID provider logging in %s (groups %v)\n", user.Username, user.Groups)
+	fmt.Printf("OIDC_ISSUER=%s OIDC_CLIENT_ID=%s OIDC_ROLE_MAPPING=lms-staff=librarian\n", issuer, clientID)
+	if err := http.ListenAndServe(address, provider); err != nil {
+		fmt.Printf("Mock OpenID provider stopped: %v\n", err)
+	}
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entry is a mutating call to log, Before and After are marshalled to JSON (nil is null)
+type Entry struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   uint
+	Before     any
+	After      any
+	RequestID  string
+	IP         string
+}
+
+// Record appends a log to the chain, tx should be the transaction of the change so that both are saved or none.
+// The last log is locked until tx ends so that two logs never get the same previous hash.
+func Record(tx *gorm.DB, entry Entry) (models.AuditLog, error) {
+	before, err := marshal(entry.Before)
+	if err != nil {
+		return models.AuditLog{}, err
+	}
+	after, err := marshal(entry.After)
+	if err != nil {
+		return models.AuditLog{}, err
+	}
+
+	var last models.AuditLog
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id DESC").First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.AuditLog{}, err
+	}
+
+	log := models.AuditLog{
+		Actor:      entry.Actor,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     before,
+		After:      after,
+		RequestID:  entry.RequestID,
+		IP:         entry.IP,
+		// Seconds in UTC so that the time read back from the database hashes the same
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		PrevHash:  last.Hash,
+	}
+	log.Hash = Hash(log)
+
+	return log, tx.Create(&log).Error
+}
+
+func marshal(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// Hash returns the SHA-256 of the fields of a log and the hash of the previous one, the ID is not part of it as it is set by the database.
+func Hash(log models.AuditLog) string {
+	h := sha256.New()
+	for _, field := range []string{
+		log.PrevHash,
+		log.CreatedAt.UTC().Format(time.RFC3339),
+		log.Actor,
+		log.Action,
+		log.EntityType,
+		strconv.FormatUint(uint64(log.EntityID), 10),
+		string(log.Before),
+		string(log.After),
+		log.RequestID,
+		log.IP,
+	} {
+		// Length prefixes keep "ab"+"c" and "a"+"bc" apart
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Verification is the result of walking the chain, BrokenAt is the first log whose hash or previous hash doesn't match
+type Verification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt uint   `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify recomputes the hash of every log in the order of their IDs, a log that was changed breaks its own hash and a removed one breaks the link of the next.
+func Verify(tx *gorm.DB) (Verification, error) {
+	result := Verification{Valid: true}
+	prev := ""
+
+	var batch []models.AuditLog
+	err := tx.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, log := range batch {
+			result.Checked++
+			if log.PrevHash != prev {
+				result.Valid, result.BrokenAt, result.Reason = false, log.ID, "previous hash doesn't match, a log before it was removed or changed"
+			} else if Hash(log) != log.Hash {
+				result.Valid, result.BrokenAt, result.Reason = false, log.ID, "hash doesn't match, the log was changed"
+			}
+			if !result.Valid {
+				return errStop
+			}
+			prev = log.Hash
+		}
+		return nil
+	}).Error
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+	return result, err
+}
+
+var errStop = errors.New("stop")
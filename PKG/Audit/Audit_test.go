@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleLog() models.AuditLog {
+	return models.AuditLog{
+		Actor:      "librarian",
+		Action:     "update",
+		EntityType: "author",
+		EntityID:   1,
+		Before:     json.RawMessage(`{"name":"John Doe"}`),
+		After:      json.RawMessage(`{"name":"Jane Doe"}`),
+		RequestID:  "3f8e7c1a",
+		IP:         "127.0.0.1",
+		CreatedAt:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestHash(t *testing.T) {
+	log := sampleLog()
+	hash := Hash(log)
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, Hash(log))
+
+	// The same instant in another zone, as read back from the database
+	log.CreatedAt = log.CreatedAt.In(time.FixedZone("EET", 2*60*60))
+	assert.Equal(t, hash, Hash(log))
+}
+
+func TestHashChangesWithEveryField(t *testing.T) {
+	hash := Hash(sampleLog())
+
+	changes := []func(*models.AuditLog){
+		func(l *models.AuditLog) { l.PrevHash = "00" },
+		func(l *models.AuditLog) { l.Actor = "mallory" },
+		func(l *models.AuditLog) { l.EntityID = 2 },
+		func(l *models.AuditLog) { l.After = json.RawMessage(`{"name":"John Doe"}`) },
+		func(l *models.AuditLog) { l.CreatedAt = l.CreatedAt.Add(time.Second) },
+		// Moving characters between two fields changes the hash too
+		func(l *models.AuditLog) { l.Actor, l.Action = "librarianu", "pdate" },
+	}
+	for _, change := range changes {
+		log := sampleLog()
+		change(&log)
+		assert.NotEqual(t, hash, Hash(log))
+	}
+}
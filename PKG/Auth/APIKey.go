@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrUnknownScope  = errors.New("unknown scope")
+)
+
+// APIKeyHeader carries the API key of the integrations, the users send their access token in the Authorization header instead
+const APIKeyHeader = "X-API-Key"
+
+// Scopes of the API keys
+const (
+	ScopeCatalogRead = "catalog:read" // the catalog for the discovery layers
+	ScopeCirculation = "circulation"  // the patrons and their loans for the kiosks
+	ScopeAdmin       = "admin"        // every permission
+)
+
+// ScopePermissions are the permissions given by each scope
+var ScopePermissions = map[string][]string{
+	ScopeCatalogRead: {PermCatalogRead},
+	ScopeCirculation: {PermPatronsRead, PermPatronsWrite},
+	ScopeAdmin:       AllPermissions,
+}
+
+// apiKeyPrefix starts every key so that a leaked key is easy to find in logs and repositories
+const apiKeyPrefix = "lms_"
+
+// lastUsedPrecision is how often the last use of a key is written, not on every request
+const lastUsedPrecision = time.Minute
+
+// Key of the API key in the locals of a request
+const apiKeyLocalsKey = "apikey"
+
+// IssueAPIKey creates a key with some scopes, the returned raw key is the only time it is known.
+func IssueAPIKey(tx *gorm.DB, name string, scopes []string, expiresAt time.Time, createdBy *uint) (models.APIKey, string, error) {
+	for _, scope := range scopes {
+		if _, ok := ScopePermissions[scope]; !ok {
+			return models.APIKey{}, "", ErrUnknownScope
+		}
+	}
+
+	raw := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(randomBytes(32))
+	key := models.APIKey{
+		Name:      name,
+		Prefix:    raw[:len(apiKeyPrefix)+8],
+		KeyHash:   hashToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+	}
+	if err := tx.Create(&key).Error; err != nil {
+		return models.APIKey{}, "", err
+	}
+	return key, raw, nil
+}
+
+// CheckAPIKey returns the key of a raw key and records its use, ErrInvalidAPIKey when it is unknown, revoked or expired.
+func CheckAPIKey(tx *gorm.DB, raw string, now time.Time) (models.APIKey, error) {
+	var key models.APIKey
+	err := tx.Where("key_hash = ?", hashToken(raw)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return key, ErrInvalidAPIKey
+	} else if err != nil {
+		return key, err
+	}
+
+	if key.RevokedAt != nil || !now.Before(key.ExpiresAt) {
+		return key, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedPrecision {
+		if err := tx.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// APIKey returns the API key of the request, ok is false when it was made by a user or without a valid key.
+func APIKey(c *fiber.Ctx) (models.APIKey, bool) {
+	key, ok := c.Locals(apiKeyLocalsKey).(models.APIKey)
+	return key, ok
+}
+
+// KeyPermissions returns the names of the permissions given by the scopes of a key.
+func KeyPermissions(key models.APIKey) map[string]bool {
+	permissions := map[string]bool{}
+	for _, scope := range strings.Fields(key.Scopes) {
+		for _, permission := range ScopePermissions[scope] {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
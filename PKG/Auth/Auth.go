@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session is revoked")
+)
+
+var (
+	secret     []byte
+	secretOnce sync.Once
+)
+
+// Secret is the key signing the access tokens, set with JWT_SECRET.
+// Without it a random key is used, the tokens are then lost when the server restarts.
+func Secret() []byte {
+	secretOnce.Do(func() {
+		if s := config.Getenv("JWT_SECRET", ""); s != "" {
+			secret = []byte(s)
+			return
+		}
+		secret = randomBytes(32)
+		fmt.Println("JWT_SECRET is not set, the tokens are signed with a random key")
+	})
+	return secret
+}
+
+// AccessTTL is how long an access token is valid, set in minutes with JWT_ACCESS_TTL_MINUTES.
+func AccessTTL() time.Duration {
+	minutes, err := strconv.Atoi(config.Getenv("JWT_ACCESS_TTL_MINUTES", "15"))
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RefreshTTL is how long a refresh token is valid, set in days with JWT_REFRESH_TTL_DAYS.
+func RefreshTTL() time.Duration {
+	days, err := strconv.Atoi(config.Getenv("JWT_REFRESH_TTL_DAYS", "7"))
+	if err != nil || days <= 0 {
+		days = 7
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// HashPassword returns the bcrypt hash of a password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// dummyHash is compared when the user doesn't exist so that a login takes the same time for any username
+var dummyHash, _ = HashPassword("dummy password")
+
+// Authenticate returns the user of a username and password, ErrInvalidCredentials when they don't match or the user is disabled.
+func Authenticate(tx *gorm.DB, username, password string) (models.User, error) {
+	var user models.User
+	err := tx.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		return user, ErrInvalidCredentials
+	} else if err != nil {
+		return user, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil || user.Disabled {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Tokens are returned by a login or a refresh
+type Tokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"` // seconds
+}
+
+// Issue returns a new access token and a refresh token starting a new family.
+func Issue(tx *gorm.DB, user models.User, now time.Time) (Tokens, error) {
+	return issue(tx, user, randomID(), now)
+}
+
+func issue(tx *gorm.DB, user models.User, family string, now time.Time) (Tokens, error) {
+	access, err := Sign(Claims{
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		Username:  user.Username,
+		ID:        randomID(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTTL()).Unix(),
+	}, Secret())
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	refresh := base64.RawURLEncoding.EncodeToString(randomBytes(32))
+	err = tx.Create(&models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refresh),
+		Family:    family,
+		ExpiresAt: now.Add(RefreshTTL()),
+	}).Error
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{AccessToken: access, RefreshToken: refresh, TokenType: "Bearer", ExpiresIn: int(AccessTTL().Seconds())}, nil
+}
+
+// Refresh rotates a refresh token, it is revoked and the next one of its family is returned with a new access token.
+// A revoked token used again means it was stolen so its whole family is revoked (ErrRefreshTokenReused).
+func Refresh(tx *gorm.DB, raw string, now time.Time) (Tokens, error) {
+	var tokens Tokens
+	reused := false
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").Where("token_hash = ?", hashToken(raw)).First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		} else if err != nil {
+			return err
+		}
+
+		if token.RevokedAt != nil {
+			reused = true
+			return nil
+		}
+		if !now.Before(token.ExpiresAt) || token.User.Disabled {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&token).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		tokens, err = issue(tx, token.User, token.Family, now)
+		return err
+	})
+	if err != nil {
+		return tokens, err
+	}
+
+	if reused {
+		// Outside of the transaction above so that the revocation is kept
+		if err := RevokeFamily(tx, raw, now); err != nil {
+			return tokens, err
+		}
+		return tokens, ErrRefreshTokenReused
+	}
+	return tokens, nil
+}
+
+// RevokeFamily revokes a refresh token and every token rotated from the same login (logout).
+func RevokeFamily(tx *gorm.DB, raw string, now time.Time) error {
+	var token models.RefreshToken
+	if err := tx.Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).Where("family = ? AND revoked_at IS NULL", token.Family).Update("revoked_at", now).Error
+}
+
+// RevokeUser revokes all the refresh tokens of a user (logout everywhere, disabled user or new password).
+func RevokeUser(tx *gorm.DB, userID uint, now time.Time) error {
+	return tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+}
+
+// randomBytes panics as crypto/rand never fails on the supported systems
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// randomID returns 32 hex characters (token IDs and families)
+func randomID() string {
+	return hex.EncodeToString(randomBytes(16))
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = []byte("secret")
+
+func sampleClaims(now time.Time) Claims {
+	return Claims{Subject: "1", Username: "librarian", ID: "abc", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+}
+
+func TestSignAndParse(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	token, err := Sign(sampleClaims(now), testSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(strings.Split(token, ".")))
+
+	claims, err := Parse(token, testSecret, now)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleClaims(now), claims)
+
+	_, err = Parse(token, testSecret, now.Add(time.Minute))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	token, _ := Sign(sampleClaims(now), testSecret)
+	parts := strings.Split(token, ".")
+
+	_, err := Parse(token, []byte("other secret"), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Another user in the payload with the old signature
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"2","name":"admin","exp":1800000000}`))
+	_, err = Parse(parts[0]+"."+forged+"."+parts[2], testSecret, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// The algorithm is never taken from the token
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = Parse(none+"."+parts[1]+".", testSecret, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = Parse("not a token", testSecret, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Key of the claims in the locals of an authenticated request
+const localsKey = "auth"
+
+// Identify keeps the claims of a valid access token or the valid API key of any request, even on the public routes, for the
+// middlewares going before Middleware (the rate limit). A request without them is let through as it is.
+func Identify() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if raw := c.Get(APIKeyHeader); raw != "" {
+			if key, err := CheckAPIKey(config.GetDB(), raw, time.Now()); err == nil {
+				c.Locals(apiKeyLocalsKey, key)
+			}
+		} else if token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok && token != "" {
+			if claims, err := Parse(token, Secret(), time.Now()); err == nil {
+				c.Locals(localsKey, claims)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// Middleware rejects the requests without a valid access token in the Authorization header or API key in the X-API-Key header (401)
+// and keeps the claims or the key for the handlers.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Already checked by Identify
+		if _, ok := APIKey(c); ok {
+			return c.Next()
+		}
+		if _, ok := User(c); ok {
+			return c.Next()
+		}
+
+		if raw := c.Get(APIKeyHeader); raw != "" {
+			key, err := CheckAPIKey(config.GetDB(), raw, time.Now())
+			if errors.Is(err, ErrInvalidAPIKey) {
+				return unauthorized(c, "Invalid API key")
+			} else if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   true,
+					"message": "Failed to check API key",
+				})
+			}
+			c.Locals(apiKeyLocalsKey, key)
+			return c.Next()
+		}
+
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return unauthorized(c, "Missing access token")
+		}
+
+		claims, err := Parse(token, Secret(), time.Now())
+		if errors.Is(err, ErrExpiredToken) {
+			return unauthorized(c, "Access token is expired")
+		} else if err != nil {
+			return unauthorized(c, "Invalid access token")
+		}
+
+		c.Locals(localsKey, claims)
+		return c.Next()
+	}
+}
+
+// User returns the claims of the access token of the request, ok is false when no valid token was sent or an API key was sent.
+func User(c *fiber.Ctx) (Claims, bool) {
+	claims, ok := c.Locals(localsKey).(Claims)
+	return claims, ok
+}
+
+func unauthorized(c *fiber.Ctx, message string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="api"`)
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Permissions checked by the routes
+const (
+	PermCatalogRead   = "catalog:read"   // books, authors, search, citations and exports
+	PermCatalogWrite  = "catalog:write"  // create, update, import, soft delete, restore and revert books and authors, read their history and the trash
+	PermCatalogDelete = "catalog:delete" // hard delete books and authors
+	PermPatronsRead   = "patrons:read"   // patrons and all their loans
+	PermPatronsWrite  = "patrons:write"
+	PermOwnLoansRead  = "loans:read:own" // the loans of the patron linked to the user
+	PermAuditRead     = "audit:read"
+	PermUsersManage   = "users:manage" // users, roles, API keys, the email templates and the notification outbox
+)
+
+// AllPermissions are created on startup
+var AllPermissions = []string{
+	PermCatalogRead, PermCatalogWrite, PermCatalogDelete,
+	PermPatronsRead, PermPatronsWrite, PermOwnLoansRead,
+	PermAuditRead, PermUsersManage,
+}
+
+// Roles created on startup
+const (
+	RoleMember    = "member"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
+
+// DefaultRoles are the permissions of the roles when they are created, they can be changed with /api/role afterwards
+var DefaultRoles = map[string][]string{
+	RoleMember:    {PermCatalogRead, PermOwnLoansRead},
+	RoleLibrarian: {PermCatalogRead, PermCatalogWrite, PermPatronsRead, PermPatronsWrite},
+	RoleAdmin:     AllPermissions,
+}
+
+// Key of the permissions of the user in the locals of a request
+const permissionsKey = "permissions"
+
+// Seed creates the missing permissions and default roles, an existing role keeps the permissions it was given.
+func Seed(tx *gorm.DB) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		for _, name := range AllPermissions {
+			if err := tx.Where(models.Permission{Name: name}).FirstOrCreate(&models.Permission{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for name, permissions := range DefaultRoles {
+			var role models.Role
+			err := tx.Where("name = ?", name).First(&role).Error
+			if err == nil {
+				continue
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			role.Name = name
+			if err := tx.Where("name IN ?", permissions).Find(&role.Permissions).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Permissions returns the names of the permissions of a user, none when they have no role.
+func Permissions(user models.User) map[string]bool {
+	permissions := map[string]bool{}
+	if user.Role != nil {
+		for _, permission := range user.Role.Permissions {
+			permissions[permission.Name] = true
+		}
+	}
+	return permissions
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Require lets through the users and API keys having every one of the permissions, the others get 403.
+// It goes after Middleware, the permissions are read from the database so a change of role applies to the next request.
+func Require(permissions ...string) fiber.Handler {
+	return authorize(permissions, " and ", func(granted map[string]bool) bool {
+		for _, permission := range permissions {
+			if !granted[permission] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireAny lets through the users having at least one of the permissions, the handler checks which one with Can.
+func RequireAny(permissions ...string) fiber.Handler {
+	return authorize(permissions, " or ", func(granted map[string]bool) bool {
+		for _, permission := range permissions {
+			if granted[permission] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Can tells if the user of the request has a permission, it is only known on the routes behind Require or RequireAny.
+func Can(c *fiber.Ctx, permission string) bool {
+	granted, _ := c.Locals(permissionsKey).(map[string]bool)
+	return granted[permission]
+}
+
+func authorize(permissions []string, separator string, allowed func(map[string]bool) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var granted map[string]bool
+		if key, ok := APIKey(c); ok {
+			granted = KeyPermissions(key)
+		} else {
+			claims, ok := User(c)
+			if !ok {
+				return unauthorized(c, "Missing access token")
+			}
+
+			var user models.User
+			if err := config.GetDB().Preload("Role.Permissions").First(&user, claims.Subject).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return unauthorized(c, "User not found")
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":   true,
+					"message": "Failed to get user",
+				})
+			}
+			// The access token of a disabled user is valid until it expires, it is refused here
+			if user.Disabled {
+				return unauthorized(c, "User is disabled")
+			}
+			// The user can still enroll, the /api/auth routes don't require any permission
+			if TwoFactorRequired(user) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":             true,
+					"message":           "Your role requires two-factor authentication, enroll with /api/auth/2fa/enroll",
+					"twoFactorRequired": true,
+				})
+			}
+			granted = Permissions(user)
+		}
+
+		if !allowed(granted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   true,
+				"message": "Missing permission " + strings.Join(permissions, separator),
+			})
+		}
+
+		c.Locals(permissionsKey, granted)
+		return c.Next()
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTwoFactorRequired    = errors.New("two-factor code is required")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// The codes of the authenticator apps (RFC 6238 with the defaults of Google Authenticator)
+const (
+	totpDigits = 6
+	totpPeriod = 30 // seconds
+	totpSkew   = 1  // steps accepted before and after the current one, for the clock of the phone
+)
+
+// Number of recovery codes generated at once
+const recoveryCodeCount = 10
+
+// DirectoryPrefix starts the external ID of the users of the directory (LDAP), they log in with a password like the local users
+const DirectoryPrefix = "ldap|"
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTotpSecret returns a random secret of 160 bits in base32, the encoding of the authenticator apps.
+func NewTotpSecret() string {
+	return base32NoPadding.EncodeToString(randomBytes(20))
+}
+
+// ProvisioningURI is the otpauth:// URI of a secret, shown as a QR code to add the account to an authenticator app.
+// The issuer is TOTP_ISSUER.
+func ProvisioningURI(secret, username string) string {
+	issuer := config.Getenv("TOTP_ISSUER", "Library Management System")
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// QRCode returns a provisioning URI as a PNG QR code in a data: URI, it is the src of an <img> for the authenticator app to scan.
+func QRCode(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// TotpCode returns the code of a secret at a time step (RFC 4226 and 6238).
+func TotpCode(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000), nil
+}
+
+// TotpStep returns the time step of a time.
+func TotpStep(now time.Time) int64 {
+	return now.Unix() / totpPeriod
+}
+
+// CheckTotp returns the step of a code valid at now, ok is false for a wrong code or a code of a step up to lastStep (already used).
+func CheckTotp(secret, code string, now time.Time, lastStep int64) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := TotpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TotpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 && step > lastStep {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// TwoFactorRequired tells if the role of a user requires two-factor authentication and they haven't enrolled yet.
+func TwoFactorRequired(user models.User) bool {
+	return user.Role != nil && user.Role.RequireTwoFactor && !user.TotpEnabled && !SingleSignOn(user)
+}
+
+// SingleSignOn tells if a user logs in through single sign-on (OIDC), their identity provider asks for their second factor
+// so they don't enroll here.
+func SingleSignOn(user models.User) bool {
+	return user.ExternalID != nil && !strings.HasPrefix(*user.ExternalID, DirectoryPrefix)
+}
+
+// VerifyTwoFactor checks the second factor of a login, a code of the authenticator app or a recovery code (which can't be used again).
+// It returns ErrTwoFactorRequired when code is empty and ErrInvalidTwoFactorCode when it is wrong, nothing is checked for a user who
+// hasn't enrolled.
+func VerifyTwoFactor(tx *gorm.DB, user models.User, code string, now time.Time) error {
+	if !user.TotpEnabled {
+		return nil
+	}
+	if strings.TrimSpace(code) == "" {
+		return ErrTwoFactorRequired
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		// The last step is read again under a lock, two logins can't use the same code at once
+		var current models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "totp_secret", "totp_last_step").First(&current, user.ID).Error; err != nil {
+			return err
+		}
+		if step, ok := CheckTotp(current.TotpSecret, code, now, current.TotpLastStep); ok {
+			return tx.Model(&current).Update("totp_last_step", step).Error
+		}
+
+		result := tx.Model(&models.RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	})
+}
+
+// NewRecoveryCodes replaces the recovery codes of a user and returns the new ones, like "k7pq2-mx9ad".
+func NewRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for i := range codes {
+			raw := strings.ToLower(base32NoPadding.EncodeToString(randomBytes(7)))[:10]
+			codes[i] = raw[:5] + "-" + raw[5:]
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(codes[i])}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return codes, err
+}
+
+// hashRecoveryCode ignores the case, the spaces and the dash of the code
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotpCode(t *testing.T) {
+	// The SHA-1 test vectors of RFC 6238, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		got, err := TotpCode(secret, TotpStep(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, code, got, unix)
+	}
+}
+
+func TestCheckTotp(t *testing.T) {
+	secret := NewTotpSecret()
+	now := time.Unix(1_700_000_000, 0)
+	current := TotpStep(now)
+
+	previous, _ := TotpCode(secret, current-1)
+	step, ok := CheckTotp(secret, previous, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, current-1, step)
+
+	// Already used, or too old
+	_, ok = CheckTotp(secret, previous, now, current-1)
+	assert.False(t, ok)
+	old, _ := TotpCode(secret, current-2)
+	_, ok = CheckTotp(secret, old, now, 0)
+	assert.False(t, ok)
+
+	_, ok = CheckTotp(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	t.Setenv("TOTP_ISSUER", "City Library")
+	uri, err := url.Parse(ProvisioningURI("JBSWY3DPEHPK3PXP", "jane doe"))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/City Library:jane doe", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "City Library", uri.Query().Get("issuer"))
+}
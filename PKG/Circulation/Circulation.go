@@ -0,0 +1,165 @@
+package circulation
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPatronBlocked     = errors.New("patron is blocked")
+	ErrPatronExpired     = errors.New("patron card is expired")
+	ErrAlreadyCheckedOut = errors.New("item is already checked out")
+	ErrNotCheckedOut     = errors.New("item is not checked out")
+	ErrNotBorrower       = errors.New("item is checked out to another patron")
+	ErrRenewalLimit      = errors.New("renewal limit reached")
+)
+
+// LoanPeriod is the number of days a book is lent for (and added by a renewal), set with LOAN_PERIOD_DAYS.
+func LoanPeriod() time.Duration {
+	days, err := strconv.Atoi(config.Getenv("LOAN_PERIOD_DAYS", "14"))
+	if err != nil || days <= 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// MaxRenewals is the number of times a loan can be renewed, set with LOAN_MAX_RENEWALS.
+func MaxRenewals() int {
+	renewals, err := strconv.Atoi(config.Getenv("LOAN_MAX_RENEWALS", "2"))
+	if err != nil || renewals < 0 {
+		renewals = 2
+	}
+	return renewals
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// HashPin returns the bcrypt hash of a patron PIN.
+func HashPin(pin string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPin reports if pin is the PIN of the patron, a patron without a PIN is always refused.
+func CheckPin(patron models.Patron, pin string) bool {
+	if patron.PinHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(patron.PinHash), []byte(pin)) == nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Expired reports if the card of a patron is expired at now, a patron without an expiry date never expires.
+func Expired(patron models.Patron, now time.Time) bool {
+	return patron.ExpiresAt != nil && !now.Before(*patron.ExpiresAt)
+}
+
+// ActiveLoan returns the loan of a book that isn't returned yet, gorm.ErrRecordNotFound when the book is available.
+func ActiveLoan(tx *gorm.DB, bookID uint) (models.Loan, error) {
+	var loan models.Loan
+	err := tx.Preload("Patron").Where("book_id = ? AND returned_at IS NULL", bookID).First(&loan).Error
+	return loan, err
+}
+
+// Checkout lends a book to a patron until now + LoanPeriod().
+func Checkout(tx *gorm.DB, patron models.Patron, book models.Book, now time.Time) (models.Loan, error) {
+	if patron.Blocked {
+		return models.Loan{}, ErrPatronBlocked
+	}
+	if Expired(patron, now) {
+		return models.Loan{}, ErrPatronExpired
+	}
+
+	var loan models.Loan
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := lockBook(tx, book.ID); err != nil {
+			return err
+		}
+		if _, err := ActiveLoan(tx, book.ID); err == nil {
+			return ErrAlreadyCheckedOut
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		loan = models.Loan{BookID: book.ID, PatronID: patron.ID, CheckedOutAt: now, DueAt: now.Add(LoanPeriod())}
+		return tx.Create(&loan).Error
+	})
+	return loan, err
+}
+
+// Checkin returns a book, the returned loan has the patron who borrowed it.
+func Checkin(tx *gorm.DB, book models.Book, now time.Time) (models.Loan, error) {
+	var loan models.Loan
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := lockBook(tx, book.ID); err != nil {
+			return err
+		}
+
+		var err error
+		loan, err = ActiveLoan(tx, book.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotCheckedOut
+		} else if err != nil {
+			return err
+		}
+
+		loan.ReturnedAt = &now
+		return tx.Model(&loan).Update("returned_at", now).Error
+	})
+	return loan, err
+}
+
+// Renew extends the loan of a book by LoanPeriod() from now, only the patron who borrowed the book can renew it.
+func Renew(tx *gorm.DB, patron models.Patron, book models.Book, now time.Time) (models.Loan, error) {
+	if patron.Blocked {
+		return models.Loan{}, ErrPatronBlocked
+	}
+	if Expired(patron, now) {
+		return models.Loan{}, ErrPatronExpired
+	}
+
+	var loan models.Loan
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := lockBook(tx, book.ID); err != nil {
+			return err
+		}
+
+		var err error
+		loan, err = ActiveLoan(tx, book.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotCheckedOut
+		} else if err != nil {
+			return err
+		}
+
+		if loan.PatronID != patron.ID {
+			return ErrNotBorrower
+		}
+		if loan.Renewals >= MaxRenewals() {
+			return ErrRenewalLimit
+		}
+
+		// The notices are sent again for the new due date
+		loan.DueAt = now.Add(LoanPeriod())
+		loan.Renewals++
+		loan.DueSoonNoticeAt, loan.OverdueNoticeAt = nil, nil
+		return tx.Model(&loan).Updates(map[string]any{
+			"due_at": loan.DueAt, "renewals": loan.Renewals, "due_soon_notice_at": nil, "overdue_notice_at": nil,
+		}).Error
+	})
+	return loan, err
+}
+
+// lockBook locks the row of a book until the end of the transaction, the loans of a copy are then changed
+// by one kiosk at a time and two checkouts at the same time can't both find it available.
+func lockBook(tx *gorm.DB, bookID uint) error {
+	return tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Book{}, bookID).Error
+}
@@ -0,0 +1,117 @@
+package circulation
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
+	"gorm.io/gorm"
+)
+
+// DueSoon is how long before the due date the due soon notice is sent, set in days with DUE_SOON_DAYS (0 sends none).
+func DueSoon() time.Duration {
+	days, err := strconv.Atoi(config.Getenv("DUE_SOON_DAYS", "2"))
+	if err != nil || days < 0 {
+		days = 2
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Notices counts the notices written by SendNotices
+type Notices struct {
+	DueSoon int `json:"dueSoon"`
+	Overdue int `json:"overdue"`
+}
+
+// SendNotices writes to the outbox the due soon and overdue notices of the loans not returned at now, once per due date,
+// in the language of the patron. The patrons without email are skipped until they have one.
+func SendNotices(db *gorm.DB, now time.Time) (Notices, error) {
+	var notices Notices
+
+	loans := func(condition string, args ...any) ([]models.Loan, error) {
+		var loans []models.Loan
+		err := db.Joins("Patron").
+			Preload("Book", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+			Where("loans.returned_at IS NULL AND Patron.email <> ''").
+			Where(condition, args...).
+			Order("loans.due_at").Find(&loans).Error
+		return loans, err
+	}
+
+	if dueSoon := DueSoon(); dueSoon > 0 {
+		due, err := loans("loans.due_soon_notice_at IS NULL AND loans.due_at > ? AND loans.due_at <= ?", now, now.Add(dueSoon))
+		if err != nil {
+			return notices, err
+		}
+		for _, loan := range due {
+			sent, err := notice(db, loan, notify.TemplateDueSoon, "due_soon_notice_at", loan.DueAt.Sub(now), now)
+			if err != nil {
+				return notices, err
+			}
+			if sent {
+				notices.DueSoon++
+			}
+		}
+	}
+
+	overdue, err := loans("loans.overdue_notice_at IS NULL AND loans.due_at <= ?", now)
+	if err != nil {
+		return notices, err
+	}
+	for _, loan := range overdue {
+		sent, err := notice(db, loan, notify.TemplateOverdue, "overdue_notice_at", now.Sub(loan.DueAt), now)
+		if err != nil {
+			return notices, err
+		}
+		if sent {
+			notices.Overdue++
+		}
+	}
+	return notices, nil
+}
+
+// notice writes the notice of a loan and marks it as sent in column, left is the time until or since the due date.
+// It returns false when another run marked the loan first, its notice is then not written twice.
+func notice(db *gorm.DB, loan models.Loan, template, column string, left time.Duration, now time.Time) (bool, error) {
+	days := int(math.Ceil(left.Hours() / 24))
+	if days < 1 {
+		days = 1
+	}
+	sent := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The loan is claimed first, the update only matches when no other run marked it since it was read
+		claim := tx.Model(&models.Loan{}).Where("id = ? AND "+column+" IS NULL", loan.ID).Update(column, now)
+		if claim.Error != nil || claim.RowsAffected != 1 {
+			return claim.Error
+		}
+		_, err := outbox.Enqueue(tx, template, loan.Patron.Language, []string{loan.Patron.Email}, map[string]any{
+			"Name":  loan.Patron.Name,
+			"Title": loan.Book.Title,
+			"DueAt": loan.DueAt,
+			"Days":  days,
+		}, now)
+		sent = err == nil
+		return err
+	})
+	return sent, err
+}
+
+// ScheduleNotices writes the notices of the loans every interval in the background.
+func ScheduleNotices(db *gorm.DB, interval time.Duration) {
+	go func() {
+		for {
+			notices, err := SendNotices(db, time.Now())
+			if err != nil {
+				fmt.Printf("Failed to send the loan notices: %v\n", err)
+			} else if notices != (Notices{}) {
+				fmt.Printf("Sent %d due soon and %d overdue notices\n", notices.DueSoon, notices.Overdue)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
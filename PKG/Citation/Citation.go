@@ -0,0 +1,211 @@
+package citation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+)
+
+// Formats rendering a whole file and styles rendering one plain text reference per book
+const (
+	BibTeX  = "bibtex"
+	RIS     = "ris"
+	CSLJSON = "csl-json"
+	APA     = "apa"
+	MLA     = "mla"
+	Chicago = "chicago"
+)
+
+// idPrefix of the CSL-JSON item IDs and of the BibTeX keys that cannot be made from the author ==> "book-12"
+const idPrefix = "book"
+
+// ContentTypes of the file formats
+var ContentTypes = map[string]string{
+	BibTeX:  "application/x-bibtex; charset=utf-8",
+	RIS:     "application/x-research-info-systems; charset=utf-8",
+	CSLJSON: "application/vnd.citationstyles.csl+json",
+}
+
+// IsStyle reports if format renders plain text references (apa, mla or chicago).
+func IsStyle(format string) bool {
+	return format == APA || format == MLA || format == Chicago
+}
+
+// Render renders the books (with their Author preloaded) in a file format: bibtex, ris or csl-json.
+func Render(format string, books []models.Book) ([]byte, error) {
+	switch format {
+	case BibTeX:
+		var b strings.Builder
+		used := map[string]bool{}
+		for _, book := range books {
+			key := uniqueKey(bibTeXKey(book), book, used)
+			used[key] = true
+			b.WriteString(bibTeXEntry(key, book))
+		}
+		return []byte(b.String()), nil
+	case RIS:
+		var b strings.Builder
+		for _, book := range books {
+			b.WriteString(risEntry(book))
+		}
+		return []byte(b.String()), nil
+	case CSLJSON:
+		items := make([]cslItem, 0, len(books))
+		for _, book := range books {
+			items = append(items, newCSLItem(book))
+		}
+		return json.MarshalIndent(items, "", "  ")
+	}
+	return nil, fmt.Errorf("unknown citation format %q", format)
+}
+
+// Reference formats a book as a plain text reference in a style: apa, mla or chicago.
+// There is no publisher in the catalog so it is left out of the three styles.
+func Reference(style string, book models.Book) (string, error) {
+	given, family := splitName(book.Author.Name)
+	year := book.PublishedDate.Year()
+	title := strings.TrimSuffix(book.Title, ".")
+
+	switch style {
+	case APA:
+		// Doe, J. (2023). Title.
+		author := family
+		if initials := initials(given); initials != "" {
+			author += ", " + initials
+		}
+		return fmt.Sprintf("%s (%d). %s.", author, year, title), nil
+	case MLA:
+		// Doe, John. Title. 2023.
+		return fmt.Sprintf("%s. %s. %d.", invertedName(given, family), title, year), nil
+	case Chicago:
+		// Doe, John. 2023. Title. (reference list entry of the author-date system)
+		return fmt.Sprintf("%s. %d. %s.", invertedName(given, family), year, title), nil
+	}
+	return "", fmt.Errorf("unknown citation style %q", style)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+var bibTeXEscaper = strings.NewReplacer(`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "&", `\&`, "%", `\%`, "$", `\$`, "#", `\#`, "_", `\_`)
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// bibTeXKey ==> family name + year + first word of the title, ex: doe2023sample
+func bibTeXKey(book models.Book) string {
+	_, family := splitName(book.Author.Name)
+
+	key := nonAlphanumeric.ReplaceAllString(strings.ToLower(family), "")
+	if words := strings.Fields(strings.ToLower(book.Title)); len(words) > 0 {
+		key = fmt.Sprintf("%s%d%s", key, book.PublishedDate.Year(), nonAlphanumeric.ReplaceAllString(words[0], ""))
+	}
+	if key == "" {
+		key = fmt.Sprintf("%s%d", idPrefix, book.ID)
+	}
+	return key
+}
+
+// uniqueKey keeps the keys of a file distinct, the second doe2023sample becomes doe2023sampleb, the third doe2023samplec...
+// and past z the book ID is appended.
+func uniqueKey(key string, book models.Book, used map[string]bool) string {
+	if !used[key] {
+		return key
+	}
+	for suffix := 'b'; suffix <= 'z'; suffix++ {
+		if candidate := key + string(suffix); !used[candidate] {
+			return candidate
+		}
+	}
+	return fmt.Sprintf("%s-%d", key, book.ID)
+}
+
+func bibTeXEntry(key string, book models.Book) string {
+	given, family := splitName(book.Author.Name)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "@book{%s,\n", key)
+	fmt.Fprintf(&b, "  author = {%s},\n", bibTeXEscaper.Replace(invertedName(given, family)))
+	fmt.Fprintf(&b, "  title = {%s},\n", bibTeXEscaper.Replace(book.Title))
+	fmt.Fprintf(&b, "  year = {%d},\n", book.PublishedDate.Year())
+	fmt.Fprintf(&b, "  isbn = {%s}\n", bibTeXEscaper.Replace(book.ISBN))
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+func risEntry(book models.Book) string {
+	given, family := splitName(book.Author.Name)
+
+	// Every RIS line is "XX  - value" and a record ends with "ER  - "
+	var b strings.Builder
+	b.WriteString("TY  - BOOK\r\n")
+	fmt.Fprintf(&b, "AU  - %s\r\n", invertedName(given, family))
+	fmt.Fprintf(&b, "TI  - %s\r\n", book.Title)
+	fmt.Fprintf(&b, "PY  - %d\r\n", book.PublishedDate.Year())
+	fmt.Fprintf(&b, "DA  - %s\r\n", book.PublishedDate.Format("2006/01/02"))
+	fmt.Fprintf(&b, "SN  - %s\r\n", book.ISBN)
+	b.WriteString("ER  - \r\n")
+	return b.String()
+}
+
+type cslName struct {
+	Family string `json:"family"`
+	Given  string `json:"given,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+type cslItem struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Title  string    `json:"title"`
+	Author []cslName `json:"author,omitempty"`
+	Issued cslDate   `json:"issued"`
+	ISBN   string    `json:"ISBN,omitempty"`
+}
+
+func newCSLItem(book models.Book) cslItem {
+	item := cslItem{
+		ID:    fmt.Sprintf("%s-%d", idPrefix, book.ID),
+		Type:  "book",
+		Title: book.Title,
+		Issued: cslDate{DateParts: [][]int{{
+			book.PublishedDate.Year(), int(book.PublishedDate.Month()), book.PublishedDate.Day(),
+		}}},
+		ISBN: book.ISBN,
+	}
+
+	if book.Author.Name != "" {
+		given, family := splitName(book.Author.Name)
+		item.Author = []cslName{{Family: family, Given: given}}
+	}
+	return item
+}
+
+// splitName splits "John Ronald Doe" into "John Ronald" and "Doe", the catalog stores names forename first.
+func splitName(name string) (given, family string) {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, " "); i > 0 {
+		return strings.TrimSpace(name[:i]), name[i+1:]
+	}
+	return "", name
+}
+
+func invertedName(given, family string) string {
+	if given == "" {
+		return family
+	}
+	return family + ", " + given
+}
+
+// initials ==> "John Ronald" becomes "J. R."
+func initials(given string) string {
+	var parts []string
+	for _, word := range strings.Fields(given) {
+		parts = append(parts, string([]rune(word)[0])+".")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,76 @@
+package citation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleBook() models.Book {
+	return models.Book{
+		ID:            3,
+		Title:         "The Hobbit",
+		ISBN:          "9780261103344",
+		PublishedDate: time.Date(1937, time.September, 21, 0, 0, 0, 0, time.UTC),
+		Author:        models.Author{Name: "John Ronald Tolkien"},
+	}
+}
+
+func TestRenderBibTeX(t *testing.T) {
+	out, err := Render(BibTeX, []models.Book{sampleBook()})
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "@book{tolkien1937the,"))
+	assert.Contains(t, string(out), "author = {Tolkien, John Ronald}")
+}
+
+func TestRenderBibTeXDuplicateKeys(t *testing.T) {
+	second := sampleBook()
+	second.ID = 4
+	third := sampleBook()
+	third.ID = 5
+
+	out, err := Render(BibTeX, []models.Book{sampleBook(), second, third})
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "@book{tolkien1937the,")
+	assert.Contains(t, string(out), "@book{tolkien1937theb,")
+	assert.Contains(t, string(out), "@book{tolkien1937thec,")
+}
+
+func TestRenderRIS(t *testing.T) {
+	out, err := Render(RIS, []models.Book{sampleBook()})
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "TY  - BOOK\r\n")
+	assert.Contains(t, string(out), "PY  - 1937\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "ER  - \r\n"))
+}
+
+func TestRenderCSLJSON(t *testing.T) {
+	out, err := Render(CSLJSON, []models.Book{sampleBook()})
+	assert.NoError(t, err)
+
+	var items []map[string]any
+	assert.NoError(t, json.Unmarshal(out, &items))
+	assert.Len(t, items, 1)
+	assert.Equal(t, "book", items[0]["type"])
+	assert.Equal(t, "book-3", items[0]["id"])
+}
+
+func TestReference(t *testing.T) {
+	apa, _ := Reference(APA, sampleBook())
+	mla, _ := Reference(MLA, sampleBook())
+	chicago, _ := Reference(Chicago, sampleBook())
+
+	assert.Equal(t, "Tolkien, J. R. (1937). The Hobbit.", apa)
+	assert.Equal(t, "Tolkien, John Ronald. The Hobbit. 1937.", mla)
+	assert.Equal(t, "Tolkien, John Ronald. 1937. The Hobbit.", chicago)
+
+	_, err := Reference("harvard", sampleBook())
+	assert.Error(t, err)
+}
@@ -0,0 +1,12 @@
+package config
+
+import "os"
+
+// Getenv returns the value of the environment variable key or fallback when it is not set.
+// The settings of the application are all read from the environment so nothing secret is committed.
+func Getenv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
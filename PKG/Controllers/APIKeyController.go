@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entity type of the API keys in the audit log
+const entityAPIKey = "apikey"
+
+// Action of the audit log when an API key is revoked, the key is kept to show its last use
+const actionRevoke = "revoke"
+
+// Lifetime of an API key when ExpiresInDays is not given
+const defaultAPIKeyDays = 365
+
+// Scopes are catalog:read, circulation or admin, the key expires after ExpiresInDays (365 when it is not given)
+type APIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAllAPIKeys godoc
+// @Summary      Get all API keys
+// @Description  Get the API keys with their scopes, expiry and last use, the newest first (the keys themselves are never shown again)
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/apikey [get]
+func GetAllAPIKeys(c *fiber.Ctx) error {
+	ensureDB()
+
+	var keys []models.APIKey
+	if err := db.Order("id DESC").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch API keys",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  keys,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// CreateAPIKey godoc
+// @Summary      Issue a new API key
+// @Description  Issue an API key for an integration, it is sent in the X-API-Key header. The key is only returned by this call
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        apikey  body  APIKeyRequest  true  "API key data"
+// @Success      201  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/apikey [post]
+func CreateAPIKey(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req APIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Name is required",
+		})
+	}
+	if len(req.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Scopes are required",
+		})
+	}
+	if req.ExpiresInDays < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid expiresInDays",
+		})
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAPIKeyDays
+	}
+
+	// The key is linked to the user issuing it, not to another API key
+	var createdBy *uint
+	if claims, ok := auth.User(c); ok {
+		if id, err := strconv.ParseUint(claims.Subject, 10, 64); err == nil {
+			userID := uint(id)
+			createdBy = &userID
+		}
+	}
+
+	var key models.APIKey
+	var raw string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		key, raw, err = auth.IssueAPIKey(tx, req.Name, req.Scopes, time.Now().AddDate(0, 0, req.ExpiresInDays), createdBy)
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionCreate, entityAPIKey, key.ID, nil, key)
+	})
+	if errors.Is(err, auth.ErrUnknownScope) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Unknown scope, use catalog:read, circulation or admin",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"error": false,
+		"data":  key,
+		"key":   raw,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Revoke an API key, it is refused from the next request. The key stays in the list with its last use
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        keyid  path  string  true  "API key ID"
+// @Success      200  {object}  models.APIKey
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/apikey/{keyid} [delete]
+func RevokeAPIKey(c *fiber.Ctx) error {
+	ensureDB()
+
+	id := c.Params("keyid")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter API key ID",
+		})
+	}
+
+	var key models.APIKey
+	if err := db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "API key not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get API key",
+		})
+	}
+
+	if key.RevokedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "API key is already revoked",
+		})
+	}
+
+	previousKey := key
+	now := time.Now()
+	key.RevokedAt = &now
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&key).UpdateColumn("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, actionRevoke, entityAPIKey, key.ID, previousKey, key)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to revoke API key",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  key,
+	})
+}
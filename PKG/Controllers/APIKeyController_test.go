@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestWithKey(app *fiber.App, method, path, key string) *http.Response {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(auth.APIKeyHeader, key)
+	resp, _ := app.Test(req, -1)
+	return resp
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	resp := postJSON(app, "/api/apikey", APIKeyRequest{Name: "kiosk", Scopes: []string{"everything"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = postJSON(app, "/api/apikey", APIKeyRequest{Name: "kiosk"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = postJSON(app, "/api/apikey", APIKeyRequest{Name: "kiosk", Scopes: []string{auth.ScopeCatalogRead, auth.ScopeCirculation}})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var result struct {
+		Data models.APIKey `json:"data"`
+		Key  string        `json:"key"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.True(t, strings.HasPrefix(result.Key, result.Data.Prefix))
+	assert.Equal(t, "catalog:read circulation", result.Data.Scopes)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 365), result.Data.ExpiresAt, time.Minute)
+
+	// Only the hash is stored
+	var stored models.APIKey
+	db.First(&stored, result.Data.ID)
+	assert.NotEqual(t, result.Key, stored.KeyHash)
+	assert.NotContains(t, stored.KeyHash, result.Key)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	patron := models.Patron{Barcode: "P1", Name: "Patron"}
+	db.Create(&patron)
+	loansPath := "/api/patron/" + strconv.Itoa(int(patron.ID)) + "/loans"
+
+	_, discovery, _ := auth.IssueAPIKey(db, "discovery", []string{auth.ScopeCatalogRead}, time.Now().Add(time.Hour), nil)
+	kioskKey, kiosk, _ := auth.IssueAPIKey(db, "kiosk", []string{auth.ScopeCirculation}, time.Now().Add(time.Hour), nil)
+	_, expired, _ := auth.IssueAPIKey(db, "old", []string{auth.ScopeAdmin}, time.Now().Add(-time.Hour), nil)
+
+	app := protectedApp()
+
+	resp := requestWithKey(app, http.MethodGet, loansPath, discovery)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = requestWithKey(app, http.MethodGet, loansPath, kiosk)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	db.First(&kioskKey, kioskKey.ID)
+	assert.NotNil(t, kioskKey.LastUsedAt)
+
+	resp = requestWithKey(app, http.MethodGet, loansPath, expired)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = requestWithKey(app, http.MethodGet, loansPath, "lms_unknown")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	key, raw, _ := auth.IssueAPIKey(db, "kiosk", []string{auth.ScopeCirculation}, time.Now().Add(time.Hour), nil)
+	path := "/api/apikey/" + strconv.Itoa(int(key.ID))
+
+	resp, _ := app.Test(httptest.NewRequest(http.MethodDelete, path, nil), -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, path, nil), -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = requestWithKey(protectedApp(), http.MethodGet, "/api/patron/1/loans", raw)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
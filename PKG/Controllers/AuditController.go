@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	audit "github.com/Pyramakerz/Library_Management_System/PKG/Audit"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Number of logs returned when limit is not sent, and its upper bound
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// requestID returns the ID set by the requestid middleware, or the one sent by the client
+func requestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestid").(string); ok && id != "" {
+		return id
+	}
+	return c.Get(fiber.HeaderXRequestID)
+}
+
+// recordAudit logs a mutating call in tx, before and after are the record before and after the call (nil when it doesn't exist)
+func recordAudit(tx *gorm.DB, c *fiber.Ctx, action, entityType string, entityID uint, before, after any) error {
+	_, err := audit.Record(tx, audit.Entry{
+		Actor:      actor(c),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     before,
+		After:      after,
+		RequestID:  requestID(c),
+		IP:         c.IP(),
+	})
+	return err
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAuditLogs godoc
+// @Summary      Get the audit log
+// @Description  Get the logs of the mutating calls, the newest first, with the record before and after each call
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        actor       query  string  false  "Actor"
+// @Param        action      query  string  false  "create, update, delete, softdelete or revert"
+// @Param        entitytype  query  string  false  "book, author or patron"
+// @Param        entityid    query  int     false  "Entity ID"
+// @Param        requestid   query  string  false  "Request ID"
+// @Param        from        query  string  false  "Logged on or after this date (2006-01-02 or RFC 3339)"
+// @Param        to          query  string  false  "Logged on or before this date (2006-01-02 or RFC 3339)"
+// @Param        limit       query  int     false  "Number of logs (100 by default, 1000 max)"
+// @Param        offset      query  int     false  "Number of logs to skip"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/audit [get]
+func GetAuditLogs(c *fiber.Ctx) error {
+	ensureDB()
+
+	query := db.Model(&models.AuditLog{})
+
+	for param, column := range map[string]string{
+		"actor":      "actor",
+		"action":     "action",
+		"entitytype": "entity_type",
+		"requestid":  "request_id",
+	} {
+		if value := c.Query(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+
+	if entityID := c.Query("entityid"); entityID != "" {
+		n, err := strconv.ParseUint(entityID, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid entity ID",
+			})
+		}
+		query = query.Where("entity_id = ?", n)
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, _, err := parseAuditDate(from)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid from date",
+			})
+		}
+		query = query.Where("created_at >= ?", date)
+	}
+
+	if to := c.Query("to"); to != "" {
+		date, day, err := parseAuditDate(to)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid to date",
+			})
+		}
+		// Include the whole last day
+		if day {
+			query = query.Where("created_at < ?", date.AddDate(0, 0, 1))
+		} else {
+			query = query.Where("created_at <= ?", date)
+		}
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(auditDefaultLimit)))
+	if err != nil || limit < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Limit must be a positive number",
+		})
+	}
+	if limit > auditMaxLimit {
+		limit = auditMaxLimit
+	}
+
+	offset, err := strconv.Atoi(c.Query("offset", "0"))
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Offset must be a positive number",
+		})
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the audit log",
+		})
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"total": total,
+		"data":  logs,
+	})
+}
+
+// parseAuditDate parses a date or a time, day is true for a date
+func parseAuditDate(s string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, false, err
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// VerifyAuditLog godoc
+// @Summary      Verify the audit log
+// @Description  Recompute the hash chain of the audit log, valid is false with the first broken log when a log was changed or removed
+// @Tags         audit
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/audit/verify [get]
+func VerifyAuditLog(c *fiber.Ctx) error {
+	ensureDB()
+
+	result, err := audit.Verify(db)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to verify the audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  result,
+	})
+}
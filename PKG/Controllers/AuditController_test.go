@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	audit "github.com/Pyramakerz/Library_Management_System/PKG/Audit"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	body, _ := json.Marshal(models.Author{Name: "John Doe", Email: "john@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/api/author", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "librarian")
+	req.Header.Set("X-Request-ID", "req-1")
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var author models.Author
+	db.Where("email = ?", "john@example.com").First(&author)
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/author/softdelete/%d", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/audit?entitytype=author&entityid=%d", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Total int64             `json:"total"`
+		Data  []models.AuditLog `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	if assert.Len(t, result.Data, 2) {
+		// The newest first
+		assert.Equal(t, "softdelete", result.Data[0].Action)
+		assert.NotEmpty(t, result.Data[0].RequestID)
+		assert.Equal(t, "null", string(result.Data[0].After))
+		assert.Equal(t, result.Data[1].Hash, result.Data[0].PrevHash)
+
+		assert.Equal(t, "create", result.Data[1].Action)
+		assert.Equal(t, "librarian", result.Data[1].Actor)
+		assert.Equal(t, "req-1", result.Data[1].RequestID)
+		assert.Equal(t, "null", string(result.Data[1].Before))
+		assert.Contains(t, string(result.Data[1].After), `"name":"John Doe"`)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/audit?actor=librarian", nil)
+	resp, _ = app.Test(req, -1)
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, int64(1), result.Total)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	for _, author := range []models.Author{
+		{Name: "John Doe", Email: "john@example.com"},
+		{Name: "Jane Doe", Email: "jane@example.com"},
+	} {
+		body, _ := json.Marshal(author)
+		req := httptest.NewRequest(http.MethodPost, "/api/author", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		app.Test(req, -1)
+	}
+
+	verify := func() audit.Verification {
+		req := httptest.NewRequest(http.MethodGet, "/api/audit/verify", nil)
+		resp, _ := app.Test(req, -1)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result struct {
+			Data audit.Verification `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result.Data
+	}
+
+	result := verify()
+	assert.True(t, result.Valid)
+	assert.Equal(t, 2, result.Checked)
+
+	var first models.AuditLog
+	db.Order("id").First(&first)
+
+	// GORM refuses to change a log, raw SQL is detected by the chain
+	assert.ErrorIs(t, db.Delete(&first).Error, models.ErrAuditLogAppendOnly)
+	db.Exec("UPDATE audit_logs SET actor = ? WHERE id = ?", "mallory", first.ID)
+
+	result = verify()
+	assert.False(t, result.Valid)
+	assert.Equal(t, first.ID, result.BrokenAt)
+}
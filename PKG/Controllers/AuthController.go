@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	audit "github.com/Pyramakerz/Library_Management_System/PKG/Audit"
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Code is the code of the authenticator app (or a recovery code) of the users who enabled two-factor authentication
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Login godoc
+// @Summary      Log in
+// @Description  Exchange a username and password for a short-lived access token (sent as Authorization: Bearer) and a refresh token,
+// @Description  the users of the directory (LDAP_URL) log in with their directory password and are created on their first login.
+// @Description  The users who enabled two-factor authentication also send the code of their authenticator app or a recovery code
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body  LoginRequest  true  "Username, password and two-factor code"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Failure      502  {object}  any
+// @Router       /api/auth/login [post]
+func Login(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	user, err := auth.Authenticate(db, req.Username, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) && ldap.Settings().Enabled() {
+		// The users of the directory have no local password, their password is checked with a bind
+		var ferr *fiber.Error
+		if user, ferr = ldapLogin(c, req.Username, req.Password); ferr != nil {
+			return c.Status(ferr.Code).JSON(fiber.Map{
+				"error":   true,
+				"message": ferr.Message,
+			})
+		}
+	} else if errors.Is(err, auth.ErrInvalidCredentials) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid username or password",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log in",
+		})
+	}
+
+	err = auth.VerifyTwoFactor(db, user, req.Code, time.Now())
+	if errors.Is(err, auth.ErrTwoFactorRequired) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":             true,
+			"message":           "Two-factor code is required",
+			"twoFactorRequired": true,
+		})
+	} else if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid two-factor code",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log in",
+		})
+	}
+
+	tokens, err := auth.Issue(db, user, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log in",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  tokens,
+	})
+}
+
+// ldapLogin checks the password of a user in the directory and returns their user, the error has the status and message of the response.
+func ldapLogin(c *fiber.Ctx, username, password string) (models.User, *fiber.Error) {
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var created bool
+		var err error
+		user, created, err = ldap.Authenticate(tx, username, password)
+		if err != nil || !created {
+			return err
+		}
+		_, err = audit.Record(tx, audit.Entry{
+			Actor:      ldap.Actor,
+			Action:     history.ActionCreate,
+			EntityType: entityUser,
+			EntityID:   user.ID,
+			After:      user,
+			RequestID:  requestID(c),
+			IP:         c.IP(),
+		})
+		return err
+	})
+	if errors.Is(err, ldap.ErrInvalidCredentials) {
+		return user, fiber.NewError(fiber.StatusUnauthorized, "Invalid username or password")
+	} else if errors.Is(err, ldap.ErrUsernameTaken) {
+		return user, fiber.NewError(fiber.StatusConflict, "Username already exists as a local user")
+	} else if err != nil {
+		var ldapErr *goldap.Error
+		if errors.As(err, &ldapErr) || errors.Is(err, ldap.ErrNotConfigured) {
+			return user, fiber.NewError(fiber.StatusBadGateway, "Failed to reach the directory")
+		}
+		return user, fiber.NewError(fiber.StatusInternalServerError, "Failed to log in")
+	}
+
+	if user.Disabled {
+		return user, fiber.NewError(fiber.StatusUnauthorized, "User is disabled")
+	}
+	return user, nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RefreshTokens godoc
+// @Summary      Refresh the tokens
+// @Description  Exchange a refresh token for a new access token and a new refresh token, the refresh token can only be used once
+// @Description  and using it again revokes every token of the session
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body  RefreshRequest  true  "Refresh token"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/refresh [post]
+func RefreshTokens(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Refresh token is required",
+		})
+	}
+
+	tokens, err := auth.Refresh(db, req.RefreshToken, time.Now())
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid refresh token",
+		})
+	} else if errors.Is(err, auth.ErrRefreshTokenReused) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Refresh token was already used, log in again",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to refresh the tokens",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  tokens,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Logout godoc
+// @Summary      Log out
+// @Description  Revoke a refresh token and the tokens rotated from the same login, the access token expires on its own
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body  RefreshRequest  true  "Refresh token"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/logout [post]
+func Logout(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Refresh token is required",
+		})
+	}
+
+	err := auth.RevokeFamily(db, req.RefreshToken, time.Now())
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid refresh token",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log out",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Logged out successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// LogoutEverywhere godoc
+// @Summary      Log out everywhere
+// @Description  Revoke every refresh token of the current user
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  any
+// @Failure      401  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/logout/all [post]
+func LogoutEverywhere(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := currentUser(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	if err := auth.RevokeUser(db, user.ID, time.Now()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log out",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Logged out everywhere successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetCurrentUser godoc
+// @Summary      Get the current user
+// @Description  Get the user of the access token with their role and its permissions
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.User
+// @Failure      401  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/me [get]
+func GetCurrentUser(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := currentUser(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  user,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// currentUser returns the user of the access token, the error has the status and message of the response.
+func currentUser(c *fiber.Ctx) (models.User, *fiber.Error) {
+	var user models.User
+
+	claims, ok := auth.User(c)
+	if !ok {
+		return user, fiber.NewError(fiber.StatusUnauthorized, "Missing access token")
+	}
+	if err := db.Preload("Role.Permissions").First(&user, claims.Subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, fiber.NewError(fiber.StatusUnauthorized, "User not found")
+		}
+		return user, fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+	}
+	// The routes of the current user skip auth.Require, the access token of a disabled user is refused here too
+	if user.Disabled {
+		return user, fiber.NewError(fiber.StatusUnauthorized, "User is disabled")
+	}
+	return user, nil
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestUser(t *testing.T, username, password string) models.User {
+	hash, err := auth.HashPassword(password)
+	assert.NoError(t, err)
+	user := models.User{Username: username, PasswordHash: hash}
+	config.GetDB().Create(&user)
+	return user
+}
+
+func postJSON(app *fiber.App, path string, body any) *http.Response {
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+	return resp
+}
+
+func decodeTokens(resp *http.Response) auth.Tokens {
+	var result struct {
+		Data auth.Tokens `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.Data
+}
+
+func TestLogin(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	createTestUser(t, "librarian", "correct horse")
+
+	resp := postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "wrong password"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "nobody", Password: "correct horse"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tokens := decodeTokens(resp)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	user := createTestUser(t, "librarian", "correct horse")
+	tokens, err := auth.Issue(db, user, time.Now())
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use("/api", auth.Middleware())
+	app.Get("/api/auth/me", GetCurrentUser)
+	app.Post("/api/book", CreateBook)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/book", nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Bearer realm="api"`, resp.Header.Get("WWW-Authenticate"))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken+"x")
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data models.User `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, "librarian", result.Data.Username)
+
+	// The access token is still valid but the user is disabled
+	db.Model(&user).Update("disabled", true)
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRefreshRotation(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	createTestUser(t, "librarian", "correct horse")
+	first := decodeTokens(postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"}))
+
+	resp := postJSON(app, "/api/auth/refresh", RefreshRequest{RefreshToken: first.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	second := decodeTokens(resp)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// The first token was rotated, using it again revokes the session so the second one stops working too
+	resp = postJSON(app, "/api/auth/refresh", RefreshRequest{RefreshToken: first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = postJSON(app, "/api/auth/refresh", RefreshRequest{RefreshToken: second.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLogout(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	createTestUser(t, "librarian", "correct horse")
+	tokens := decodeTokens(postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"}))
+
+	resp := postJSON(app, "/api/auth/logout", RefreshRequest{RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = postJSON(app, "/api/auth/refresh", RefreshRequest{RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestCreateUser(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	resp := postJSON(app, "/api/user", UserRequest{Username: "librarian", Password: "short"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = postJSON(app, "/api/user", UserRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = postJSON(app, "/api/user", UserRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// startMockLdap serves a mock directory and configures the LDAP login and sync with it, the service bind is anonymous
+func startMockLdap(t *testing.T, entries ...ldap.MockEntry) *ldap.MockServer {
+	server := ldap.NewMockServer(entries...)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go server.Serve(listener)
+
+	t.Setenv("LDAP_URL", "ldap://"+listener.Addr().String())
+	t.Setenv("LDAP_BASE_DN", "dc=example,dc=com")
+	return server
+}
+
+// ldapPerson is an entry of the mock directory with the default attributes of the sync
+func ldapPerson(uid, name, barcode string) ldap.MockEntry {
+	return ldap.MockEntry{
+		DN: "uid=" + uid + ",ou=people,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"objectClass":    {"inetOrPerson"},
+			"uid":            {uid},
+			"cn":             {name},
+			"mail":           {uid + "@example.com"},
+			"employeeNumber": {barcode},
+		},
+		Password: "secret",
+	}
+}
+
+func TestLdapLogin(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	startMockLdap(t, ldapPerson("jdoe", "John Doe", "L1001"), ldapPerson("librarian", "Local Name", "L1002"))
+	createTestUser(t, "librarian", "correct horse")
+
+	resp := postJSON(app, "/api/auth/login", LoginRequest{Username: "jdoe", Password: "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// The user of the directory is created on their first login
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "jdoe", Password: "secret"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, decodeTokens(resp).AccessToken)
+
+	var user models.User
+	assert.NoError(t, db.Preload("Role").Where("external_id = ?", ldap.ExternalID("jdoe")).First(&user).Error)
+	assert.Equal(t, auth.RoleMember, user.Role.Name)
+	assert.Empty(t, user.PasswordHash)
+
+	var logs int64
+	db.Model(&models.AuditLog{}).Where("actor = ? AND entity_type = ? AND entity_id = ?", ldap.Actor, entityUser, user.ID).Count(&logs)
+	assert.Equal(t, int64(1), logs)
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "jdoe", Password: "secret"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The local users keep their password, and their name isn't taken by the directory
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "secret"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// An empty password would be an anonymous bind
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "jdoe", Password: ""})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	db.Model(&user).Update("disabled", true)
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "jdoe", Password: "secret"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
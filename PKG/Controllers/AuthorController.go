@@ -3,13 +3,18 @@ package controllers
 import (
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/MakMoinee/go-mith/pkg/email"
 	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
 	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
+	trash "github.com/Pyramakerz/Library_Management_System/PKG/Trash"
 	utils "github.com/Pyramakerz/Library_Management_System/PKG/Utils"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ----------------------------------------------------------------------------------------------------------------------------------
@@ -33,6 +38,8 @@ func ensureDB() {
 // @Tags         authors
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Success      200  {object}  any
 // @Failure      500  {object}  any
 // @Router       /api/author [get]
@@ -61,6 +68,8 @@ func GetAllAuthors(c *fiber.Ctx) error {
 // @Tags         authors
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        authorid  path  string  true  "Author ID"
 // @Success      200  {object}  models.Author
 // @Failure      400  {object}  any
@@ -107,6 +116,8 @@ func GetAuthorByID(c *fiber.Ctx) error {
 // @Tags         authors
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        author  body  models.Author  true  "Author data"
 // @Success      201  {object}  models.Author
 // @Failure      400  {object}  any
@@ -165,8 +176,20 @@ func CreateAuthor(c *fiber.Ctx) error {
 		}
 	}
 
-	// Create() ==> already make the save operation
-	if err := db.Create(&author).Error; err != nil {
+	// The timestamps are set by GORM, not by the client
+	author.CreatedAt, author.UpdatedAt = time.Time{}, time.Time{}
+
+	// Create() ==> already make the save operation, the author and its first version are saved together
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&author).Error; err != nil {
+			return err
+		}
+		if _, err := history.Record(tx, history.Author(author, history.ActionCreate, actor(c))); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionCreate, history.EntityAuthor, author.ID, nil, author)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to create author",
@@ -183,10 +206,12 @@ func CreateAuthor(c *fiber.Ctx) error {
 
 // UpdateAuthor godoc
 // @Summary      Update an existing author
-// @Description  Update an existing author's information
+// @Description  Update an existing author's information, a new email is notified to the author at their previous and new address
 // @Tags         authors
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        authorid  path  string  true  "Author ID"
 // @Param        author    body  models.Author  true  "Updated author data"
 // @Success      200  {object}  models.Author
@@ -247,23 +272,31 @@ func UpdateAuthor(c *fiber.Ctx) error {
 		})
 	}
 
-	if existingAuthor.Email != updatedAuthor.Email {
-		//  SMTP (Simple Mail Transfer Protocol) 587 (its port number)
-		emailService := email.NewEmailService(587, "smtp.gmail.com", "ranamelgohary2000@gmail.com", "inoxwuyyzogdvrfs")
-		isSent, err := emailService.SendEmail("r.elgohary2000@gmail.com", "email notification", "Author information updated")
-		if err != nil {
-			fmt.Println(err)
-		}
-		if isSent {
-			fmt.Println("Done")
-		}
-		fmt.Printf("Sending email notification to %s: Author information updated", updatedAuthor.Email)
-	}
-
+	// The previous values are kept for the history
+	before := history.AuthorFields(existingAuthor)
+	previousAuthor := existingAuthor
 	existingAuthor.Name = updatedAuthor.Name
 	existingAuthor.Email = updatedAuthor.Email
 
-	if err := db.Save(&existingAuthor).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingAuthor).Error; err != nil {
+			return err
+		}
+		entry := history.Author(existingAuthor, history.ActionUpdate, actor(c))
+		entry.Before = before
+		if _, err := history.Record(tx, entry); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionUpdate, history.EntityAuthor, existingAuthor.ID, previousAuthor, existingAuthor); err != nil {
+			return err
+		}
+		// The author is told at both addresses, the outbox worker sends it once the change is committed
+		if previousAuthor.Email != existingAuthor.Email {
+			return enqueueAuthorEmailChanged(tx, previousAuthor, existingAuthor)
+		}
+		return nil
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to update author",
@@ -280,14 +313,21 @@ func UpdateAuthor(c *fiber.Ctx) error {
 
 // DeleteAuthor godoc
 // @Summary      Delete an author
-// @Description  Permanently delete an author by their ID
+// @Description  Permanently delete an author by their ID, an author with books is deleted with them and their loans once confirmed
+// @Description  (428 returns the dependencies and the confirmation token) and an author with checked out books is not deleted (409)
 // @Tags         authors
 // @Accept       json
 // @Produce      json
-// @Param        authorid  path  string  true  "Author ID"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        authorid  path   string  true   "Author ID"
+// @Param        confirm   query  string  false  "Confirmation token returned with the dependencies"
+// @Param        force     query  bool    false  "Delete the dependencies without confirmation"
 // @Success      200  {object}  any
 // @Failure      400  {object}  any
 // @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      428  {object}  any
 // @Failure      500  {object}  any
 // @Router       /api/author/{authorid} [delete]
 func DeleteAuthor(c *fiber.Ctx) error {
@@ -320,7 +360,57 @@ func DeleteAuthor(c *fiber.Ctx) error {
 
 	// Delete() ==> already make the save operation, GORM will ignore the DeletedAt field and perform the operation as if the record is not soft-deleted
 	// db.Unscoped(): This tells GORM to bypass the soft delete functionality.
-	if err := db.Unscoped().Delete(&author).Error; err != nil {
+	// The history of the author and their books is kept, their last versions are the deleted records, and the audit log has their final snapshots
+	var deps trash.Dependencies
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The author and their books are locked until the author is deleted, so the dependencies and the confirmation token
+		// are checked on what is deleted (a checkout locks the book too, it waits or is seen as an active loan)
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&author, author.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "Author not found")
+			}
+			return err
+		}
+
+		// The books (also the ones in the trash) are deleted by the OnDelete:CASCADE constraint
+		var books []models.Book
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("author_id = ?", author.ID).Find(&books).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if deps, err = trash.AuthorDependencies(tx, author); err != nil {
+			return err
+		}
+		if status, message := refuseHardDelete(c, deps); status != 0 {
+			return fiber.NewError(status, message)
+		}
+
+		for _, book := range books {
+			if _, err := history.Record(tx, history.Book(book, history.ActionDelete, actor(c))); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, history.ActionDelete, history.EntityBook, book.ID, book, nil); err != nil {
+				return err
+			}
+		}
+		if _, err := history.Record(tx, history.Author(author, history.ActionDelete, actor(c))); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionDelete, history.EntityAuthor, author.ID, author, nil); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&author).Error
+	})
+	var refused *fiber.Error
+	if errors.As(err, &refused) {
+		return c.Status(refused.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": refused.Message,
+			"data":    deps,
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to delete author",
@@ -330,6 +420,7 @@ func DeleteAuthor(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"error":   false,
 		"message": "Author deleted successfully",
+		"data":    deps,
 	})
 }
 
@@ -337,14 +428,18 @@ func DeleteAuthor(c *fiber.Ctx) error {
 
 // SoftDeleteAuthor godoc
 // @Summary      Soft delete an author
-// @Description  Soft delete an author by their ID (sets the deleted_at timestamp)
+// @Description  Soft delete an author by their ID (sets the deleted_at timestamp), their books are soft deleted with them
+// @Description  or, when SOFT_DELETE_AUTHOR_BOOKS is restrict, the author is not deleted while they have books
 // @Tags         authors
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        authorid  path  string  true  "Author ID"
 // @Success      200  {object}  any
 // @Failure      400  {object}  any
 // @Failure      404  {object}  any
+// @Failure      409  {object}  any
 // @Failure      500  {object}  any
 // @Router       /api/author/softdelete/{authorid} [delete]
 func SoftDeleteAuthor(c *fiber.Ctx) error {
@@ -373,7 +468,49 @@ func SoftDeleteAuthor(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := db.Delete(&author).Error; err != nil {
+	var books []models.Book
+	if err := db.Where("author_id = ?", author.ID).Find(&books).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find the books of the author",
+		})
+	}
+
+	if len(books) > 0 && trash.AuthorBooks() == trash.RestrictBooks {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("Author has %d books, delete them first", len(books)),
+		})
+	}
+
+	// The author and their books get the same deletion time, restoring the author brings back the books deleted with them
+	// UpdateColumn() ==> like Delete() it keeps updated_at, the datestamp of the books for the harvesters
+	deletedAt := gorm.DeletedAt{Time: time.Now(), Valid: true}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&author).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		if _, err := history.Record(tx, history.Author(author, history.ActionSoftDelete, actor(c))); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionSoftDelete, history.EntityAuthor, author.ID, author, nil); err != nil {
+			return err
+		}
+
+		for _, book := range books {
+			if err := tx.Model(&book).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+				return err
+			}
+			if _, err := history.Record(tx, history.Book(book, history.ActionSoftDelete, actor(c))); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, history.ActionSoftDelete, history.EntityBook, book.ID, book, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to soft delete author",
@@ -381,7 +518,20 @@ func SoftDeleteAuthor(c *fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"error":   false,
-		"message": "Author soft deleted successfully",
+		"error":        false,
+		"message":      "Author soft deleted successfully",
+		"deletedBooks": len(books),
 	})
 }
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// enqueueAuthorEmailChanged writes the change of email of an author to the outbox in tx, for both addresses
+func enqueueAuthorEmailChanged(tx *gorm.DB, previous, author models.Author) error {
+	_, err := outbox.Enqueue(tx, notify.TemplateAuthorEmailChanged, "", []string{previous.Email, author.Email}, fiber.Map{
+		"Name":          author.Name,
+		"PreviousEmail": previous.Email,
+		"Email":         author.Email,
+	}, time.Now())
+	return err
+}
@@ -3,13 +3,18 @@ package controllers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
 	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
 	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -19,29 +24,142 @@ func SetupFiberApp() *fiber.App {
 	config.Connect()
 	db := config.GetDB()
 
-	db.AutoMigrate(&models.Author{})
+	db.AutoMigrate(&models.Author{}, &models.Revision{}, &models.AuditLog{}, &models.User{}, &models.RefreshToken{}, &models.Role{}, &models.Permission{}, &models.APIKey{}, &models.LoginState{}, &models.RecoveryCode{}, &models.OutboxMessage{}, &models.EmailTemplate{})
+	auth.Seed(db)
+
+	app.Use(requestid.New())
+
+	// The routes are not behind auth.Middleware() and auth.Require() here so the handlers are tested on their own,
+	// AuthController_test.go and RoleController_test.go test them
+	app.Post("/api/auth/login", Login)
+	app.Post("/api/auth/refresh", RefreshTokens)
+	app.Post("/api/auth/logout", Logout)
+	app.Get("/api/auth/oidc/login", OidcLogin)
+	app.Get("/api/auth/oidc/callback", OidcCallback)
+	app.Post("/api/auth/logout/all", LogoutEverywhere)
+	app.Get("/api/auth/me", GetCurrentUser)
+	app.Post("/api/auth/2fa/enroll", EnrollTwoFactor)
+	app.Post("/api/auth/2fa/confirm", ConfirmTwoFactor)
+	app.Post("/api/auth/2fa/recovery", RegenerateRecoveryCodes)
+	app.Delete("/api/auth/2fa", DisableTwoFactor)
+
+	app.Get("/api/role", GetAllRoles)
+	app.Post("/api/role", CreateRole)
+	app.Put("/api/role/:roleid", UpdateRole)
+	app.Delete("/api/role/:roleid", DeleteRole)
+
+	app.Get("/api/apikey", GetAllAPIKeys)
+	app.Post("/api/apikey", CreateAPIKey)
+	app.Delete("/api/apikey/:keyid", RevokeAPIKey)
+
+	app.Get("/api/user", GetAllUsers)
+	app.Post("/api/user", CreateUser)
+	app.Put("/api/user/:userid", UpdateUser)
+	app.Delete("/api/user/:userid", DeleteUser)
+	app.Delete("/api/user/:userid/2fa", ResetUserTwoFactor)
 
 	app.Get("/api/author", GetAllAuthors)
+	app.Get("/api/author/trash", GetAuthorTrash)
 	app.Get("/api/author/:authorid", GetAuthorByID)
 	app.Post("/api/author", CreateAuthor)
 	app.Put("/api/author/:authorid", UpdateAuthor)
 	app.Delete("/api/author/:authorid", DeleteAuthor)
 	app.Delete("/api/author/softdelete/:authorid", SoftDeleteAuthor)
+	app.Get("/api/author/:authorid/history", GetAuthorHistory)
+	app.Post("/api/author/:authorid/revert/:version", RevertAuthor)
+	app.Post("/api/author/:authorid/restore", RestoreAuthor)
 
 	db.AutoMigrate(&models.Author{}, &models.Book{})
 
 	app.Get("/api/book", GetAllBooks)
+	app.Get("/api/book/export", ExportBooks)
+	app.Get("/api/book/cite", CiteBooks)
+	app.Get("/api/book/trash", GetBookTrash)
 	app.Get("/api/book/:bookid", GetBookByID)
 	app.Post("/api/book", CreateBook)
+	app.Post("/api/book/import", ImportBooks)
 	app.Put("/api/book/:bookid", UpdateBook)
 	app.Delete("/api/book/:bookid", DeleteBook)
 	app.Delete("/api/book/softdelete/:bookid", SoftDeleteBook)
 	app.Get("/api/book/search/:title", SearchBooksByTitle)
+	app.Get("/api/book/:bookid/marc", ExportBookMarc)
+	app.Get("/api/book/:bookid/cite", CiteBook)
+	app.Get("/api/book/:bookid/history", GetBookHistory)
+	app.Post("/api/book/:bookid/revert/:version", RevertBook)
+	app.Post("/api/book/:bookid/restore", RestoreBook)
+
+	app.Post("/api/marc/import", ImportMarc)
+	app.Get("/api/marc/export", ExportMarc)
+
+	app.Get("/api/suggest", Suggest)
+
+	db.AutoMigrate(&models.Patron{}, &models.Loan{})
+
+	app.Get("/api/audit", GetAuditLogs)
+	app.Get("/api/audit/verify", VerifyAuditLog)
+
+	app.Get("/api/outbox", GetOutboxMessages)
+	app.Post("/api/outbox/replay", ReplayDeadOutboxMessages)
+	app.Get("/api/outbox/:messageid", GetOutboxMessage)
+	app.Post("/api/outbox/:messageid/replay", ReplayOutboxMessage)
+
+	app.Get("/api/template", GetAllEmailTemplates)
+	app.Get("/api/template/:name/:language", GetEmailTemplate)
+	app.Put("/api/template/:name/:language", SaveEmailTemplate)
+	app.Delete("/api/template/:name/:language", DeleteEmailTemplate)
+	app.Get("/api/template/:name/:language/preview", PreviewEmailTemplate)
+	app.Post("/api/template/:name/:language/preview", PreviewEmailTemplateDraft)
+
+	app.Get("/api/patron", GetAllPatrons)
+	app.Post("/api/patron/sync", SyncPatrons)
+	app.Get("/api/patron/:patronid", GetPatronByID)
+	app.Get("/api/patron/:patronid/loans", GetPatronLoans)
+	app.Post("/api/patron", CreatePatron)
+	app.Put("/api/patron/:patronid", UpdatePatron)
+	app.Delete("/api/patron/:patronid", DeletePatron)
+
+	app.Get("/oai", OaiPmh)
+	app.Post("/oai", OaiPmh)
+
+	app.Get("/opds", OpdsRoot)
+	app.Get("/opds/new", OpdsNewArrivals)
+	app.Get("/opds/authors", OpdsAuthors)
+	app.Get("/opds/authors/:authorid", OpdsAuthorBooks)
+	app.Get("/opds/subjects", OpdsSubjects)
+	app.Get("/opds/subjects/:subject", OpdsSubjectBooks)
+	app.Get("/opds/search", OpdsSearch)
+	app.Get("/opds/opensearch.xml", OpdsOpenSearch)
+	app.Get("/opds2", OpdsRoot)
+	app.Get("/opds2/new", OpdsNewArrivals)
+	app.Get("/opds2/authors", OpdsAuthors)
+	app.Get("/opds2/authors/:authorid", OpdsAuthorBooks)
+	app.Get("/opds2/subjects", OpdsSubjects)
+	app.Get("/opds2/subjects/:subject", OpdsSubjectBooks)
+	app.Get("/opds2/search", OpdsSearch)
+
+	app.Get("/sru", Sru)
+
+	app.Get("/feeds/new.atom", NewAcquisitionsFeed)
+	app.Get("/feeds/new.rss", NewAcquisitionsFeed)
 	return app
 }
 
 // But it will delete all what is inside the table
 func CleanDB(db *gorm.DB) {
+	db.Exec("DELETE FROM outbox_messages")
+	db.Exec("DELETE FROM email_templates")
+	db.Exec("DELETE FROM login_states")
+	db.Exec("DELETE FROM recovery_codes")
+	db.Exec("DELETE FROM refresh_tokens")
+	db.Exec("DELETE FROM api_keys")
+	db.Exec("DELETE FROM users")
+	db.Exec("DELETE FROM role_permissions")
+	db.Exec("DELETE FROM roles")
+	db.Exec("DELETE FROM permissions")
+	db.Exec("DELETE FROM audit_logs")
+	db.Exec("DELETE FROM revisions")
+	db.Exec("DELETE FROM loans")
+	db.Exec("DELETE FROM patrons")
 	db.Exec("DELETE FROM books")
 	db.Exec("DELETE FROM authors")
 	db.Exec("ALTER TABLE books AUTO_INCREMENT = 1")
@@ -117,6 +235,38 @@ func TestUpdateAuthor(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestUpdateAuthorEnqueuesEmailChange(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	update := func(name, email string) *http.Response {
+		body, _ := json.Marshal(models.Author{Name: name, Email: email})
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/author/%d", author.ID), bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req, -1)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, update("John Doe", "johnny@example.com").StatusCode)
+	var messages []models.OutboxMessage
+	db.Find(&messages)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, notify.TemplateAuthorEmailChanged, messages[0].Template)
+	assert.Equal(t, "john@example.com,johnny@example.com", messages[0].Recipients)
+	assert.Equal(t, outbox.StatusPending, messages[0].Status)
+	assert.Contains(t, messages[0].Body, "from john@example.com to johnny@example.com")
+
+	// Renaming alone doesn't notify
+	assert.Equal(t, http.StatusOK, update("Johnny Doe", "johnny@example.com").StatusCode)
+	var count int64
+	db.Model(&models.OutboxMessage{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
 func TestDeleteAuthor(t *testing.T) {
 	app := SetupFiberApp()
 
@@ -2,11 +2,17 @@ package controllers
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
 	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	search "github.com/Pyramakerz/Library_Management_System/PKG/Search"
+	trash "github.com/Pyramakerz/Library_Management_System/PKG/Trash"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateBookRequest struct {
@@ -14,9 +20,70 @@ type CreateBookRequest struct {
 	Title         string    `json:"title"`
 	ISBN          string    `json:"isbn"`
 	PublishedDate time.Time `json:"publishedDate"`
+	Subject       string    `json:"subject"`
 	AuthorID      uint      `json:"authorID"`
 }
 
+// isbnExists tells if a book has this ISBN, the trashed books too since the unique index still holds their ISBN
+func isbnExists(tx *gorm.DB, isbn string) bool {
+	var existingBook models.Book
+	return tx.Unscoped().Where("isbn = ?", isbn).First(&existingBook).Error == nil
+}
+
+// filterBooks adds the listing filters sent in the query string (ids, title, isbn, subject, authorid, publishedfrom, publishedto) to query.
+func filterBooks(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	if ids := c.Query("ids"); ids != "" {
+		var bookIDs []uint
+		for _, id := range strings.Split(ids, ",") {
+			n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				return nil, errors.New("Invalid book ID " + id)
+			}
+			bookIDs = append(bookIDs, uint(n))
+		}
+		query = query.Where("books.id IN ?", bookIDs)
+	}
+
+	if title := c.Query("title"); title != "" {
+		query = query.Where("title LIKE ?", "%"+title+"%")
+	}
+
+	if isbn := c.Query("isbn"); isbn != "" {
+		query = query.Where("isbn = ?", isbn)
+	}
+
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+
+	if authorID := c.Query("authorid"); authorID != "" {
+		n, err := strconv.ParseUint(authorID, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid author ID")
+		}
+		query = query.Where("author_id = ?", n)
+	}
+
+	if from := c.Query("publishedfrom"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, errors.New("Invalid publishedfrom date")
+		}
+		query = query.Where("published_date >= ?", date)
+	}
+
+	if to := c.Query("publishedto"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, errors.New("Invalid publishedto date")
+		}
+		// Include the whole last day
+		query = query.Where("published_date < ?", date.AddDate(0, 0, 1))
+	}
+
+	return query, nil
+}
+
 // ----------------------------------------------------------------------------------------------------------------------------------
 
 // GetAllBooks godoc
@@ -25,14 +92,32 @@ type CreateBookRequest struct {
 // @Tags         books
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        ids            query  string  false  "Comma separated book IDs"
+// @Param        title          query  string  false  "Partial or full title"
+// @Param        isbn           query  string  false  "ISBN"
+// @Param        subject        query  string  false  "Subject"
+// @Param        authorid       query  int     false  "Author ID"
+// @Param        publishedfrom  query  string  false  "Published on or after this date (2006-01-02)"
+// @Param        publishedto    query  string  false  "Published on or before this date (2006-01-02)"
 // @Success      200  {object}  any
+// @Failure      400  {object}  any
 // @Failure      500  {object}  any
 // @Router       /api/book [get]
 func GetAllBooks(c *fiber.Ctx) error {
 	ensureDB()
 
+	query, err := filterBooks(c, db.Preload("Author"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
 	var Books []models.Book
-	if err := db.Preload("Author").Find(&Books).Error; err != nil {
+	if err := query.Find(&Books).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to fetch books",
@@ -53,6 +138,8 @@ func GetAllBooks(c *fiber.Ctx) error {
 // @Tags         books
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        bookid  path  string  true  "Book ID"
 // @Success      200  {object}  models.Book
 // @Failure      400  {object}  any
@@ -85,6 +172,9 @@ func GetBookByID(c *fiber.Ctx) error {
 		})
 	}
 
+	// Opening a book makes it more popular in the autocomplete suggestions
+	search.RecordView(book.ID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"error": false,
 		"data":  book,
@@ -99,6 +189,8 @@ func GetBookByID(c *fiber.Ctx) error {
 // @Tags         books
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        book  body  CreateBookRequest  true  "Book data"
 // @Success      201  {object}  models.Book
 // @Failure      400  {object}  any
@@ -140,7 +232,7 @@ func CreateBook(c *fiber.Ctx) error {
 
 	// Check if ISBN already exists
 	var existingBook models.Book
-	if err := db.Where("isbn = ?", book.ISBN).First(&existingBook).Error; err == nil {
+	if isbnExists(db, book.ISBN) {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error":   true,
 			"message": "ISBN already exists",
@@ -178,11 +270,22 @@ func CreateBook(c *fiber.Ctx) error {
 		Title:         book.Title,
 		ISBN:          book.ISBN,
 		PublishedDate: book.PublishedDate,
+		Subject:       book.Subject,
 		AuthorID:      book.AuthorID,
 		Author:        author,
 	}
 
-	if err := db.Create(&NewBook).Error; err != nil {
+	// The book and its first version are saved together
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&NewBook).Error; err != nil {
+			return err
+		}
+		if _, err := history.Record(tx, history.Book(NewBook, history.ActionCreate, actor(c))); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionCreate, history.EntityBook, NewBook.ID, nil, NewBook)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to create book",
@@ -203,6 +306,8 @@ func CreateBook(c *fiber.Ctx) error {
 // @Tags         books
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        bookid  path  string  true  "Book ID"
 // @Param        book    body  CreateBookRequest  true  "Updated book data"
 // @Success      200  {object}  models.Book
@@ -268,8 +373,7 @@ func UpdateBook(c *fiber.Ctx) error {
 
 	// Check if ISBN already exists and is not the current book's ISBN
 	if updatedBook.ISBN != existingBook.ISBN {
-		var existingBookWithNewISBN models.Book
-		if err := db.Where("isbn = ?", updatedBook.ISBN).First(&existingBookWithNewISBN).Error; err == nil {
+		if isbnExists(db, updatedBook.ISBN) {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 				"error":   true,
 				"message": "ISBN already exists",
@@ -292,14 +396,28 @@ func UpdateBook(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update the book
+	// Update the book, the previous values are kept for the history
+	before := history.BookFields(existingBook)
+	previousBook := existingBook
 	existingBook.Title = updatedBook.Title
 	existingBook.ISBN = updatedBook.ISBN
 	existingBook.PublishedDate = updatedBook.PublishedDate
+	existingBook.Subject = updatedBook.Subject
 	existingBook.AuthorID = updatedBook.AuthorID
 	existingBook.Author = author
 
-	if err := db.Save(&existingBook).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingBook).Error; err != nil {
+			return err
+		}
+		entry := history.Book(existingBook, history.ActionUpdate, actor(c))
+		entry.Before = before
+		if _, err := history.Record(tx, entry); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionUpdate, history.EntityBook, existingBook.ID, previousBook, existingBook)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to update book",
@@ -316,14 +434,21 @@ func UpdateBook(c *fiber.Ctx) error {
 
 // DeleteBook godoc
 // @Summary      Delete a book
-// @Description  Permanently delete a book by its ID
+// @Description  Permanently delete a book by its ID, a book with returned loans is deleted with them once confirmed (428 returns the loans and the confirmation token)
+// @Description  and a checked out book is not deleted (409)
 // @Tags         books
 // @Accept       json
 // @Produce      json
-// @Param        bookid  path  string  true  "Book ID"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        bookid   path   string  true   "Book ID"
+// @Param        confirm  query  string  false  "Confirmation token returned with the dependencies"
+// @Param        force    query  bool    false  "Delete the dependencies without confirmation"
 // @Success      200  {object}  any
 // @Failure      400  {object}  any
 // @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      428  {object}  any
 // @Failure      500  {object}  any
 // @Router       /api/book/{bookid} [delete]
 func DeleteBook(c *fiber.Ctx) error {
@@ -356,7 +481,43 @@ func DeleteBook(c *fiber.Ctx) error {
 
 	// Delete() ==> already make the save operation, GORM will ignore the DeletedAt field and perform the operation as if the record is not soft-deleted
 	// db.Unscoped(): This tells GORM to bypass the soft delete functionality.
-	if err := db.Unscoped().Delete(&book).Error; err != nil {
+	// The history of the book is kept, its last version is the deleted book, and the audit log has its final snapshot
+	var deps trash.Dependencies
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The book is locked until it is deleted, so its loans and the confirmation token are checked on what is deleted
+		// (a checkout locks the book too, it waits or is seen as an active loan)
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, book.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "Book not found")
+			}
+			return err
+		}
+
+		var err error
+		if deps, err = trash.BookDependencies(tx, book); err != nil {
+			return err
+		}
+		if status, message := refuseHardDelete(c, deps); status != 0 {
+			return fiber.NewError(status, message)
+		}
+
+		if _, err := history.Record(tx, history.Book(book, history.ActionDelete, actor(c))); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionDelete, history.EntityBook, book.ID, book, nil); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&book).Error
+	})
+	var refused *fiber.Error
+	if errors.As(err, &refused) {
+		return c.Status(refused.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": refused.Message,
+			"data":    deps,
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to delete book",
@@ -366,6 +527,7 @@ func DeleteBook(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"error":   false,
 		"message": "Book deleted successfully",
+		"data":    deps,
 	})
 }
 
@@ -377,6 +539,8 @@ func DeleteBook(c *fiber.Ctx) error {
 // @Tags         books
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        bookid  path  string  true  "Book ID"
 // @Success      200  {object}  any
 // @Failure      400  {object}  any
@@ -409,7 +573,16 @@ func SoftDeleteBook(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := db.Delete(&book).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&book).Error; err != nil {
+			return err
+		}
+		if _, err := history.Record(tx, history.Book(book, history.ActionSoftDelete, actor(c))); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionSoftDelete, history.EntityBook, book.ID, book, nil)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
 			"message": "Failed to soft delete book",
@@ -430,6 +603,8 @@ func SoftDeleteBook(c *fiber.Ctx) error {
 // @Tags         books
 // @Accept       json
 // @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Param        title  path  string  true  "Book title"
 // @Success      200  {object}  any
 // @Failure      400  {object}  any
@@ -25,6 +25,23 @@ func TestGetAllBooks(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestGetAllBooksWithFilters(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book?title=Sample&authorid=1&publishedfrom=2023-01-01", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/book?publishedfrom=yesterday", nil)
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
 func TestGetBookByID(t *testing.T) {
 	app := SetupFiberApp()
 	db := config.GetDB()
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+
+	citation "github.com/Pyramakerz/Library_Management_System/PKG/Citation"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type BookReference struct {
+	BookID    uint   `json:"bookID"`
+	Reference string `json:"reference"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// CiteBooks godoc
+// @Summary      Cite books
+// @Description  Render the books matching the same filters as the listing as BibTeX, RIS or CSL-JSON,
+// @Description  or as a list of APA, MLA or Chicago references
+// @Tags         citations
+// @Produce      json,application/x-bibtex,application/x-research-info-systems,application/vnd.citationstyles.csl+json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        format         query  string  true   "bibtex, ris, csl-json, apa, mla or chicago"
+// @Param        ids            query  string  false  "Comma separated book IDs"
+// @Param        title          query  string  false  "Partial or full title"
+// @Param        isbn           query  string  false  "ISBN"
+// @Param        subject        query  string  false  "Subject"
+// @Param        authorid       query  int     false  "Author ID"
+// @Param        publishedfrom  query  string  false  "Published on or after this date (2006-01-02)"
+// @Param        publishedto    query  string  false  "Published on or before this date (2006-01-02)"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/cite [get]
+func CiteBooks(c *fiber.Ctx) error {
+	ensureDB()
+
+	query, err := filterBooks(c, db.Preload("Author"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var books []models.Book
+	if err := query.Find(&books).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch books",
+		})
+	}
+
+	return writeCitation(c, c.Query("format"), books)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// CiteBook godoc
+// @Summary      Cite a book
+// @Description  Render a specific book by its ID as BibTeX, RIS or CSL-JSON, or as an APA, MLA or Chicago reference
+// @Tags         citations
+// @Produce      json,application/x-bibtex,application/x-research-info-systems,application/vnd.citationstyles.csl+json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        bookid  path   string  true  "Book ID"
+// @Param        format  query  string  true  "bibtex, ris, csl-json, apa, mla or chicago"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/{bookid}/cite [get]
+func CiteBook(c *fiber.Ctx) error {
+	ensureDB()
+
+	id := c.Params("bookid")
+
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter Book ID",
+		})
+	}
+
+	var book models.Book
+	if err := db.Preload("Author").First(&book, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Book not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get Book",
+		})
+	}
+
+	return writeCitation(c, c.Query("format"), []models.Book{book})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func writeCitation(c *fiber.Ctx, format string, books []models.Book) error {
+	if citation.IsStyle(format) {
+		references := make([]BookReference, 0, len(books))
+		for _, book := range books {
+			reference, _ := citation.Reference(format, book)
+			references = append(references, BookReference{BookID: book.ID, Reference: reference})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"error": false,
+			"data":  references,
+		})
+	}
+
+	contentType, ok := citation.ContentTypes[format]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Format must be bibtex, ris, csl-json, apa, mla or chicago",
+		})
+	}
+
+	out, err := citation.Render(format, books)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to render citations",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Status(fiber.StatusOK).Send(out)
+}
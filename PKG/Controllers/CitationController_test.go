@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCiteBook(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Sample Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	for _, format := range []string{"bibtex", "ris", "csl-json", "apa"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/book/1/cite?format="+format, nil)
+		resp, _ := app.Test(req, -1)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestCiteBooksInvalidFormat(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/cite?format=harvard", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,420 @@
+package controllers
+
+import (
+	"errors"
+	"sort"
+
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entity type of the email templates in the audit log
+const entityEmailTemplate = "template"
+
+// Subject and Text are Go text templates and HTML a Go HTML template, the emails are plain text without HTML
+type EmailTemplateRequest struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAllEmailTemplates godoc
+// @Summary      Get all email templates
+// @Description  Get every template in every language, custom is true for the templates saved in the database (they replace the built-in ones)
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/template [get]
+func GetAllEmailTemplates(c *fiber.Ctx) error {
+	ensureDB()
+
+	var stored []models.EmailTemplate
+	if err := db.Order("name, language").Find(&stored).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch email templates",
+		})
+	}
+	custom := map[string]models.EmailTemplate{}
+	for _, t := range stored {
+		custom[t.Name+"|"+t.Language] = t
+	}
+
+	templates := []fiber.Map{}
+	for _, name := range notify.Names {
+		languages := []string{}
+		for language := range notify.Templates[name] {
+			if _, ok := custom[name+"|"+language]; !ok {
+				languages = append(languages, language)
+			}
+		}
+		for _, t := range stored {
+			if t.Name == name {
+				languages = append(languages, t.Language)
+			}
+		}
+		sort.Strings(languages)
+
+		for _, language := range languages {
+			t, ok := custom[name+"|"+language]
+			entry := fiber.Map{"name": name, "language": language, "custom": ok}
+			if ok {
+				entry["subject"], entry["updatedBy"], entry["updatedAt"] = t.Subject, t.UpdatedBy, t.UpdatedAt
+			} else {
+				entry["subject"] = notify.Templates[name][language].Subject
+			}
+			templates = append(templates, entry)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":           false,
+		"defaultLanguage": notify.DefaultLanguage(),
+		"data":            templates,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetEmailTemplate godoc
+// @Summary      Get an email template
+// @Description  Get the template sent in a language, resolvedLanguage is the language it falls back to when there is none in the language (base language, then default language). fields are the data the template can use
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        name      path  string  true  "Template name"
+// @Param        language  path  string  true  "Language tag, like en or pt-br"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/template/{name}/{language} [get]
+func GetEmailTemplate(c *fiber.Ctx) error {
+	ensureDB()
+
+	name, language, ferr := emailTemplateParams(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	t, resolved, err := notify.Resolve(notify.Stored(db), name, language)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get email template",
+		})
+	}
+	var stored models.EmailTemplate
+	custom := db.Where("name = ? AND language = ?", name, resolved).Limit(1).Find(&stored).RowsAffected > 0
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data": fiber.Map{
+			"name":             name,
+			"language":         language,
+			"resolvedLanguage": resolved,
+			"custom":           custom,
+			"subject":          t.Subject,
+			"text":             t.Text,
+			"html":             t.HTML,
+			"fields":           emailTemplateFields(name),
+		},
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// SaveEmailTemplate godoc
+// @Summary      Save an email template
+// @Description  Create or replace the template of a language, it is rendered with the sample data first so a syntax error or an unknown field is refused (400). html is optional, without it the emails are plain text
+// @Tags         notifications
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        name      path  string                true  "Template name"
+// @Param        language  path  string                true  "Language tag, like en or pt-br"
+// @Param        template  body  EmailTemplateRequest  true  "Subject, text and HTML"
+// @Success      200  {object}  models.EmailTemplate
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/template/{name}/{language} [put]
+func SaveEmailTemplate(c *fiber.Ctx) error {
+	ensureDB()
+
+	name, language, ferr := emailTemplateParams(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var req EmailTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+	if err := notify.Check(name, notify.Template(req)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid template: " + err.Error(),
+		})
+	}
+
+	var stored models.EmailTemplate
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("name = ? AND language = ?", name, language).First(&stored).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		action := history.ActionUpdate
+		var before any = stored
+		if stored.ID == 0 {
+			action, before = history.ActionCreate, nil
+		}
+		stored.Name, stored.Language = name, language
+		stored.Subject, stored.Text, stored.HTML = req.Subject, req.Text, req.HTML
+		stored.UpdatedBy = actor(c)
+		if err := tx.Save(&stored).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, action, entityEmailTemplate, stored.ID, before, stored)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to save email template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  stored,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// DeleteEmailTemplate godoc
+// @Summary      Delete an email template
+// @Description  Delete the template saved for a language, the built-in template (or the fallback language) is sent again
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        name      path  string  true  "Template name"
+// @Param        language  path  string  true  "Language tag, like en or pt-br"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/template/{name}/{language} [delete]
+func DeleteEmailTemplate(c *fiber.Ctx) error {
+	ensureDB()
+
+	name, language, ferr := emailTemplateParams(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var stored models.EmailTemplate
+	if err := db.Where("name = ? AND language = ?", name, language).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "There is no saved template for this language",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get email template",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&stored).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionDelete, entityEmailTemplate, stored.ID, stored, nil)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete email template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Email template deleted, the built-in template is used again",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// PreviewEmailTemplate godoc
+// @Summary      Preview an email template
+// @Description  Render the template sent in a language with sample data. format=html returns the HTML email to open in a browser and format=text the plain text one
+// @Tags         notifications
+// @Produce      json
+// @Produce      html
+// @Produce      plain
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        name      path   string  true   "Template name"
+// @Param        language  path   string  true   "Language tag, like en or pt-br"
+// @Param        format    query  string  false  "json (default), html or text"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/template/{name}/{language}/preview [get]
+func PreviewEmailTemplate(c *fiber.Ctx) error {
+	return previewEmailTemplate(c, nil)
+}
+
+// PreviewEmailTemplateDraft godoc
+// @Summary      Preview a draft email template
+// @Description  Render a template before it is saved with sample data, it answers 400 with the error when it can't be rendered
+// @Tags         notifications
+// @Accept       json
+// @Produce      json
+// @Produce      html
+// @Produce      plain
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        name      path   string                true   "Template name"
+// @Param        language  path   string                true   "Language tag, like en or pt-br"
+// @Param        format    query  string                false  "json (default), html or text"
+// @Param        template  body   EmailTemplateRequest  true   "Subject, text and HTML"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/template/{name}/{language}/preview [post]
+func PreviewEmailTemplateDraft(c *fiber.Ctx) error {
+	var req EmailTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+	draft := notify.Template(req)
+	return previewEmailTemplate(c, &draft)
+}
+
+// previewEmailTemplate renders the stored template, or draft when it is not nil
+func previewEmailTemplate(c *fiber.Ctx, draft *notify.Template) error {
+	ensureDB()
+
+	name, language, ferr := emailTemplateParams(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "html" && format != "text" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Format must be json, html or text",
+		})
+	}
+
+	if draft != nil {
+		if err := notify.Check(name, *draft); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid template: " + err.Error(),
+			})
+		}
+	}
+
+	msg, err := notify.Preview(notify.Stored(db), name, language, draft)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to render email template",
+		})
+	}
+
+	switch format {
+	case "html":
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Status(fiber.StatusOK).SendString(msg.HTML)
+	case "text":
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.Status(fiber.StatusOK).SendString(msg.Body)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data": fiber.Map{
+			"subject": msg.Subject,
+			"text":    msg.Body,
+			"html":    msg.HTML,
+		},
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// emailTemplateParams returns the template name and the normalized language of the path
+func emailTemplateParams(c *fiber.Ctx) (string, string, *fiber.Error) {
+	name := c.Params("name")
+	if _, ok := notify.Templates[name]; !ok {
+		return "", "", fiber.NewError(fiber.StatusNotFound, "Email template not found")
+	}
+	language, err := notify.NormalizeLanguage(c.Params("language"))
+	if err != nil || language == "" {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "Invalid language, use a tag like en or pt-br")
+	}
+	return name, language, nil
+}
+
+// emailTemplateFields returns the fields of the data of a template, the layout also gets Subject and Content
+func emailTemplateFields(name string) []string {
+	fields := []string{"Library"}
+	if name == notify.TemplateLayout {
+		fields = append(fields, "Subject", "Content")
+	}
+	for field := range notify.Samples[name] {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
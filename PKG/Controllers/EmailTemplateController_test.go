@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailTemplates(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	send := func(method, path string, body any) *http.Response {
+		var reader io.Reader
+		if body != nil {
+			raw, _ := json.Marshal(body)
+			reader = bytes.NewReader(raw)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Actor", "admin")
+		resp, _ := app.Test(req, -1)
+		return resp
+	}
+	type resolved struct {
+		Data struct {
+			ResolvedLanguage string   `json:"resolvedLanguage"`
+			Custom           bool     `json:"custom"`
+			Subject          string   `json:"subject"`
+			Fields           []string `json:"fields"`
+		} `json:"data"`
+	}
+	get := func(path string) resolved {
+		var result resolved
+		resp := send(http.MethodGet, path, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	result := get("/api/template/overdue/fr-ca")
+	assert.Equal(t, "en", result.Data.ResolvedLanguage)
+	assert.False(t, result.Data.Custom)
+	assert.Equal(t, []string{"Days", "DueAt", "Library", "Name", "Title"}, result.Data.Fields)
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/template/reminder/en", nil).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/api/template/overdue/not%20a%20language", nil).StatusCode)
+
+	// A field the notice doesn't have is refused
+	resp := send(http.MethodPut, "/api/template/overdue/fr", notify.Template{Subject: "En retard", Text: "{{.Fine}} €"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	french := notify.Template{
+		Subject: "« {{.Title}} » est en retard",
+		Text:    "Bonjour {{.Name}}, « {{.Title}} » a {{.Days}} jour(s) de retard.",
+		HTML:    "<p>Bonjour {{.Name}}, <strong>{{.Title}}</strong> a {{.Days}} jour(s) de retard.</p>",
+	}
+	resp = send(http.MethodPut, "/api/template/overdue/fr", french)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var stored models.EmailTemplate
+	db.Where("name = ? AND language = ?", notify.TemplateOverdue, "fr").First(&stored)
+	assert.Equal(t, "admin", stored.UpdatedBy)
+
+	result = get("/api/template/overdue/fr-ca")
+	assert.Equal(t, "fr", result.Data.ResolvedLanguage)
+	assert.True(t, result.Data.Custom)
+	assert.Equal(t, french.Subject, result.Data.Subject)
+
+	var logs int64
+	db.Model(&models.AuditLog{}).Where("entity_type = ? AND entity_id = ?", "template", stored.ID).Count(&logs)
+	assert.Equal(t, int64(1), logs)
+
+	// The preview renders the sample data in the layout
+	resp = send(http.MethodGet, "/api/template/overdue/fr/preview", nil)
+	var preview struct {
+		Data struct {
+			Subject string `json:"subject"`
+			Text    string `json:"text"`
+			HTML    string `json:"html"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&preview)
+	assert.Equal(t, "« The Pragmatic Programmer » est en retard", preview.Data.Subject)
+	assert.Contains(t, preview.Data.Text, "Bonjour Jane Doe, « The Pragmatic Programmer » a 3 jour(s) de retard.")
+	assert.Contains(t, preview.Data.HTML, "<!DOCTYPE html>")
+
+	resp = send(http.MethodGet, "/api/template/overdue/fr/preview?format=html", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fiber.MIMETextHTMLCharsetUTF8, resp.Header.Get("Content-Type"))
+	html, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(html), "<strong>The Pragmatic Programmer</strong>")
+
+	// A draft is previewed before it is saved, a layout can only use the fields of every notice
+	resp = send(http.MethodPost, "/api/template/layout/fr/preview?format=text", notify.Template{Text: "{{.Content}}\n{{.Library}} vous salue"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	text, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(text), "vous salue")
+	resp = send(http.MethodPost, "/api/template/layout/fr/preview", notify.Template{Text: "{{.Content}} {{.Title}}"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = send(http.MethodGet, "/api/template", nil)
+	var list struct {
+		Data []struct {
+			Name     string `json:"name"`
+			Language string `json:"language"`
+			Custom   bool   `json:"custom"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	assert.Len(t, list.Data, len(notify.Names)+1)
+
+	// Deleting the French template brings back the English one
+	assert.Equal(t, http.StatusOK, send(http.MethodDelete, "/api/template/overdue/fr", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/api/template/overdue/fr", nil).StatusCode)
+	assert.Equal(t, "en", get("/api/template/overdue/fr").Data.ResolvedLanguage)
+}
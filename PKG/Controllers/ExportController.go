@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// Books are read from the database by batches of this size so the whole catalog is never loaded in memory
+const exportBatchSize = 500
+
+// A CSV export that failed midway ends with a line made of this marker and exportErrorMessage
+const (
+	exportErrorMarker  = "#error"
+	exportErrorMessage = "Failed to export the books, the file is incomplete"
+)
+
+var exportHeader = []string{"id", "title", "isbn", "publishedDate", "subject", "authorID", "authorName", "authorEmail"}
+
+// ExportedBook is one line of the NDJSON export, DeletedAt is only sent for the soft deleted books.
+type ExportedBook struct {
+	models.Book
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ExportBooks godoc
+// @Summary      Export the catalog
+// @Description  Stream the books matching the same filters as the listing, with their authors, as CSV or NDJSON.
+// @Description  If the export fails midway the last CSV line is "#error,<message>" and the last NDJSON line {"error":true,"message":...}.
+// @Description  The XLSX workbook is built before the answer is sent, a failure then returns a 500.
+// @Tags         books
+// @Produce      text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        format          query  string  false  "csv (default), ndjson or xlsx"
+// @Param        includedeleted  query  bool    false  "Also export the soft deleted books (and authors)"
+// @Param        ids             query  string  false  "Comma separated book IDs"
+// @Param        title           query  string  false  "Partial or full title"
+// @Param        isbn            query  string  false  "ISBN"
+// @Param        subject         query  string  false  "Subject"
+// @Param        authorid        query  int     false  "Author ID"
+// @Param        publishedfrom   query  string  false  "Published on or after this date (2006-01-02)"
+// @Param        publishedto     query  string  false  "Published on or before this date (2006-01-02)"
+// @Success      200  {file}  file
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/export [get]
+func ExportBooks(c *fiber.Ctx) error {
+	ensureDB()
+
+	includeDeleted := c.QueryBool("includedeleted")
+
+	query := db.Preload("Author")
+	if includeDeleted {
+		// Unscoped() on the books and on the preloaded authors ==> the soft deleted rows are selected too
+		query = db.Unscoped().Preload("Author", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() })
+	}
+
+	query, err := filterBooks(c, query)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	header := exportHeader
+	if includeDeleted {
+		header = append(header[:len(header):len(header)], "deletedAt")
+	}
+
+	switch format := c.Query("format", "csv"); format {
+	case "csv":
+		// Attachment sets the type of the file extension, it is replaced after it
+		c.Attachment("books.csv")
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			writer := csv.NewWriter(w)
+			err := writer.Write(header)
+			if err == nil {
+				err = eachBookBatch(query, func(books []models.Book) error {
+					for _, book := range books {
+						if err := writer.Write(exportRow(book, includeDeleted)); err != nil {
+							return err
+						}
+					}
+					writer.Flush()
+					if err := writer.Error(); err != nil {
+						return err
+					}
+					return w.Flush()
+				})
+			}
+			if err != nil {
+				// The status is already sent, the last line tells the client the file is incomplete
+				writer.Write([]string{exportErrorMarker, exportErrorMessage})
+			}
+			writer.Flush()
+		})
+	case "ndjson":
+		c.Attachment("books.ndjson")
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			encoder := json.NewEncoder(w)
+			err := eachBookBatch(query, func(books []models.Book) error {
+				for _, book := range books {
+					exported := ExportedBook{Book: book}
+					if book.DeletedAt.Valid {
+						exported.DeletedAt = &book.DeletedAt.Time
+					}
+					if err := encoder.Encode(exported); err != nil {
+						return err
+					}
+				}
+				return w.Flush()
+			})
+			if err != nil {
+				// The status is already sent, the last line tells the client the file is incomplete
+				encoder.Encode(fiber.Map{"error": true, "message": exportErrorMessage})
+			}
+		})
+	case "xlsx":
+		// A workbook is a zip archive that can't be sent before it is complete, so it is built before
+		// answering (the excelize stream writer spills the rows to a temporary file once they get big)
+		// and a failure still gets an error status
+		f, err := exportWorkbook(query, header, includeDeleted)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": exportErrorMessage,
+			})
+		}
+
+		c.Attachment("books.xlsx")
+		c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer f.Close()
+			// A failing write leaves a truncated archive that no spreadsheet opens
+			if _, err := f.WriteTo(w); err == nil {
+				w.Flush()
+			}
+		})
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Format must be csv, ndjson or xlsx",
+		})
+	}
+
+	return nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func exportWorkbook(query *gorm.DB, header []string, includeDeleted bool) (*excelize.File, error) {
+	f := excelize.NewFile()
+
+	sheet, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	row := 1
+	addRow := func(values []string) error {
+		cells := make([]any, len(values))
+		for i, v := range values {
+			cells[i] = v
+		}
+		cell, err := excelize.CoordinatesToCellName(1, row)
+		if err != nil {
+			return err
+		}
+		row++
+		return sheet.SetRow(cell, cells)
+	}
+
+	err = addRow(header)
+	if err == nil {
+		err = eachBookBatch(query, func(books []models.Book) error {
+			for _, book := range books {
+				if err := addRow(exportRow(book, includeDeleted)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = sheet.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// eachBookBatch calls fn with the books of query, exportBatchSize books at a time ordered by ID.
+// The status code is already sent while streaming so a failing batch can only stop the export,
+// the CSV and NDJSON exports then end with an error line.
+func eachBookBatch(query *gorm.DB, fn func(books []models.Book) error) error {
+	var books []models.Book
+	return query.FindInBatches(&books, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		return fn(books)
+	}).Error
+}
+
+func exportRow(book models.Book, includeDeleted bool) []string {
+	row := []string{
+		strconv.FormatUint(uint64(book.ID), 10),
+		spreadsheetText(book.Title),
+		spreadsheetText(book.ISBN),
+		book.PublishedDate.Format("2006-01-02"),
+		spreadsheetText(book.Subject),
+		strconv.FormatUint(uint64(book.AuthorID), 10),
+		spreadsheetText(book.Author.Name),
+		spreadsheetText(book.Author.Email),
+	}
+
+	if includeDeleted {
+		deletedAt := ""
+		if book.DeletedAt.Valid {
+			deletedAt = book.DeletedAt.Time.Format(time.RFC3339)
+		}
+		row = append(row, deletedAt)
+	}
+
+	return row
+}
+
+// formulaPrefixes start the cells a spreadsheet runs as formulas (the tab and carriage return too, some spreadsheets skip them)
+const formulaPrefixes = "=+-@\t\r"
+
+// spreadsheetText prefixes with a quote the catalog text a spreadsheet would run as a formula, ex: =HYPERLINK(...).
+// The import removes the quote again.
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExportBooks(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Exported Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+	db.Delete(&book)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/export?format=csv&includedeleted=true", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get(fiber.HeaderContentType))
+	assert.True(t, strings.Contains(string(body), "Exported Book"))
+	assert.False(t, strings.Contains(string(body), exportErrorMarker))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/book/export?format=ndjson&includedeleted=true", nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get(fiber.HeaderContentType))
+}
+
+func TestExportBooksFormulas(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "@SUM(A1:A9)", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         `=HYPERLINK("http://evil.example","Click")`,
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		Subject:       "-2+3",
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/export?format=csv", nil)
+	resp, _ := app.Test(req, -1)
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, `'=HYPERLINK("http://evil.example","Click")`, rows[1][1])
+		assert.Equal(t, "'-2+3", rows[1][4])
+		assert.Equal(t, "'@SUM(A1:A9)", rows[1][6])
+	}
+}
+
+func TestExportBooksXLSX(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Exported Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/export?format=xlsx", nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", resp.Header.Get(fiber.HeaderContentType))
+
+	f, err := excelize.OpenReader(resp.Body)
+	if assert.NoError(t, err) {
+		defer f.Close()
+		rows, _ := f.GetRows("Sheet1")
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, exportHeader, rows[0])
+			assert.Equal(t, "Exported Book", rows[1][1])
+		}
+	}
+}
+
+func TestExportBooksInvalidFormat(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/export?format=pdf", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
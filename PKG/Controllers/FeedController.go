@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	feed "github.com/Pyramakerz/Library_Management_System/PKG/Feed"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Number of books in a feed when limit is not sent, and its upper bound
+const (
+	feedDefaultLimit = 50
+	feedMaxLimit     = 200
+)
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// NewAcquisitionsFeed godoc
+// @Summary      Feed of the new acquisitions
+// @Description  Atom (new.atom) or RSS (new.rss) feed of the most recently added books, optionally of an author or a subject
+// @Tags         feeds
+// @Produce      application/atom+xml,application/rss+xml
+// @Param        authorid  query  int     false  "Author ID"
+// @Param        subject   query  string  false  "Subject"
+// @Param        limit     query  int     false  "Number of books (50 by default, 200 max)"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /feeds/new.atom [get]
+// @Router       /feeds/new.rss [get]
+func NewAcquisitionsFeed(c *fiber.Ctx) error {
+	ensureDB()
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(feedDefaultLimit)))
+	if err != nil || limit < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Limit must be a positive number",
+		})
+	}
+	if limit > feedMaxLimit {
+		limit = feedMaxLimit
+	}
+
+	title := "New acquisitions"
+	query := db.Preload("Author").Order("books.created_at DESC, books.id DESC").Limit(limit)
+
+	// The filters are kept in the self link so the readers subscribe to the filtered feed
+	filters := url.Values{}
+	if authorID := c.Query("authorid"); authorID != "" {
+		var author models.Author
+		if err := db.First(&author, authorID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error":   true,
+					"message": "Author not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to get author",
+			})
+		}
+		title += " by " + author.Name
+		query = query.Where("books.author_id = ?", author.ID)
+		filters.Set("authorid", authorID)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		title += " in " + subject
+		query = query.Where("books.subject = ?", subject)
+		filters.Set("subject", subject)
+	}
+
+	var books []models.Book
+	if err := query.Find(&books).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch books",
+		})
+	}
+
+	self := c.BaseURL() + c.Path()
+	if len(filters) > 0 {
+		self += "?" + filters.Encode()
+	}
+
+	f := feed.Feed{
+		ID:      "urn:library:feed:new",
+		Title:   title,
+		Link:    c.BaseURL() + "/api/book",
+		Self:    self,
+		Updated: time.Now(),
+	}
+	if len(filters) > 0 {
+		f.ID = self
+	}
+	if len(books) > 0 {
+		f.Updated = books[0].CreatedAt
+	}
+
+	for _, book := range books {
+		f.Items = append(f.Items, feed.Item{
+			ID:        "urn:isbn:" + book.ISBN,
+			Title:     book.Title,
+			Link:      fmt.Sprintf("%s/api/book/%d", c.BaseURL(), book.ID),
+			Author:    book.Author.Name,
+			Category:  book.Subject,
+			Summary:   fmt.Sprintf("%s, published on %s", book.Title, book.PublishedDate.Format("2006-01-02")),
+			Published: book.CreatedAt,
+			Updated:   book.UpdatedAt,
+		})
+	}
+
+	var out []byte
+	if strings.HasSuffix(c.Path(), ".rss") {
+		c.Set(fiber.HeaderContentType, feed.RSSType+"; charset=utf-8")
+		out, err = feed.RSS(f)
+	} else {
+		c.Set(fiber.HeaderContentType, feed.AtomType+"; charset=utf-8")
+		out, err = feed.Atom(f, config.Getenv("FEED_AUTHOR", "Library Management System"))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to write the feed",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).Send(out)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAcquisitionsFeed(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Sample Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		Subject:       "Fiction",
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/feeds/new.atom?authorid=%d", author.ID), nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "<title>New acquisitions by John Doe</title>")
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds/new.rss?subject=Fiction", nil)
+	resp, _ = app.Test(req, -1)
+	body, _ = io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "<title>Sample Book</title>")
+}
+
+func TestNewAcquisitionsFeedUnknownAuthor(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/feeds/new.rss?authorid=999", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
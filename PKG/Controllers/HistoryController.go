@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// actor returns who makes the request for the history and the audit log, the user of the access token or the name of the API key
+// on the protected routes (the X-Actor header is only read when the route is not protected)
+func actor(c *fiber.Ctx) string {
+	if claims, ok := auth.User(c); ok {
+		return claims.Username
+	}
+	if key, ok := auth.APIKey(c); ok {
+		return "apikey:" + key.Name
+	}
+	if name := c.Get("X-Actor"); name != "" {
+		return name
+	}
+	return "anonymous"
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetBookHistory godoc
+// @Summary      Get the history of a book
+// @Description  Get every version of a book (also deleted) with who changed it, when and the changed fields, the oldest first
+// @Tags         books
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        bookid  path  string  true  "Book ID"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/{bookid}/history [get]
+func GetBookHistory(c *fiber.Ctx) error {
+	ensureDB()
+
+	return writeHistory(c, history.EntityBook, c.Params("bookid"), "Book")
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAuthorHistory godoc
+// @Summary      Get the history of an author
+// @Description  Get every version of an author (also deleted) with who changed it, when and the changed fields, the oldest first
+// @Tags         authors
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        authorid  path  string  true  "Author ID"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/author/{authorid}/history [get]
+func GetAuthorHistory(c *fiber.Ctx) error {
+	ensureDB()
+
+	return writeHistory(c, history.EntityAuthor, c.Params("authorid"), "Author")
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RevertBook godoc
+// @Summary      Revert a book to an earlier version
+// @Description  Set the fields of a book back to the ones of a version of its history, the revert is recorded as a new version
+// @Tags         books
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        bookid   path    string  true   "Book ID"
+// @Param        version  path    int     true   "Version to revert to"
+// @Success      200  {object}  models.Book
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/{bookid}/revert/{version} [post]
+func RevertBook(c *fiber.Ctx) error {
+	ensureDB()
+
+	var book models.Book
+	if err := db.First(&book, c.Params("bookid")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Book not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find book",
+		})
+	}
+
+	revision, ferr := findRevision(history.EntityBook, book.ID, c.Params("version"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var version CreateBookRequest
+	if err := json.Unmarshal(revision.Snapshot, &version); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to read the version",
+		})
+	}
+
+	// The same checks as UpdateBook, the ISBN or the author may have changed since this version
+	if version.ISBN != book.ISBN {
+		var existingBookWithISBN models.Book
+		if err := db.Where("isbn = ?", version.ISBN).First(&existingBookWithISBN).Error; err == nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   true,
+				"message": "ISBN already exists",
+			})
+		}
+	}
+
+	var author models.Author
+	if err := db.First(&author, version.AuthorID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   true,
+				"message": "Author of this version not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find author",
+		})
+	}
+
+	before := history.BookFields(book)
+	previousBook := book
+	book.Title = version.Title
+	book.ISBN = version.ISBN
+	book.PublishedDate = version.PublishedDate
+	book.Subject = version.Subject
+	book.AuthorID = version.AuthorID
+	book.Author = author
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&book).Error; err != nil {
+			return err
+		}
+		entry := history.Book(book, history.ActionRevert, actor(c))
+		entry.Before = before
+		entry.RevertedTo = revision.Version
+		if _, err := history.Record(tx, entry); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionRevert, history.EntityBook, book.ID, previousBook, book)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to revert book",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  book,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RevertAuthor godoc
+// @Summary      Revert an author to an earlier version
+// @Description  Set the fields of an author back to the ones of a version of its history, the revert is recorded as a new version
+// @Tags         authors
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        authorid  path    string  true   "Author ID"
+// @Param        version   path    int     true   "Version to revert to"
+// @Success      200  {object}  models.Author
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/author/{authorid}/revert/{version} [post]
+func RevertAuthor(c *fiber.Ctx) error {
+	ensureDB()
+
+	var author models.Author
+	if err := db.First(&author, c.Params("authorid")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Author not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find author",
+		})
+	}
+
+	revision, ferr := findRevision(history.EntityAuthor, author.ID, c.Params("version"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var version models.Author
+	if err := json.Unmarshal(revision.Snapshot, &version); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to read the version",
+		})
+	}
+
+	// The email may belong to another author since this version
+	var conflictingAuthorEmail models.Author
+	if err := db.Where("email = ? AND id <> ?", version.Email, author.ID).First(&conflictingAuthorEmail).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Email already exists",
+		})
+	}
+
+	before := history.AuthorFields(author)
+	previousAuthor := author
+	author.Name = version.Name
+	author.Email = version.Email
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&author).Error; err != nil {
+			return err
+		}
+		entry := history.Author(author, history.ActionRevert, actor(c))
+		entry.Before = before
+		entry.RevertedTo = revision.Version
+		if _, err := history.Record(tx, entry); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionRevert, history.EntityAuthor, author.ID, previousAuthor, author); err != nil {
+			return err
+		}
+		// A revert can change the email like an update, the author is told at both addresses
+		if previousAuthor.Email != author.Email {
+			return enqueueAuthorEmailChanged(tx, previousAuthor, author)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to revert author",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  author,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func writeHistory(c *fiber.Ctx, entityType, id, name string) error {
+	entityID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || entityID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter " + name + " ID",
+		})
+	}
+
+	revisions, err := history.Revisions(db, entityType, uint(entityID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the history",
+		})
+	}
+	if len(revisions) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": name + " has no history",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  revisions,
+	})
+}
+
+// findRevision returns a version of a record, the error has the status and message of the response.
+func findRevision(entityType string, entityID uint, version string) (models.Revision, *fiber.Error) {
+	var revision models.Revision
+
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return revision, fiber.NewError(fiber.StatusBadRequest, "Invalid version")
+	}
+
+	err = db.Where("entity_type = ? AND entity_id = ? AND version = ?", entityType, entityID, n).First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return revision, fiber.NewError(fiber.StatusNotFound, "Version not found")
+	} else if err != nil {
+		return revision, fiber.NewError(fiber.StatusInternalServerError, "Failed to find the version")
+	}
+	return revision, nil
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorHistoryAndRevert(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	body, _ := json.Marshal(models.Author{Name: "John Doe", Email: "john@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/api/author", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "librarian")
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var author models.Author
+	db.Where("email = ?", "john@example.com").First(&author)
+
+	// Renaming directly in the database is not recorded, the revert goes back to the snapshot of version 1
+	db.Model(&author).Update("name", "Jane Doe")
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/author/%d/revert/1", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/author/%d/history", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data []models.Revision `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	if assert.Len(t, result.Data, 2) {
+		assert.Equal(t, "create", result.Data[0].Action)
+		assert.Equal(t, "librarian", result.Data[0].Actor)
+		assert.Equal(t, "revert", result.Data[1].Action)
+		assert.Equal(t, "anonymous", result.Data[1].Actor)
+		assert.Equal(t, 1, result.Data[1].RevertedTo)
+		assert.JSONEq(t, `{"name":{"from":"Jane Doe","to":"John Doe"}}`, string(result.Data[1].Changes))
+	}
+
+	db.First(&author, author.ID)
+	assert.Equal(t, "John Doe", author.Name)
+}
+
+func TestRevertBookUnknownVersion(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Sample Book", ISBN: "1234567890", AuthorID: author.ID}
+	db.Create(&book)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/book/%d/revert/3", book.ID), nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/book/%d/history", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRevertAuthorEmail(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	body, _ := json.Marshal(models.Author{Name: "John Doe", Email: "john@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/api/author", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var author models.Author
+	db.Where("email = ?", "john@example.com").First(&author)
+	db.Model(&author).Update("email", "johnny@example.com")
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/author/%d/revert/1", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The revert moves the email back, both addresses are told like on an update
+	var messages []models.OutboxMessage
+	db.Find(&messages)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, notify.TemplateAuthorEmailChanged, messages[0].Template)
+		assert.Equal(t, "johnny@example.com,john@example.com", messages[0].Recipients)
+	}
+}
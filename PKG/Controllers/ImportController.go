@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	utils "github.com/Pyramakerz/Library_Management_System/PKG/Utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+type ImportedRecord struct {
+	Record int  `json:"record"`           // position of the record (or the row for spreadsheets) in the uploaded file, starting from 1
+	BookID uint `json:"bookID,omitempty"` // not sent by a dry run, the book is rolled back
+}
+
+type FailedRecord struct {
+	Record  int    `json:"record"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun   bool             `json:"dryRun"`
+	Imported []ImportedRecord `json:"imported"`
+	Failed   []FailedRecord   `json:"failed"`
+}
+
+// Book and author fields that can be filled from a spreadsheet column
+const (
+	columnTitle         = "title"
+	columnISBN          = "isbn"
+	columnPublishedDate = "publishedDate"
+	columnSubject       = "subject"
+	columnAuthorID      = "authorID"
+	columnAuthorName    = "authorName"
+	columnAuthorEmail   = "authorEmail"
+)
+
+// Headers recognized when no mapping is sent, they are compared lowercased without spaces, "_" and "-"
+var defaultColumnHeaders = map[string]string{
+	"title":         columnTitle,
+	"booktitle":     columnTitle,
+	"isbn":          columnISBN,
+	"publisheddate": columnPublishedDate,
+	"published":     columnPublishedDate,
+	"date":          columnPublishedDate,
+	"subject":       columnSubject,
+	"authorid":      columnAuthorID,
+	"author":        columnAuthorName,
+	"authorname":    columnAuthorName,
+	"authoremail":   columnAuthorEmail,
+	"email":         columnAuthorEmail,
+}
+
+// Spreadsheet dates are accepted in these layouts
+var importDateLayouts = []string{"2006-01-02", time.RFC3339, "1/2/2006", "01-02-06", "2006"}
+
+var errDryRun = errors.New("dry run")
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ImportBooks godoc
+// @Summary      Import books from a spreadsheet
+// @Description  Import books and their authors from a CSV or XLSX file having a header row, missing authors are created.
+// @Description  Columns are matched by header (title, isbn, publishedDate, subject, authorID, authorName, authorEmail) or by the sent mapping.
+// @Tags         books
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        file     formData  file    true   "CSV or XLSX file"
+// @Param        format   query     string  false  "csv or xlsx (detected from the file when empty)"
+// @Param        mapping  query     string  false  "JSON object field ==> header, ex: {\"title\":\"Book Name\",\"authorName\":\"Writer\"}"
+// @Param        dryRun   query     bool    false  "Validate the rows and return the report without saving anything"
+// @Success      200  {object}  ImportReport
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/import [post]
+func ImportBooks(c *fiber.Ctx) error {
+	ensureDB()
+
+	content, filename, err := readUpload(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = "csv"
+		// XLSX files are zip archives
+		if strings.EqualFold(filepath.Ext(filename), ".xlsx") || bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+			format = "xlsx"
+		}
+	}
+
+	var rows [][]string
+	switch format {
+	case "csv":
+		reader := csv.NewReader(bytes.NewReader(content))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err = reader.ReadAll()
+	case "xlsx":
+		rows, err = readXLSX(content)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Format must be csv or xlsx",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot read the " + format + " file: " + err.Error(),
+		})
+	}
+
+	if len(rows) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "The file has no header row",
+		})
+	}
+
+	mapping := map[string]string{}
+	if m := c.Query("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid mapping",
+			})
+		}
+	}
+
+	columns, err := mapColumns(rows[0], mapping)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	report := ImportReport{DryRun: c.QueryBool("dryRun"), Imported: []ImportedRecord{}, Failed: []FailedRecord{}}
+
+	// All the rows are imported in one transaction, each row in its own savepoint,
+	// so a dry run sees the rows before it (ex: two rows with the same ISBN) and is then rolled back.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, row := range rows[1:] {
+			position := i + 2
+
+			book, err := importRow(tx, c, row, columns)
+			if err != nil {
+				report.Failed = append(report.Failed, FailedRecord{Record: position, Message: err.Error()})
+				continue
+			}
+			imported := ImportedRecord{Record: position}
+			if !report.DryRun {
+				imported.BookID = book.ID
+			}
+			report.Imported = append(report.Imported, imported)
+		}
+
+		if report.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to import books",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  report,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// readUpload returns the "file" field of a multipart form, or the raw body when no file is sent.
+func readUpload(c *fiber.Ctx) ([]byte, string, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		if len(bytes.TrimSpace(c.Body())) == 0 {
+			return nil, "", errors.New("No file sent")
+		}
+		return c.Body(), "", nil
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, "", errors.New("Cannot read the uploaded file")
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, "", errors.New("Cannot read the uploaded file")
+	}
+	return content, file.Filename, nil
+}
+
+// readXLSX returns the rows of the first sheet.
+func readXLSX(content []byte) ([][]string, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("the workbook has no sheet")
+	}
+	return f.GetRows(sheets[0])
+}
+
+// mapColumns returns field ==> column index from the header row.
+func mapColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := map[string]int{}
+
+	for i, h := range header {
+		for field, mappedHeader := range mapping {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(mappedHeader)) {
+				columns[field] = i
+			}
+		}
+	}
+
+	for i, h := range header {
+		normalized := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(h)))
+		if field, ok := defaultColumnHeaders[normalized]; ok {
+			if _, mapped := columns[field]; !mapped {
+				columns[field] = i
+			}
+		}
+	}
+
+	for _, field := range []string{columnTitle, columnISBN, columnPublishedDate} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("No column for %s", field)
+		}
+	}
+	_, hasID := columns[columnAuthorID]
+	_, hasName := columns[columnAuthorName]
+	if !hasID && !hasName {
+		return nil, errors.New("No column for authorID or authorName")
+	}
+
+	return columns, nil
+}
+
+// importRow validates one spreadsheet row with the same rules as CreateBook and imports it.
+func importRow(tx *gorm.DB, c *fiber.Ctx, row []string, columns map[string]int) (models.Book, error) {
+	value := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		// The quote added by the export before the text starting like a formula is removed
+		v := strings.TrimSpace(row[i])
+		if len(v) > 1 && v[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(v[1])) {
+			return v[1:]
+		}
+		return v
+	}
+
+	if value(columnTitle) == "" {
+		return models.Book{}, errors.New("Title is required")
+	}
+
+	if value(columnISBN) == "" {
+		return models.Book{}, errors.New("ISBN is required")
+	}
+
+	if value(columnPublishedDate) == "" {
+		return models.Book{}, errors.New("Published date is required")
+	}
+	publishedDate, err := parseImportDate(value(columnPublishedDate))
+	if err != nil {
+		return models.Book{}, err
+	}
+
+	var authorID uint
+	if id := value(columnAuthorID); id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return models.Book{}, errors.New("Invalid author ID")
+		}
+		authorID = uint(n)
+	} else if value(columnAuthorName) == "" {
+		return models.Book{}, errors.New("Author is required")
+	}
+
+	book := models.Book{
+		Title:         value(columnTitle),
+		ISBN:          value(columnISBN),
+		PublishedDate: publishedDate,
+		Subject:       value(columnSubject),
+		AuthorID:      authorID,
+	}
+	return importBook(tx, c, book, value(columnAuthorName), value(columnAuthorEmail))
+}
+
+func parseImportDate(s string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid published date %q", s)
+}
+
+// importBook creates one imported book with the same rules as CreateBook in a savepoint of tx.
+// The author is the one with book.AuthorID when set, otherwise it is found by email (or name) and created when missing.
+func importBook(tx *gorm.DB, c *fiber.Ctx, book models.Book, authorName, authorEmail string) (models.Book, error) {
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		// Check if ISBN already exists
+		if isbnExists(tx, book.ISBN) {
+			return errors.New("ISBN already exists")
+		}
+
+		var author models.Author
+		if book.AuthorID != 0 {
+			if err := tx.First(&author, book.AuthorID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("Author not found")
+				}
+				return errors.New("Failed to find author")
+			}
+		} else {
+			var err error
+			if author, err = findOrCreateAuthor(tx, c, authorName, authorEmail); err != nil {
+				return err
+			}
+		}
+
+		book.AuthorID = author.ID
+		book.Author = author
+		if err := tx.Create(&book).Error; err != nil {
+			return errors.New("Failed to create book")
+		}
+		if _, err := history.Record(tx, history.Book(book, history.ActionCreate, actor(c))); err != nil {
+			return errors.New("Failed to record the book history")
+		}
+		if err := recordAudit(tx, c, history.ActionCreate, history.EntityBook, book.ID, nil, book); err != nil {
+			return errors.New("Failed to record the audit log")
+		}
+		return nil
+	})
+
+	return book, err
+}
+
+// findOrCreateAuthor returns the author having this email, or this name when no email is sent.
+// Catalog records have no email so a placeholder one is generated from the name for the new authors.
+func findOrCreateAuthor(tx *gorm.DB, c *fiber.Ctx, name, email string) (models.Author, error) {
+	var author models.Author
+
+	query := tx.Where("name = ?", name)
+	if email != "" {
+		query = tx.Where("email = ?", email)
+	}
+	if err := query.First(&author).Error; err == nil {
+		return author, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return author, errors.New("Failed to find author")
+	}
+
+	if name == "" {
+		return author, errors.New("Author name is required")
+	}
+
+	if email == "" {
+		// .invalid is a reserved domain so nothing can ever be sent to it
+		sum := sha1.Sum([]byte(strings.ToLower(name)))
+		email = fmt.Sprintf("author-%x@import.invalid", sum[:6])
+	}
+	if !utils.IsValidEmail(email) {
+		return author, errors.New("Invalid email format")
+	}
+
+	author = models.Author{Name: name, Email: email}
+	if err := tx.Create(&author).Error; err != nil {
+		return author, errors.New("Failed to create author")
+	}
+	if _, err := history.Record(tx, history.Author(author, history.ActionCreate, actor(c))); err != nil {
+		return author, errors.New("Failed to record the author history")
+	}
+	if err := recordAudit(tx, c, history.ActionCreate, history.EntityAuthor, author.ID, nil, author); err != nil {
+		return author, errors.New("Failed to record the audit log")
+	}
+	return author, nil
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUploadRequest(url, filename, content string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, url, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestImportBooks(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	csv := "Title,ISBN,Published Date,Author,Author Email\n" +
+		"New Book,0987654321,2023-01-01,Jane Doe,jane@example.com\n" +
+		"Same ISBN,0987654321,2023-01-01,Jane Doe,jane@example.com\n"
+
+	req := newUploadRequest("/api/book/import", "books.csv", csv)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestImportBooksDryRun(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	csv := "Book Name,ISBN,Date,Writer\nNew Book,0987654321,2023,Jane Doe\n"
+
+	mapping := url.QueryEscape(`{"title":"Book Name","authorName":"Writer"}`)
+	req := newUploadRequest("/api/book/import?dryRun=true&mapping="+mapping, "books.csv", csv)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The book was rolled back, its ID isn't reported
+	var result struct {
+		Data ImportReport `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if assert.Len(t, result.Data.Imported, 1) {
+		assert.Equal(t, ImportedRecord{Record: 2}, result.Data.Imported[0])
+	}
+	var count int64
+	db.Model(&models.Book{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestImportTrashedISBN(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "Jane Doe", Email: "jane@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Trashed Book", ISBN: "0987654321", AuthorID: author.ID}
+	db.Create(&book)
+	db.Delete(&book)
+
+	csv := "Title,ISBN,Published Date,Author\nNew Book,0987654321,2023-01-01,Jane Doe\n"
+	req := newUploadRequest("/api/book/import", "books.csv", csv)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data ImportReport `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Empty(t, result.Data.Imported)
+	if assert.Len(t, result.Data.Failed, 1) {
+		assert.Equal(t, "ISBN already exists", result.Data.Failed[0].Message)
+	}
+}
+
+func TestMapColumns(t *testing.T) {
+	columns, err := mapColumns([]string{"Book Name", "isbn", "Published_Date", "Author"}, map[string]string{"title": "book name"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, columns[columnTitle])
+	assert.Equal(t, 1, columns[columnISBN])
+	assert.Equal(t, 2, columns[columnPublishedDate])
+	assert.Equal(t, 3, columns[columnAuthorName])
+
+	_, err = mapColumns([]string{"title", "isbn", "publishedDate"}, nil)
+	assert.Error(t, err)
+}
+
+func TestParseImportDate(t *testing.T) {
+	for _, s := range []string{"2023-01-31", "1/31/2023", "2023-01-31T00:00:00Z", "2023"} {
+		date, err := parseImportDate(s)
+		assert.NoError(t, err)
+		assert.Equal(t, 2023, date.Year())
+	}
+
+	_, err := parseImportDate("yesterday")
+	assert.Error(t, err)
+}
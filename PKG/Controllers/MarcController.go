@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+
+	marc "github.com/Pyramakerz/Library_Management_System/PKG/Marc"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ImportMarc godoc
+// @Summary      Import MARC21 records
+// @Description  Import ISO 2709 or MARCXML bibliographic records as books (020 ==> ISBN, 100 ==> Author, 245 ==> Title, 264 ==> Published date, 650 ==> Subject), missing authors are created
+// @Tags         marc
+// @Accept       application/marc,application/marcxml+xml,multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        format  query     string  false  "marc or marcxml (detected from the content when empty)"
+// @Param        file    formData  file    false  "MARC file, the raw request body is used when not sent"
+// @Success      200  {object}  ImportReport
+// @Failure      400  {object}  any
+// @Router       /api/marc/import [post]
+func ImportMarc(c *fiber.Ctx) error {
+	ensureDB()
+
+	content, _, err := readUpload(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = "marc"
+		if bytes.HasPrefix(bytes.TrimSpace(content), []byte("<")) {
+			format = "marcxml"
+		}
+	}
+
+	var records []*marc.Record
+	var decodeErrs []error
+	switch format {
+	case "marc":
+		records, decodeErrs = marc.ReadISO2709(bytes.NewReader(content))
+	case "marcxml":
+		if records, err = marc.ReadMARCXML(bytes.NewReader(content)); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid MARCXML: " + err.Error(),
+			})
+		}
+		decodeErrs = make([]error, len(records))
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Format must be marc or marcxml",
+		})
+	}
+
+	report := ImportReport{Imported: []ImportedRecord{}, Failed: []FailedRecord{}}
+	for i, record := range records {
+		position := i + 1
+
+		if decodeErrs[i] != nil {
+			report.Failed = append(report.Failed, FailedRecord{Record: position, Message: decodeErrs[i].Error()})
+			continue
+		}
+
+		fields, err := marc.ToBook(record)
+		if err != nil {
+			report.Failed = append(report.Failed, FailedRecord{Record: position, Message: err.Error()})
+			continue
+		}
+
+		book := models.Book{
+			Title:         fields.Title,
+			ISBN:          fields.ISBN,
+			PublishedDate: fields.PublishedDate,
+			Subject:       fields.Subject,
+		}
+		book, err = importBook(db, c, book, fields.AuthorName, "")
+		if err != nil {
+			report.Failed = append(report.Failed, FailedRecord{Record: position, Message: err.Error()})
+			continue
+		}
+		report.Imported = append(report.Imported, ImportedRecord{Record: position, BookID: book.ID})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  report,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ExportMarc godoc
+// @Summary      Export books as MARC21
+// @Description  Export the books matching the same filters as the listing (all the books when no filter is sent) as ISO 2709 or MARCXML
+// @Tags         marc
+// @Produce      application/marc,application/marcxml+xml
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        format         query  string  false  "marc (default) or marcxml"
+// @Param        ids            query  string  false  "Comma separated book IDs"
+// @Param        title          query  string  false  "Partial or full title"
+// @Param        isbn           query  string  false  "ISBN"
+// @Param        subject        query  string  false  "Subject"
+// @Param        authorid       query  int     false  "Author ID"
+// @Param        publishedfrom  query  string  false  "Published on or after this date (2006-01-02)"
+// @Param        publishedto    query  string  false  "Published on or before this date (2006-01-02)"
+// @Success      200  {file}  file
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/marc/export [get]
+func ExportMarc(c *fiber.Ctx) error {
+	ensureDB()
+
+	query, err := filterBooks(c, db.Preload("Author"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var books []models.Book
+	if err := query.Find(&books).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch books",
+		})
+	}
+
+	return writeMarc(c, c.Query("format", "marc"), books)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ExportBookMarc godoc
+// @Summary      Export a book as MARC21
+// @Description  Export a specific book by its ID as ISO 2709 or MARCXML
+// @Tags         marc
+// @Produce      application/marc,application/marcxml+xml
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        bookid  path   string  true   "Book ID"
+// @Param        format  query  string  false  "marc (default) or marcxml"
+// @Success      200  {file}  file
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/{bookid}/marc [get]
+func ExportBookMarc(c *fiber.Ctx) error {
+	ensureDB()
+
+	id := c.Params("bookid")
+
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter Book ID",
+		})
+	}
+
+	var book models.Book
+	if err := db.Preload("Author").First(&book, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Book not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get Book",
+		})
+	}
+
+	return writeMarc(c, c.Query("format", "marc"), []models.Book{book})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func writeMarc(c *fiber.Ctx, format string, books []models.Book) error {
+	records := make([]*marc.Record, 0, len(books))
+	for _, book := range books {
+		records = append(records, marc.FromBook(book))
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "marc":
+		// Attachment sets the type of the file extension, it is replaced after it
+		c.Attachment("books.mrc")
+		c.Set(fiber.HeaderContentType, "application/marc")
+		err = marc.WriteISO2709(&buf, records...)
+	case "marcxml":
+		c.Attachment("books.xml")
+		c.Set(fiber.HeaderContentType, "application/marcxml+xml")
+		err = marc.WriteMARCXML(&buf, records...)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Format must be marc or marcxml",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to export books",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
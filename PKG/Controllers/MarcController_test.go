@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportMarc(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	body := `<collection xmlns="http://www.loc.gov/MARC21/slim">
+		<record>
+			<leader>00000cam a2200000 i 4500</leader>
+			<datafield tag="020" ind1=" " ind2=" "><subfield code="a">0261103342</subfield></datafield>
+			<datafield tag="100" ind1="1" ind2=" "><subfield code="a">Tolkien, J. R. R.</subfield></datafield>
+			<datafield tag="245" ind1="1" ind2="4"><subfield code="a">The hobbit</subfield></datafield>
+			<datafield tag="264" ind1=" " ind2="1"><subfield code="c">1937</subfield></datafield>
+		</record>
+	</collection>`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/marc/import", strings.NewReader(body))
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestExportBookMarc(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Sample Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/1/marc?format=marcxml", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/marcxml+xml", resp.Header.Get(fiber.HeaderContentType))
+	assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "books.xml")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/book/1/marc?format=marc", nil)
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/marc", resp.Header.Get(fiber.HeaderContentType))
+	assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "books.mrc")
+}
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	marc "github.com/Pyramakerz/Library_Management_System/PKG/Marc"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	oai "github.com/Pyramakerz/Library_Management_System/PKG/Oai"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Number of records (or headers) sent before a resumption token
+const oaiPageSize = 100
+
+// Arguments allowed for each verb, true ==> required
+var oaiVerbArguments = map[string]map[string]bool{
+	"Identify":            {},
+	"ListMetadataFormats": {"identifier": false},
+	"GetRecord":           {"identifier": true, "metadataPrefix": true},
+	"ListRecords":         {"metadataPrefix": true, "from": false, "until": false, "set": false, "resumptionToken": false},
+	"ListIdentifiers":     {"metadataPrefix": true, "from": false, "until": false, "set": false, "resumptionToken": false},
+	"ListSets":            {"resumptionToken": false},
+}
+
+// The datestamp of a book is the time it was soft deleted, or its last update
+const oaiDatestampColumn = "COALESCE(books.deleted_at, books.updated_at)"
+
+func oaiRepositoryIdentifier() string {
+	return config.Getenv("OAI_REPOSITORY_IDENTIFIER", "library.local")
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OaiPmh godoc
+// @Summary      OAI-PMH 2.0 provider
+// @Description  Metadata harvesting of the books as Dublin Core (oai_dc) or MARCXML (marc21), soft deleted books are reported as deleted records.
+// @Description  Verbs: Identify, ListMetadataFormats, GetRecord, ListRecords, ListIdentifiers (and ListSets that answers noSetHierarchy)
+// @Tags         oai-pmh
+// @Produce      xml
+// @Param        verb             query  string  true   "OAI-PMH verb"
+// @Param        identifier       query  string  false  "oai:{repository}:book/{id}"
+// @Param        metadataPrefix   query  string  false  "oai_dc or marc21"
+// @Param        from             query  string  false  "YYYY-MM-DD or YYYY-MM-DDThh:mm:ssZ"
+// @Param        until            query  string  false  "YYYY-MM-DD or YYYY-MM-DDThh:mm:ssZ"
+// @Param        resumptionToken  query  string  false  "Token of an incomplete list"
+// @Success      200  {object}  any
+// @Router       /oai [get]
+func OaiPmh(c *fiber.Ctx) error {
+	ensureDB()
+
+	// Arguments are sent in the query string (GET) or in an urlencoded form (POST)
+	args := map[string]string{}
+	repeated := false
+	collect := func(key, value []byte) {
+		if _, ok := args[string(key)]; ok {
+			repeated = true
+		}
+		args[string(key)] = string(value)
+	}
+	c.Context().QueryArgs().VisitAll(collect)
+	c.Context().PostArgs().VisitAll(collect)
+
+	baseURL := c.BaseURL() + "/oai"
+	verb := args["verb"]
+	delete(args, "verb")
+
+	allowed, ok := oaiVerbArguments[verb]
+	if !ok {
+		return writeOaiError(c, oai.NewResponse(oai.Request{BaseURL: baseURL}), oai.BadVerb, "Illegal or missing verb")
+	}
+
+	badArgument := func(message string) error {
+		return writeOaiError(c, oai.NewResponse(oai.Request{BaseURL: baseURL}), oai.BadArgument, message)
+	}
+
+	if repeated {
+		return badArgument("Repeated argument")
+	}
+	for key := range args {
+		if _, ok := allowed[key]; !ok {
+			return badArgument("Illegal argument " + key)
+		}
+	}
+
+	// resumptionToken is an exclusive argument
+	if _, ok := args["resumptionToken"]; ok && len(args) > 1 {
+		return badArgument("resumptionToken is an exclusive argument")
+	} else if !ok {
+		for key, required := range allowed {
+			if _, sent := args[key]; required && !sent {
+				return badArgument("Missing argument " + key)
+			}
+		}
+	}
+
+	response := oai.NewResponse(oai.Request{
+		Verb:            verb,
+		Identifier:      args["identifier"],
+		MetadataPrefix:  args["metadataPrefix"],
+		From:            args["from"],
+		Until:           args["until"],
+		Set:             args["set"],
+		ResumptionToken: args["resumptionToken"],
+		BaseURL:         baseURL,
+	})
+
+	switch verb {
+	case "Identify":
+		return oaiIdentify(c, response, baseURL)
+	case "ListMetadataFormats":
+		return oaiListMetadataFormats(c, response)
+	case "GetRecord":
+		return oaiGetRecord(c, response)
+	case "ListSets":
+		return writeOaiError(c, response, oai.NoSetHierarchy, "This repository does not support sets")
+	default:
+		return oaiList(c, response, verb)
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func oaiIdentify(c *fiber.Ctx, response *oai.Response, baseURL string) error {
+	// The earliest datestamp is the oldest update, a soft deleted book keeps its updated_at
+	earliest := time.Now()
+	var oldest models.Book
+	if err := db.Unscoped().Select("id", "updated_at").Where("updated_at IS NOT NULL").Order("updated_at").First(&oldest).Error; err == nil {
+		earliest = oldest.UpdatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get the earliest datestamp",
+		})
+	}
+
+	response.Identify = &oai.Identify{
+		RepositoryName:    config.Getenv("OAI_REPOSITORY_NAME", "Library Management System"),
+		BaseURL:           baseURL,
+		ProtocolVersion:   "2.0",
+		AdminEmail:        config.Getenv("OAI_ADMIN_EMAIL", "admin@library.local"),
+		EarliestDatestamp: earliest.UTC().Format(oai.DatestampLayout),
+		// Hard deleted books disappear without a trace so the deleted records are not kept persistently
+		DeletedRecord: "transient",
+		Granularity:   "YYYY-MM-DDThh:mm:ssZ",
+	}
+	return writeOai(c, response)
+}
+
+func oaiListMetadataFormats(c *fiber.Ctx, response *oai.Response) error {
+	if identifier := response.Request.Identifier; identifier != "" {
+		if _, err := findOaiBook(identifier); err != nil {
+			return writeOaiError(c, response, oai.IDDoesNotExist, "No book has the identifier "+identifier)
+		}
+	}
+
+	response.ListMetadataFormats = &oai.ListMetadataFormats{Formats: oai.MetadataFormats}
+	return writeOai(c, response)
+}
+
+func oaiGetRecord(c *fiber.Ctx, response *oai.Response) error {
+	prefix := response.Request.MetadataPrefix
+	if !isOaiPrefix(prefix) {
+		return writeOaiError(c, response, oai.CannotDisseminateFormat, "Unknown metadata format "+prefix)
+	}
+
+	book, err := findOaiBook(response.Request.Identifier)
+	if err != nil {
+		return writeOaiError(c, response, oai.IDDoesNotExist, "No book has the identifier "+response.Request.Identifier)
+	}
+
+	response.GetRecord = &oai.GetRecord{Record: oaiRecord(book, prefix)}
+	return writeOai(c, response)
+}
+
+// oaiList answers ListRecords and ListIdentifiers, oaiPageSize books at a time ordered by ID.
+func oaiList(c *fiber.Ctx, response *oai.Response, verb string) error {
+	token := oai.Token{
+		MetadataPrefix: response.Request.MetadataPrefix,
+		From:           response.Request.From,
+		Until:          response.Request.Until,
+	}
+
+	if response.Request.ResumptionToken != "" {
+		var err error
+		if token, err = oai.DecodeToken(response.Request.ResumptionToken); err != nil {
+			return writeOaiError(c, response, oai.BadResumptionToken, err.Error())
+		}
+	}
+
+	if response.Request.Set != "" {
+		return writeOaiError(c, response, oai.NoSetHierarchy, "This repository does not support sets")
+	}
+
+	if !isOaiPrefix(token.MetadataPrefix) {
+		return writeOaiError(c, response, oai.CannotDisseminateFormat, "Unknown metadata format "+token.MetadataPrefix)
+	}
+
+	query := db.Unscoped().Model(&models.Book{})
+
+	var from, until time.Time
+	var fromDay, untilDay bool
+	var err error
+	if token.From != "" {
+		if from, fromDay, err = oai.ParseDatestamp(token.From); err != nil {
+			return writeOaiError(c, response, oai.BadArgument, err.Error())
+		}
+		query = query.Where(oaiDatestampColumn+" >= ?", from)
+	}
+	if token.Until != "" {
+		if until, untilDay, err = oai.ParseDatestamp(token.Until); err != nil {
+			return writeOaiError(c, response, oai.BadArgument, err.Error())
+		}
+		if token.From != "" && (fromDay != untilDay || until.Before(from)) {
+			return writeOaiError(c, response, oai.BadArgument, "from and until must have the same granularity and from must be before until")
+		}
+		if untilDay {
+			// Include the whole last day
+			query = query.Where(oaiDatestampColumn+" < ?", until.AddDate(0, 0, 1))
+		} else {
+			query = query.Where(oaiDatestampColumn+" <= ?", until)
+		}
+	}
+
+	// A new session so the count and the page can both be run on the same conditions
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch books",
+		})
+	}
+
+	var books []models.Book
+	err = query.Preload("Author", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("books.id > ?", token.LastID).
+		Order("books.id").
+		Limit(oaiPageSize + 1).
+		Find(&books).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch books",
+		})
+	}
+
+	if len(books) == 0 {
+		if response.Request.ResumptionToken != "" {
+			return writeOaiError(c, response, oai.BadResumptionToken, "The list has changed since this token was issued")
+		}
+		return writeOaiError(c, response, oai.NoRecordsMatch, "No books match the arguments")
+	}
+
+	// One more book than the page size was selected to know if the list goes on
+	var resumptionToken *oai.ResumptionToken
+	if len(books) > oaiPageSize {
+		books = books[:oaiPageSize]
+		next := token
+		next.LastID = books[len(books)-1].ID
+		next.Cursor = token.Cursor + len(books)
+		resumptionToken = &oai.ResumptionToken{CompleteListSize: total, Cursor: token.Cursor, Value: next.Encode()}
+	} else if response.Request.ResumptionToken != "" {
+		// The last page of a list has an empty token
+		resumptionToken = &oai.ResumptionToken{CompleteListSize: total, Cursor: token.Cursor}
+	}
+
+	if verb == "ListIdentifiers" {
+		list := &oai.ListIdentifiers{ResumptionToken: resumptionToken}
+		for _, book := range books {
+			list.Headers = append(list.Headers, oaiHeader(book))
+		}
+		response.ListIdentifiers = list
+	} else {
+		list := &oai.ListRecords{ResumptionToken: resumptionToken}
+		for _, book := range books {
+			list.Records = append(list.Records, oaiRecord(book, token.MetadataPrefix))
+		}
+		response.ListRecords = list
+	}
+
+	return writeOai(c, response)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// findOaiBook returns the book (soft deleted or not) having this OAI identifier.
+func findOaiBook(identifier string) (models.Book, error) {
+	var book models.Book
+
+	id, err := oai.ParseIdentifier(oaiRepositoryIdentifier(), identifier)
+	if err != nil {
+		return book, err
+	}
+
+	err = db.Unscoped().Preload("Author", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).First(&book, id).Error
+	return book, err
+}
+
+func isOaiPrefix(prefix string) bool {
+	return prefix == oai.PrefixDC || prefix == oai.PrefixMARCXML
+}
+
+func oaiHeader(book models.Book) oai.Header {
+	header := oai.Header{
+		Identifier: oai.Identifier(oaiRepositoryIdentifier(), book.ID),
+		Datestamp:  book.UpdatedAt.UTC().Format(oai.DatestampLayout),
+	}
+	if book.DeletedAt.Valid {
+		header.Status = "deleted"
+		header.Datestamp = book.DeletedAt.Time.UTC().Format(oai.DatestampLayout)
+	}
+	return header
+}
+
+// oaiRecord returns the record of a book, the deleted records have no metadata.
+func oaiRecord(book models.Book, prefix string) oai.Record {
+	record := oai.Record{Header: oaiHeader(book)}
+	if book.DeletedAt.Valid {
+		return record
+	}
+
+	if prefix == oai.PrefixMARCXML {
+		record.Metadata = &oai.Metadata{Content: marc.ToXML(marc.FromBook(book))}
+	} else {
+		record.Metadata = &oai.Metadata{Content: oai.DublinCore(book)}
+	}
+	return record
+}
+
+func writeOaiError(c *fiber.Ctx, response *oai.Response, code, message string) error {
+	response.Errors = append(response.Errors, oai.Error{Code: code, Message: message})
+	return writeOai(c, response)
+}
+
+// writeOai sends the response, OAI-PMH errors are sent with a 200 status as required by the protocol.
+func writeOai(c *fiber.Ctx, response *oai.Response) error {
+	out, err := xml.Marshal(response)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to write the OAI-PMH response",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/xml; charset=utf-8")
+	return c.Status(fiber.StatusOK).Send(append([]byte(xml.Header), out...))
+}
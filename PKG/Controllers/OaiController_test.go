@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOaiIdentify(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/oai?verb=Identify", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "<protocolVersion>2.0</protocolVersion>")
+}
+
+func TestOaiListRecordsWithDeletedRecord(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Deleted Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+	db.Delete(&book)
+
+	req := httptest.NewRequest(http.MethodGet, "/oai?verb=ListRecords&metadataPrefix=oai_dc", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `<header status="deleted">`)
+}
+
+func TestOaiBadVerb(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/oai?verb=Harvest", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `<error code="badVerb">`)
+}
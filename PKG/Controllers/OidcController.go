@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	audit "github.com/Pyramakerz/Library_Management_System/PKG/Audit"
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	oidc "github.com/Pyramakerz/Library_Management_System/PKG/Oidc"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Actor of the users created by single sign-on in the audit log
+const oidcActor = "oidc"
+
+// How long the user has to log in at the identity provider
+const loginStateTTL = 10 * time.Minute
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OidcLogin godoc
+// @Summary      Log in with single sign-on
+// @Description  Redirect to the login page of the identity provider (OpenID Connect authorization code flow with PKCE), it comes back to /api/auth/oidc/callback
+// @Tags         auth
+// @Success      302
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Failure      502  {object}  any
+// @Router       /api/auth/oidc/login [get]
+func OidcLogin(c *fiber.Ctx) error {
+	ensureDB()
+
+	provider, ferr := oidcProvider()
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	now := time.Now()
+	login := models.LoginState{
+		State:        oidc.RandomString(),
+		Nonce:        oidc.RandomString(),
+		CodeVerifier: oidc.RandomString(),
+		ExpiresAt:    now.Add(loginStateTTL),
+	}
+
+	// The logins that never came back are removed with the next one
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", now).Delete(&models.LoginState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&login).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to start the login",
+		})
+	}
+
+	return c.Redirect(provider.AuthURL(login.State, login.Nonce, login.CodeVerifier), fiber.StatusFound)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OidcCallback godoc
+// @Summary      Finish a single sign-on login
+// @Description  The identity provider redirects here with a code, it is exchanged for the ID token of the user who gets an access and a refresh token.
+// @Description  The user is created on their first login and gets the role of their groups (OIDC_ROLE_MAPPING) on every login
+// @Tags         auth
+// @Produce      json
+// @Param        code   query  string  true  "Authorization code"
+// @Param        state  query  string  true  "State of the login"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Failure      502  {object}  any
+// @Router       /api/auth/oidc/callback [get]
+func OidcCallback(c *fiber.Ctx) error {
+	ensureDB()
+
+	provider, ferr := oidcProvider()
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "The identity provider refused the login: " + reason + " " + c.Query("error_description"),
+		})
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter code and state",
+		})
+	}
+
+	// A state is used once, a replayed callback finds nothing
+	var login models.LoginState
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ?", state).First(&login).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&login).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && time.Now().After(login.ExpiresAt)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Unknown or expired login, log in again",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find the login",
+		})
+	}
+
+	idToken, err := provider.Exchange(code, login.CodeVerifier)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "The identity provider refused the code",
+		})
+	}
+
+	identity, err := provider.Verify(idToken, login.Nonce, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid ID token",
+		})
+	}
+
+	var user models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var created bool
+		var err error
+		user, created, err = oidc.Provision(tx, identity)
+		if err != nil || !created {
+			return err
+		}
+		_, err = audit.Record(tx, audit.Entry{
+			Actor:      oidcActor,
+			Action:     history.ActionCreate,
+			EntityType: entityUser,
+			EntityID:   user.ID,
+			After:      user,
+			RequestID:  requestID(c),
+			IP:         c.IP(),
+		})
+		return err
+	})
+	if errors.Is(err, oidc.ErrUsernameTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Username already exists as a local user",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to provision the user",
+		})
+	}
+
+	if user.Disabled {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   true,
+			"message": "User is disabled",
+		})
+	}
+
+	tokens, err := auth.Issue(db, user, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to log in",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  tokens,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// oidcProvider returns the identity provider, the error has the status and message of the response.
+func oidcProvider() (*oidc.Provider, *fiber.Error) {
+	provider, err := oidc.Get()
+	if errors.Is(err, oidc.ErrNotConfigured) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Single sign-on is not configured")
+	} else if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadGateway, "Failed to reach the identity provider")
+	}
+	return provider, nil
+}
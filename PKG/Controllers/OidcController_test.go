@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	oidc "github.com/Pyramakerz/Library_Management_System/PKG/Oidc"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// startMockProvider serves a mock identity provider and configures the single sign-on with it
+func startMockProvider(t *testing.T, user oidc.MockUser) *oidc.MockProvider {
+	mock, err := oidc.NewMockProvider("", "library", user)
+	assert.NoError(t, err)
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	mock.Issuer = server.URL
+
+	t.Setenv("OIDC_ISSUER", server.URL)
+	t.Setenv("OIDC_CLIENT_ID", "library")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:9090/api/auth/oidc/callback")
+	t.Setenv("OIDC_ROLE_MAPPING", "lms-admins=admin,lms-staff=librarian")
+	return mock
+}
+
+// oidcCallbackPath goes through the login at the mock provider and returns the callback it redirects to
+func oidcCallbackPath(t *testing.T, app *fiber.App) string {
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil), -1)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return callback.RequestURI()
+}
+
+func TestOidcLogin(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	mock := startMockProvider(t, oidc.MockUser{Subject: "42", Username: "jdoe", Groups: []string{"lms-staff"}})
+
+	callback := oidcCallbackPath(t, app)
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, callback, nil), -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, decodeTokens(resp).AccessToken)
+
+	// The user is created on their first login with the role of their group
+	var user models.User
+	db.Preload("Role").Where("username = ?", "jdoe").First(&user)
+	assert.Equal(t, auth.RoleLibrarian, user.Role.Name)
+	assert.NotNil(t, user.ExternalID)
+
+	var log models.AuditLog
+	db.Where("entity_type = ? AND entity_id = ?", entityUser, user.ID).First(&log)
+	assert.Equal(t, oidcActor, log.Actor)
+
+	// The callback can't be replayed
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, callback, nil), -1)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The role follows the groups on the next login
+	mock.SetUser(oidc.MockUser{Subject: "42", Username: "jdoe", Groups: []string{"everyone"}})
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, oidcCallbackPath(t, app), nil), -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	assert.Equal(t, int64(1), users)
+	db.Preload("Role").First(&user, user.ID)
+	assert.Equal(t, auth.RoleMember, user.Role.Name)
+}
+
+func TestOidcLoginLocalUsername(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	startMockProvider(t, oidc.MockUser{Subject: "42", Username: "librarian", Groups: []string{"lms-admins"}})
+	createTestUser(t, "librarian", "correct horse")
+
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, oidcCallbackPath(t, app), nil), -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestOidcCallbackErrors(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	t.Setenv("OIDC_ISSUER", "")
+	resp, _ := app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil), -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	startMockProvider(t, oidc.MockUser{Subject: "42", Username: "jdoe"})
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?code=abc&state=unknown", nil), -1)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?error=access_denied", nil), -1)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Contains(t, result["message"], "access_denied")
+}
@@ -0,0 +1,456 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	oai "github.com/Pyramakerz/Library_Management_System/PKG/Oai"
+	opds "github.com/Pyramakerz/Library_Management_System/PKG/Opds"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Number of entries of an OPDS feed page
+const opdsPageSize = 50
+
+// The same handlers serve OPDS 1.2 (Atom) under /opds and OPDS 2.0 (JSON) under /opds2
+const (
+	opdsPath  = "/opds"
+	opds2Path = "/opds2"
+)
+
+func opdsCatalogName() string {
+	return config.Getenv("OPDS_CATALOG_NAME", "Library Management System")
+}
+
+// opdsBorrowURL is the public page where a patron borrows or reserves a book (the OPAC of the library),
+// {id} is replaced by the book ID and {isbn} by its ISBN. The API itself needs a token so it can't be linked,
+// without this setting the publications have no acquisition link.
+func opdsBorrowURL(book models.Book) string {
+	template := config.Getenv("OPDS_BORROW_URL", "")
+	if template == "" {
+		return ""
+	}
+	return strings.NewReplacer("{id}", strconv.FormatUint(uint64(book.ID), 10), "{isbn}", url.PathEscape(book.ISBN)).Replace(template)
+}
+
+// opdsRecordURL is the public OAI-PMH record of a book in Dublin Core, the publications link it as alternate
+// so they always have a link even without OPDS_BORROW_URL.
+func opdsRecordURL(c *fiber.Ctx, book models.Book) string {
+	args := url.Values{}
+	args.Set("verb", "GetRecord")
+	args.Set("identifier", oai.Identifier(oaiRepositoryIdentifier(), book.ID))
+	args.Set("metadataPrefix", "oai_dc")
+	return c.BaseURL() + "/oai?" + args.Encode()
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsRoot godoc
+// @Summary      OPDS catalog root
+// @Description  Navigation feed of the catalog: new arrivals, by author and by subject. /opds is OPDS 1.2 (Atom), /opds2 is OPDS 2.0 (JSON)
+// @Tags         opds
+// @Produce      xml,json
+// @Success      200  {object}  any
+// @Router       /opds [get]
+// @Router       /opds2 [get]
+func OpdsRoot(c *fiber.Ctx) error {
+	root := opdsRoot(c)
+
+	feed := opds.Feed{
+		ID:      "urn:library:opds",
+		Title:   opdsCatalogName(),
+		Updated: time.Now(),
+		Links:   opdsLinks(c, root, false),
+		Navigation: []opds.Navigation{
+			{ID: "urn:library:opds:new", Title: "New arrivals", Summary: "The books most recently added to the catalog", Href: root + "/new", Acquisition: true},
+			{ID: "urn:library:opds:authors", Title: "By author", Summary: "Browse the books by author", Href: root + "/authors"},
+			{ID: "urn:library:opds:subjects", Title: "By subject", Summary: "Browse the books by subject", Href: root + "/subjects"},
+		},
+	}
+
+	return writeOpds(c, feed)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsNewArrivals godoc
+// @Summary      OPDS new arrivals
+// @Description  Acquisition feed of the books, the most recently added first
+// @Tags         opds
+// @Produce      xml,json
+// @Param        page  query  int  false  "Page number, starting from 1"
+// @Success      200  {object}  any
+// @Failure      500  {object}  any
+// @Router       /opds/new [get]
+// @Router       /opds2/new [get]
+func OpdsNewArrivals(c *fiber.Ctx) error {
+	ensureDB()
+
+	return writeOpdsBooks(c, "urn:library:opds:new", "New arrivals", db.Order("books.created_at DESC, books.id DESC"))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsAuthors godoc
+// @Summary      OPDS authors
+// @Description  Navigation feed of the authors, each one links to the acquisition feed of their books
+// @Tags         opds
+// @Produce      xml,json
+// @Param        page  query  int  false  "Page number, starting from 1"
+// @Success      200  {object}  any
+// @Failure      500  {object}  any
+// @Router       /opds/authors [get]
+// @Router       /opds2/authors [get]
+func OpdsAuthors(c *fiber.Ctx) error {
+	ensureDB()
+
+	root := opdsRoot(c)
+	page := opdsPage(c)
+
+	var authors []models.Author
+	if err := db.Order("name").Offset((page - 1) * opdsPageSize).Limit(opdsPageSize + 1).Find(&authors).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch authors",
+		})
+	}
+
+	feed := opds.Feed{
+		ID:      "urn:library:opds:authors",
+		Title:   "By author",
+		Updated: time.Now(),
+		Links:   opdsPageLinks(c, root, page, len(authors) > opdsPageSize, false),
+	}
+
+	for i, author := range authors {
+		if i == opdsPageSize {
+			break
+		}
+		feed.Navigation = append(feed.Navigation, opds.Navigation{
+			ID:          fmt.Sprintf("urn:library:opds:author:%d", author.ID),
+			Title:       author.Name,
+			Summary:     "Books by " + author.Name,
+			Href:        fmt.Sprintf("%s/authors/%d", root, author.ID),
+			Acquisition: true,
+		})
+	}
+
+	return writeOpds(c, feed)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsAuthorBooks godoc
+// @Summary      OPDS books of an author
+// @Description  Acquisition feed of the books of an author
+// @Tags         opds
+// @Produce      xml,json
+// @Param        authorid  path   string  true   "Author ID"
+// @Param        page      query  int     false  "Page number, starting from 1"
+// @Success      200  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /opds/authors/{authorid} [get]
+// @Router       /opds2/authors/{authorid} [get]
+func OpdsAuthorBooks(c *fiber.Ctx) error {
+	ensureDB()
+
+	var author models.Author
+	if err := db.First(&author, c.Params("authorid")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "Author not found",
+		})
+	}
+
+	id := fmt.Sprintf("urn:library:opds:author:%d", author.ID)
+	return writeOpdsBooks(c, id, "Books by "+author.Name, db.Where("author_id = ?", author.ID).Order("title"))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsSubjects godoc
+// @Summary      OPDS subjects
+// @Description  Navigation feed of the subjects, each one links to the acquisition feed of its books
+// @Tags         opds
+// @Produce      xml,json
+// @Param        page  query  int  false  "Page number, starting from 1"
+// @Success      200  {object}  any
+// @Failure      500  {object}  any
+// @Router       /opds/subjects [get]
+// @Router       /opds2/subjects [get]
+func OpdsSubjects(c *fiber.Ctx) error {
+	ensureDB()
+
+	root := opdsRoot(c)
+	page := opdsPage(c)
+
+	var subjects []string
+	err := db.Model(&models.Book{}).
+		Where("subject <> ''").
+		Distinct("subject").
+		Order("subject").
+		Offset((page-1)*opdsPageSize).
+		Limit(opdsPageSize+1).
+		Pluck("subject", &subjects).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch subjects",
+		})
+	}
+
+	feed := opds.Feed{
+		ID:      "urn:library:opds:subjects",
+		Title:   "By subject",
+		Updated: time.Now(),
+		Links:   opdsPageLinks(c, root, page, len(subjects) > opdsPageSize, false),
+	}
+
+	for i, subject := range subjects {
+		if i == opdsPageSize {
+			break
+		}
+		feed.Navigation = append(feed.Navigation, opds.Navigation{
+			ID:          "urn:library:opds:subject:" + url.PathEscape(subject),
+			Title:       subject,
+			Summary:     "Books about " + subject,
+			Href:        root + "/subjects/" + url.PathEscape(subject),
+			Acquisition: true,
+		})
+	}
+
+	return writeOpds(c, feed)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsSubjectBooks godoc
+// @Summary      OPDS books of a subject
+// @Description  Acquisition feed of the books of a subject
+// @Tags         opds
+// @Produce      xml,json
+// @Param        subject  path   string  true   "Subject"
+// @Param        page     query  int     false  "Page number, starting from 1"
+// @Success      200  {object}  any
+// @Failure      500  {object}  any
+// @Router       /opds/subjects/{subject} [get]
+// @Router       /opds2/subjects/{subject} [get]
+func OpdsSubjectBooks(c *fiber.Ctx) error {
+	ensureDB()
+
+	subject, err := url.PathUnescape(c.Params("subject"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid subject",
+		})
+	}
+
+	id := "urn:library:opds:subject:" + url.PathEscape(subject)
+	return writeOpdsBooks(c, id, "Books about "+subject, db.Where("subject = ?", subject).Order("title"))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsSearch godoc
+// @Summary      OPDS search
+// @Description  Acquisition feed of the books having the searched terms in their title or author name
+// @Tags         opds
+// @Produce      xml,json
+// @Param        q      query  string  false  "Searched terms (OPDS 1.2)"
+// @Param        query  query  string  false  "Searched terms (OPDS 2.0)"
+// @Param        page   query  int     false  "Page number, starting from 1"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /opds/search [get]
+// @Router       /opds2/search [get]
+func OpdsSearch(c *fiber.Ctx) error {
+	ensureDB()
+
+	terms := strings.TrimSpace(c.Query("q", c.Query("query")))
+	if terms == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Search terms are required",
+		})
+	}
+
+	query := db.Joins("JOIN authors ON authors.id = books.author_id AND authors.deleted_at IS NULL").
+		Where("books.title LIKE ? ESCAPE '!' OR authors.name LIKE ? ESCAPE '!'", opdsContains(terms), opdsContains(terms)).
+		Order("books.title")
+
+	return writeOpdsBooks(c, "urn:library:opds:search:"+url.QueryEscape(terms), "Search: "+terms, query)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// OpdsOpenSearch godoc
+// @Summary      OpenSearch description
+// @Description  OpenSearch description of the OPDS 1.2 catalog search
+// @Tags         opds
+// @Produce      xml
+// @Success      200  {object}  any
+// @Router       /opds/opensearch.xml [get]
+func OpdsOpenSearch(c *fiber.Ctx) error {
+	out, err := opds.OpenSearch(opdsCatalogName(), c.BaseURL()+opdsPath+"/search?q={searchTerms}")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to write the OpenSearch description",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, opds.OpenSearchType)
+	return c.Status(fiber.StatusOK).Send(out)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// opdsContains returns the LIKE pattern of the text containing terms, the % and _ typed by the reader are searched literally.
+// The escape character is ! since MySQL and SQLite don't read a backslash the same way in ESCAPE.
+func opdsContains(terms string) string {
+	return "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(terms) + "%"
+}
+
+// opdsRoot returns the absolute URL of the catalog root of the requested OPDS version.
+func opdsRoot(c *fiber.Ctx) string {
+	if isOpds2(c) {
+		return c.BaseURL() + opds2Path
+	}
+	return c.BaseURL() + opdsPath
+}
+
+func isOpds2(c *fiber.Ctx) bool {
+	return c.Path() == opds2Path || strings.HasPrefix(c.Path(), opds2Path+"/")
+}
+
+func opdsPage(c *fiber.Ctx) int {
+	return max(c.QueryInt("page", 1), 1)
+}
+
+// opdsLinks returns the self, start and search links of a navigation or acquisition feed.
+func opdsLinks(c *fiber.Ctx, root string, acquisition bool) []opds.Link {
+	self := c.BaseURL() + c.OriginalURL()
+
+	if isOpds2(c) {
+		return []opds.Link{
+			{Rel: "self", Href: self, Type: opds.JSONType},
+			{Rel: "start", Href: root, Type: opds.JSONType},
+			{Rel: "search", Href: root + "/search{?query}", Type: opds.JSONType, Templated: true},
+		}
+	}
+
+	selfType := opds.NavigationType
+	if acquisition {
+		selfType = opds.AcquisitionType
+	}
+	return []opds.Link{
+		{Rel: "self", Href: self, Type: selfType},
+		{Rel: "start", Href: root, Type: opds.NavigationType},
+		{Rel: "search", Href: root + "/opensearch.xml", Type: opds.OpenSearchType},
+	}
+}
+
+// opdsPageLinks adds the previous and next links of a paged feed.
+func opdsPageLinks(c *fiber.Ctx, root string, page int, hasNext, acquisition bool) []opds.Link {
+	links := opdsLinks(c, root, acquisition)
+
+	linkType := opds.JSONType
+	if !isOpds2(c) {
+		linkType = links[0].Type
+	}
+
+	pageURL := func(p int) string {
+		args := url.Values{}
+		c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+			args.Set(string(key), string(value))
+		})
+		args.Set("page", fmt.Sprint(p))
+		return c.BaseURL() + c.Path() + "?" + args.Encode()
+	}
+
+	if page > 1 {
+		links = append(links, opds.Link{Rel: "previous", Href: pageURL(page - 1), Type: linkType})
+	}
+	if hasNext {
+		links = append(links, opds.Link{Rel: "next", Href: pageURL(page + 1), Type: linkType})
+	}
+	return links
+}
+
+// writeOpdsBooks sends one page of the books of query as an acquisition feed.
+func writeOpdsBooks(c *fiber.Ctx, id, title string, query *gorm.DB) error {
+	page := opdsPage(c)
+
+	var books []models.Book
+	if err := query.Preload("Author").Offset((page - 1) * opdsPageSize).Limit(opdsPageSize + 1).Find(&books).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch books",
+		})
+	}
+
+	// One more book than the page size was selected to know if there is a next page
+	hasNext := len(books) > opdsPageSize
+	if hasNext {
+		books = books[:opdsPageSize]
+	}
+
+	feed := opds.Feed{
+		ID:          id,
+		Title:       title,
+		Updated:     time.Now(),
+		Links:       opdsPageLinks(c, opdsRoot(c), page, hasNext, true),
+		Acquisition: true,
+	}
+
+	for _, book := range books {
+		feed.Publications = append(feed.Publications, opds.Publication{
+			ID:       "urn:isbn:" + book.ISBN,
+			Title:    book.Title,
+			Author:   book.Author.Name,
+			Subject:  book.Subject,
+			Issued:   book.PublishedDate,
+			Modified: book.UpdatedAt,
+			Href:     opdsBorrowURL(book),
+			Record:   opdsRecordURL(c, book),
+		})
+	}
+
+	return writeOpds(c, feed)
+}
+
+func writeOpds(c *fiber.Ctx, feed opds.Feed) error {
+	var out []byte
+	var err error
+	var contentType string
+
+	if isOpds2(c) {
+		out, err = opds.JSON(feed)
+		contentType = opds.JSONType
+	} else {
+		out, err = opds.Atom(feed, opdsCatalogName())
+		contentType = opds.NavigationType
+		if feed.Acquisition {
+			contentType = opds.AcquisitionType
+		}
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to write the OPDS feed",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Status(fiber.StatusOK).Send(out)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpdsFeeds(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Sample Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		Subject:       "Science fiction",
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	for _, url := range []string{
+		"/opds", "/opds/new", "/opds/authors", "/opds/authors/1", "/opds/subjects", "/opds/subjects/Science%20fiction",
+		"/opds/search?q=Sample", "/opds/opensearch.xml", "/opds2", "/opds2/new", "/opds2/search?query=Doe",
+	} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		resp, _ := app.Test(req, -1)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+}
+
+func TestOpdsBorrowLink(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{Title: "Sample Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+
+	// Not configured ==> no acquisition link, the API needs a token
+	req := httptest.NewRequest(http.MethodGet, "/opds/new", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+	assert.NotContains(t, string(body), "acquisition/borrow")
+
+	t.Setenv("OPDS_BORROW_URL", "https://opac.example.org/record/{id}?isbn={isbn}")
+
+	req = httptest.NewRequest(http.MethodGet, "/opds/new", nil)
+	resp, _ = app.Test(req, -1)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), fmt.Sprintf(`href="https://opac.example.org/record/%d?isbn=1234567890"`, book.ID))
+}
+
+func TestOpdsRecordLink(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{Title: "Sample Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+
+	// Without OPDS_BORROW_URL the publication still links its public record
+	req := httptest.NewRequest(http.MethodGet, "/opds2/new", nil)
+	resp, _ := app.Test(req, -1)
+	var feed struct {
+		Publications []struct {
+			Links []struct {
+				Rel  string `json:"rel"`
+				Href string `json:"href"`
+			} `json:"links"`
+		} `json:"publications"`
+	}
+	json.NewDecoder(resp.Body).Decode(&feed)
+	if assert.Len(t, feed.Publications, 1) && assert.Len(t, feed.Publications[0].Links, 1) {
+		assert.Equal(t, "alternate", feed.Publications[0].Links[0].Rel)
+		assert.Contains(t, feed.Publications[0].Links[0].Href, "/oai?")
+		assert.Contains(t, feed.Publications[0].Links[0].Href, fmt.Sprintf("book%%2F%d", book.ID))
+	}
+}
+
+func TestOpdsSearchWildcards(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	db.Create(&[]models.Book{
+		{Title: "100% Cotton", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID},
+		{Title: "100 Poems", ISBN: "1234567891", PublishedDate: time.Now(), AuthorID: author.ID},
+	})
+
+	// % and _ are searched as typed, not as LIKE wildcards
+	for terms, count := range map[string]int{"100%25": 1, "100": 2, "1_0": 0, "Doe": 2} {
+		req := httptest.NewRequest(http.MethodGet, "/opds2/search?query="+terms, nil)
+		resp, _ := app.Test(req, -1)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var feed struct {
+			Publications []any `json:"publications"`
+		}
+		json.NewDecoder(resp.Body).Decode(&feed)
+		assert.Len(t, feed.Publications, count, terms)
+	}
+}
+
+func TestOpdsSearchWithoutTerms(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/opds/search", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
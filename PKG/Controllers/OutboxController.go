@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entity type of the outbox messages in the audit log
+const entityOutboxMessage = "outbox"
+
+// Action of the audit log when a dead message is sent again
+const actionReplay = "replay"
+
+// Number of messages returned when limit is not sent, and its upper bound
+const (
+	outboxDefaultLimit = 100
+	outboxMaxLimit     = 1000
+)
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetOutboxMessages godoc
+// @Summary      Get the outbox
+// @Description  Get the notifications of the outbox, the newest first, with their attempts and the last error. status=dead lists the dead letters
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        status    query  string  false  "pending, sent or dead"
+// @Param        template  query  string  false  "Template of the message"
+// @Param        limit     query  int     false  "Number of messages (100 by default, 1000 max)"
+// @Param        offset    query  int     false  "Number of messages to skip"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/outbox [get]
+func GetOutboxMessages(c *fiber.Ctx) error {
+	ensureDB()
+
+	query := db.Model(&models.OutboxMessage{})
+
+	if status := c.Query("status"); status != "" {
+		if status != outbox.StatusPending && status != outbox.StatusSent && status != outbox.StatusDead {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Status must be pending, sent or dead",
+			})
+		}
+		query = query.Where("status = ?", status)
+	}
+	if template := c.Query("template"); template != "" {
+		query = query.Where("template = ?", template)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(outboxDefaultLimit)))
+	if err != nil || limit < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Limit must be a positive number",
+		})
+	}
+	if limit > outboxMaxLimit {
+		limit = outboxMaxLimit
+	}
+
+	offset, err := strconv.Atoi(c.Query("offset", "0"))
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Offset must be a positive number",
+		})
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the outbox",
+		})
+	}
+
+	var messages []models.OutboxMessage
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&messages).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the outbox",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"total": total,
+		"data":  messages,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetOutboxMessage godoc
+// @Summary      Get an outbox message
+// @Description  Get a notification of the outbox with its recipients, body and last error
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        messageid  path  string  true  "Message ID"
+// @Success      200  {object}  models.OutboxMessage
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/outbox/{messageid} [get]
+func GetOutboxMessage(c *fiber.Ctx) error {
+	ensureDB()
+
+	message, ferr := findOutboxMessage(c.Params("messageid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  message,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ReplayOutboxMessage godoc
+// @Summary      Replay a dead outbox message
+// @Description  Send a dead notification again, it gets all its attempts back and is sent by the next run of the worker
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        messageid  path  string  true  "Message ID"
+// @Success      200  {object}  models.OutboxMessage
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/outbox/{messageid}/replay [post]
+func ReplayOutboxMessage(c *fiber.Ctx) error {
+	ensureDB()
+
+	message, ferr := findOutboxMessage(c.Params("messageid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	previousMessage := message
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := outbox.Replay(tx, &message, time.Now()); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, actionReplay, entityOutboxMessage, message.ID, previousMessage, message)
+	})
+	if errors.Is(err, outbox.ErrNotDead) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Only the dead messages can be replayed, this one is " + message.Status,
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to replay the message",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  message,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ReplayDeadOutboxMessages godoc
+// @Summary      Replay every dead outbox message
+// @Description  Send every dead notification again, e.g. once the mail server is back. template replays only the messages of a template
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        template  query  string  false  "Template of the messages"
+// @Success      200  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/outbox/replay [post]
+func ReplayDeadOutboxMessages(c *fiber.Ctx) error {
+	ensureDB()
+
+	var replayed []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("status = ?", outbox.StatusDead)
+		if template := c.Query("template"); template != "" {
+			query = query.Where("template = ?", template)
+		}
+		var messages []models.OutboxMessage
+		if err := query.Order("id").Find(&messages).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, message := range messages {
+			previousMessage := message
+			if err := outbox.Replay(tx, &message, now); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, actionReplay, entityOutboxMessage, message.ID, previousMessage, message); err != nil {
+				return err
+			}
+			replayed = append(replayed, message.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to replay the messages",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":    false,
+		"replayed": len(replayed),
+		"data":     replayed,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// findOutboxMessage returns the message of an ID from the path
+func findOutboxMessage(id string) (models.OutboxMessage, *fiber.Error) {
+	var message models.OutboxMessage
+	if id == "" {
+		return message, fiber.NewError(fiber.StatusBadRequest, "Enter message ID")
+	}
+	if err := db.First(&message, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return message, fiber.NewError(fiber.StatusNotFound, "Message not found")
+		}
+		return message, fiber.NewError(fiber.StatusInternalServerError, "Failed to get message")
+	}
+	return message, nil
+}
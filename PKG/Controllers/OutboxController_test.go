@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// mailServer records the messages it is given, or fails while down is set
+type mailServer struct {
+	down bool
+	sent []notify.Message
+}
+
+func (m *mailServer) Send(msg notify.Message) error {
+	if m.down {
+		return errors.New("connection refused")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func enqueueEmailChange(t *testing.T, db *gorm.DB, to ...string) models.OutboxMessage {
+	message, err := outbox.Enqueue(db, notify.TemplateAuthorEmailChanged, "", to, map[string]any{
+		"Name": "John Doe", "PreviousEmail": "john@example.com", "Email": "johnny@example.com",
+	}, time.Now())
+	assert.NoError(t, err)
+	return message
+}
+
+func TestOutboxWorker(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	server := &mailServer{down: true}
+	settings := outbox.Config{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour}
+	message := enqueueEmailChange(t, db, "john@example.com", "johnny@example.com")
+	now := time.Now()
+
+	// Each failure pushes the next attempt back, twice as far as the previous one
+	processed, err := outbox.Process(db, server, settings, now)
+	assert.NoError(t, err)
+	assert.Equal(t, outbox.Processed{Retried: 1}, processed)
+	db.First(&message, message.ID)
+	assert.Equal(t, 1, message.Attempts)
+	assert.Equal(t, "connection refused", message.LastError)
+	assert.WithinDuration(t, now.Add(time.Minute), message.NextAttemptAt, time.Second)
+
+	processed, _ = outbox.Process(db, server, settings, now.Add(30*time.Second))
+	assert.Equal(t, outbox.Processed{}, processed)
+
+	// The delay runs from the failure, a little after the start of the run
+	now = message.NextAttemptAt
+	processed, _ = outbox.Process(db, server, settings, now)
+	assert.Equal(t, outbox.Processed{Retried: 1}, processed)
+	db.First(&message, message.ID)
+	assert.WithinDuration(t, now.Add(2*time.Minute), message.NextAttemptAt, time.Second)
+
+	now = message.NextAttemptAt
+	processed, _ = outbox.Process(db, server, settings, now)
+	assert.Equal(t, outbox.Processed{Dead: 1}, processed)
+	db.First(&message, message.ID)
+	assert.Equal(t, outbox.StatusDead, message.Status)
+	assert.Equal(t, 3, message.Attempts)
+
+	// A dead message is left alone until it is replayed
+	server.down = false
+	processed, _ = outbox.Process(db, server, settings, now.Add(24*time.Hour))
+	assert.Equal(t, outbox.Processed{}, processed)
+
+	assert.NoError(t, outbox.Replay(db, &message, now))
+	processed, _ = outbox.Process(db, server, settings, now)
+	assert.Equal(t, outbox.Processed{Sent: 1}, processed)
+	db.First(&message, message.ID)
+	assert.Equal(t, outbox.StatusSent, message.Status)
+	assert.NotNil(t, message.SentAt)
+	assert.Len(t, server.sent, 1)
+	assert.Equal(t, []string{"john@example.com", "johnny@example.com"}, server.sent[0].To)
+	assert.Equal(t, "Your email address was changed", server.sent[0].Subject)
+}
+
+// slowServer takes delay to answer, like a mail server close to its timeout
+type slowServer struct {
+	delay time.Duration
+}
+
+func (s slowServer) Send(notify.Message) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func TestOutboxSlowSend(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	settings := outbox.Config{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour}
+	first := enqueueEmailChange(t, db, "john@example.com")
+	second := enqueueEmailChange(t, db, "jane@example.com")
+	now := time.Now()
+
+	// The second message is sent after the first one, it is dated when it was sent and not when the run started
+	processed, err := outbox.Process(db, slowServer{delay: 200 * time.Millisecond}, settings, now)
+	assert.NoError(t, err)
+	assert.Equal(t, outbox.Processed{Sent: 2}, processed)
+	db.First(&first, first.ID)
+	db.First(&second, second.ID)
+	if assert.NotNil(t, first.SentAt) && assert.NotNil(t, second.SentAt) {
+		assert.GreaterOrEqual(t, second.SentAt.Sub(now), 400*time.Millisecond)
+	}
+}
+
+func TestOutboxRolledBack(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	db.Transaction(func(tx *gorm.DB) error {
+		enqueueEmailChange(t, tx, "john@example.com")
+		return errors.New("the change failed")
+	})
+
+	var count int64
+	db.Model(&models.OutboxMessage{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	_, err := outbox.Enqueue(db, notify.TemplateAuthorEmailChanged, "", nil, nil, time.Now())
+	assert.ErrorIs(t, err, notify.ErrNoRecipient)
+}
+
+func TestReplayOutboxMessages(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	dead := enqueueEmailChange(t, db, "john@example.com")
+	other := enqueueEmailChange(t, db, "jane@example.com")
+	pending := enqueueEmailChange(t, db, "mark@example.com")
+	db.Model(&models.OutboxMessage{}).Where("id IN ?", []uint{dead.ID, other.ID}).
+		Updates(map[string]any{"status": outbox.StatusDead, "attempts": 8, "last_error": "connection refused"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/outbox?status=dead", nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var list struct {
+		Total int64                  `json:"total"`
+		Data  []models.OutboxMessage `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	assert.Equal(t, int64(2), list.Total)
+	assert.Equal(t, other.ID, list.Data[0].ID)
+	assert.Equal(t, "connection refused", list.Data[0].LastError)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/outbox?status=lost", nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/outbox/%d", pending.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/outbox/999999", nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// A pending message is already retried
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/outbox/%d/replay", pending.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/outbox/%d/replay", dead.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	db.First(&dead, dead.ID)
+	assert.Equal(t, outbox.StatusPending, dead.Status)
+	assert.Equal(t, 0, dead.Attempts)
+
+	var logs int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND entity_type = ? AND entity_id = ?", "replay", "outbox", dead.ID).Count(&logs)
+	assert.Equal(t, int64(1), logs)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/outbox/replay", nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var replayed struct {
+		Replayed int    `json:"replayed"`
+		Data     []uint `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&replayed)
+	assert.Equal(t, 1, replayed.Replayed)
+	assert.Equal(t, []uint{other.ID}, replayed.Data)
+
+	var deadCount int64
+	db.Model(&models.OutboxMessage{}).Where("status = ?", outbox.StatusDead).Count(&deadCount)
+	assert.Equal(t, int64(0), deadCount)
+}
@@ -0,0 +1,475 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	circulation "github.com/Pyramakerz/Library_Management_System/PKG/Circulation"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	outbox "github.com/Pyramakerz/Library_Management_System/PKG/Outbox"
+	utils "github.com/Pyramakerz/Library_Management_System/PKG/Utils"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entity type of the patrons in the audit log, they have no history
+const entityPatron = "patron"
+
+// Patrons borrow the books at the self-checkout kiosks (SIP2), Pin is only written, the hash is stored
+type PatronRequest struct {
+	Barcode string `json:"barcode"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Pin     string `json:"pin"`
+	Blocked bool   `json:"blocked"`
+	// Language of the notices, like en or pt-br
+	Language string `json:"language"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAllPatrons godoc
+// @Summary      Get all patrons
+// @Description  Get a list of all patrons
+// @Tags         patrons
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/patron [get]
+func GetAllPatrons(c *fiber.Ctx) error {
+	ensureDB()
+
+	var patrons []models.Patron
+	if err := db.Find(&patrons).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch patrons",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  patrons,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetPatronByID godoc
+// @Summary      Get patron by ID
+// @Description  Get a specific patron by their ID
+// @Tags         patrons
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        patronid  path  string  true  "Patron ID"
+// @Success      200  {object}  models.Patron
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/patron/{patronid} [get]
+func GetPatronByID(c *fiber.Ctx) error {
+	ensureDB()
+
+	patron, ferr := findPatron(c.Params("patronid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  patron,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetPatronLoans godoc
+// @Summary      Get the loans of a patron
+// @Description  Get the loans of a patron, the current ones only unless all is true. A member can only get the loans of their own patron card
+// @Tags         patrons
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        patronid  path   string  true   "Patron ID"
+// @Param        all       query  bool    false  "Include the returned loans"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/patron/{patronid}/loans [get]
+func GetPatronLoans(c *fiber.Ctx) error {
+	ensureDB()
+
+	// A member only reads the loans of the patron card linked to their user, checked before the patron is looked up
+	if _, ok := auth.User(c); ok && !auth.Can(c, auth.PermPatronsRead) {
+		user, ferr := currentUser(c)
+		if ferr != nil {
+			return c.Status(ferr.Code).JSON(fiber.Map{
+				"error":   true,
+				"message": ferr.Message,
+			})
+		}
+		if user.PatronID == nil || strconv.FormatUint(uint64(*user.PatronID), 10) != c.Params("patronid") {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   true,
+				"message": "You can only read your own loans",
+			})
+		}
+	}
+
+	patron, ferr := findPatron(c.Params("patronid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	query := db.Preload("Book").Where("patron_id = ?", patron.ID)
+	if !c.QueryBool("all") {
+		query = query.Where("returned_at IS NULL")
+	}
+
+	var loans []models.Loan
+	if err := query.Order("checked_out_at DESC").Find(&loans).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch loans",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  loans,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// CreatePatron godoc
+// @Summary      Create a new patron
+// @Description  Create a new patron, the barcode is the card number scanned at the kiosks and the PIN is optional
+// @Tags         patrons
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        patron  body  PatronRequest  true  "Patron data"
+// @Success      201  {object}  models.Patron
+// @Failure      400  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/patron [post]
+func CreatePatron(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req PatronRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	patron := models.Patron{}
+	if err := applyPatronRequest(&patron, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var existingPatron models.Patron
+	if err := db.Unscoped().Where("barcode = ?", patron.Barcode).First(&existingPatron).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Barcode already exists",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&patron).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionCreate, entityPatron, patron.ID, nil, patron)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create patron",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"error": false,
+		"data":  patron,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// UpdatePatron godoc
+// @Summary      Update an existing patron
+// @Description  Update an existing patron's information, the PIN is kept when it is not sent. A change of name, email, PIN or block is notified to the patron
+// @Tags         patrons
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        patronid  path  string         true  "Patron ID"
+// @Param        patron    body  PatronRequest  true  "Updated patron data"
+// @Success      200  {object}  models.Patron
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/patron/{patronid} [put]
+func UpdatePatron(c *fiber.Ctx) error {
+	ensureDB()
+
+	patron, ferr := findPatron(c.Params("patronid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var req PatronRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	previousPatron := patron
+	if err := applyPatronRequest(&patron, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var conflictingPatron models.Patron
+	if err := db.Unscoped().Where("barcode = ? AND id <> ?", patron.Barcode, patron.ID).First(&conflictingPatron).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Barcode already exists",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&patron).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionUpdate, entityPatron, patron.ID, previousPatron, patron); err != nil {
+			return err
+		}
+		return enqueueAccountChanged(tx, previousPatron, patron)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update patron",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  patron,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// DeletePatron godoc
+// @Summary      Delete a patron
+// @Description  Soft delete a patron by their ID, their loans are kept
+// @Tags         patrons
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        patronid  path  string  true  "Patron ID"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/patron/{patronid} [delete]
+func DeletePatron(c *fiber.Ctx) error {
+	ensureDB()
+
+	patron, ferr := findPatron(c.Params("patronid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&patron).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionSoftDelete, entityPatron, patron.ID, patron, nil)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete patron",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Patron deleted successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// SyncPatrons godoc
+// @Summary      Sync the patrons from the directory
+// @Description  Create and update the patrons of the directory entries (LDAP_PATRON_FILTER) and expire the patrons whose entry is gone,
+// @Description  like the scheduled sync (LDAP_SYNC_INTERVAL_MINUTES)
+// @Tags         patrons
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Failure      502  {object}  any
+// @Router       /api/patron/sync [post]
+func SyncPatrons(c *fiber.Ctx) error {
+	ensureDB()
+
+	if !ldap.Settings().Enabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "The directory is not configured",
+		})
+	}
+
+	synced, err := ldap.Sync(db, time.Now())
+	if err != nil {
+		var ldapErr *goldap.Error
+		if errors.As(err, &ldapErr) || errors.Is(err, ldap.ErrNoEntries) {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error":   true,
+				"message": "Failed to sync the patrons: " + err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to sync the patrons",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  synced,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// findPatron returns the patron of an ID, the error has the status and message of the response.
+func findPatron(id string) (models.Patron, *fiber.Error) {
+	var patron models.Patron
+
+	if id == "" {
+		return patron, fiber.NewError(fiber.StatusBadRequest, "Enter Patron ID")
+	}
+
+	if err := db.First(&patron, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return patron, fiber.NewError(fiber.StatusNotFound, "Patron not found")
+		}
+		return patron, fiber.NewError(fiber.StatusInternalServerError, "Failed to get patron")
+	}
+	return patron, nil
+}
+
+// enqueueAccountChanged writes the notice of a change of name, email, PIN or block of a patron to the outbox in tx,
+// a new email is told at both addresses
+func enqueueAccountChanged(tx *gorm.DB, previous, patron models.Patron) error {
+	nameChanged := previous.Name != patron.Name
+	emailChanged := previous.Email != patron.Email
+	pinChanged := previous.PinHash != patron.PinHash
+	blockedChanged := previous.Blocked != patron.Blocked
+	if !nameChanged && !emailChanged && !pinChanged && !blockedChanged {
+		return nil
+	}
+
+	var to []string
+	for _, email := range []string{previous.Email, patron.Email} {
+		if email != "" && (len(to) == 0 || to[0] != email) {
+			to = append(to, email)
+		}
+	}
+	if len(to) == 0 {
+		return nil
+	}
+	_, err := outbox.Enqueue(tx, notify.TemplateAccountChanged, patron.Language, to, fiber.Map{
+		"Name":           patron.Name,
+		"Barcode":        patron.Barcode,
+		"NameChanged":    nameChanged,
+		"PreviousName":   previous.Name,
+		"EmailChanged":   emailChanged,
+		"PreviousEmail":  previous.Email,
+		"Email":          patron.Email,
+		"PinChanged":     pinChanged,
+		"BlockedChanged": blockedChanged,
+		"Blocked":        patron.Blocked,
+	}, time.Now())
+	return err
+}
+
+func applyPatronRequest(patron *models.Patron, req PatronRequest) error {
+	if req.Barcode == "" {
+		return errors.New("Barcode is required")
+	}
+	if req.Name == "" {
+		return errors.New("Name is required")
+	}
+	if req.Email != "" && !utils.IsValidEmail(req.Email) {
+		return errors.New("Invalid email format")
+	}
+	language, err := notify.NormalizeLanguage(req.Language)
+	if err != nil {
+		return errors.New("Invalid language, use a tag like en or pt-br")
+	}
+
+	patron.Barcode = req.Barcode
+	patron.Name = req.Name
+	patron.Email = req.Email
+	patron.Blocked = req.Blocked
+	patron.Language = language
+
+	if req.Pin != "" {
+		hash, err := circulation.HashPin(req.Pin)
+		if err != nil {
+			return errors.New("Invalid PIN")
+		}
+		patron.PinHash = hash
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	circulation "github.com/Pyramakerz/Library_Management_System/PKG/Circulation"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePatron(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	body, _ := json.Marshal(PatronRequest{Barcode: "P1001", Name: "Jane Doe", Pin: "4321"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/patron", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/patron", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestGetPatronLoans(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	patron := models.Patron{Barcode: "P1001", Name: "Jane Doe"}
+	db.Create(&patron)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/patron/%d/loans", patron.ID), nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/patron/999/loans", nil)
+	resp, _ = app.Test(req, -1)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestSyncPatrons(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	sync := func() (int, ldap.Synced) {
+		resp, _ := app.Test(httptest.NewRequest(http.MethodPost, "/api/patron/sync", nil), -1)
+		var result struct {
+			Data ldap.Synced `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result.Data
+	}
+
+	status, _ := sync()
+	assert.Equal(t, http.StatusNotFound, status)
+
+	jdoe, asmith := ldapPerson("jdoe", "John Doe", "L1001"), ldapPerson("asmith", "Alice Smith", "L1002")
+	asmith.Attributes["description"] = []string{"20300101000000Z"}
+	t.Setenv("LDAP_ATTR_EXPIRES", "description")
+	server := startMockLdap(t, jdoe, asmith)
+
+	status, synced := sync()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, ldap.Synced{Created: 2}, synced)
+
+	var patron models.Patron
+	assert.NoError(t, db.Where("barcode = ?", "L1002").First(&patron).Error)
+	assert.Equal(t, "Alice Smith", patron.Name)
+	assert.Equal(t, ldap.ExternalID("asmith"), *patron.ExternalID)
+	assert.Equal(t, 2030, patron.ExpiresAt.Year())
+
+	status, synced = sync()
+	assert.Equal(t, ldap.Synced{}, synced)
+
+	// A renamed entry updates its patron and a removed one expires
+	jdoe.Attributes["cn"] = []string{"John Smith"}
+	server.SetEntries(jdoe)
+	status, synced = sync()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, ldap.Synced{Updated: 1, Expired: 1}, synced)
+
+	db.First(&patron, patron.ID)
+	assert.True(t, circulation.Expired(patron, time.Now()))
+	_, err := circulation.Checkout(db, patron, models.Book{}, time.Now())
+	assert.ErrorIs(t, err, circulation.ErrPatronExpired)
+
+	// An empty result is a misconfiguration, nobody is expired
+	server.SetEntries()
+	status, _ = sync()
+	assert.Equal(t, http.StatusBadGateway, status)
+	var expired int64
+	db.Model(&models.Patron{}).Where("expires_at <= ?", time.Now()).Count(&expired)
+	assert.Equal(t, int64(1), expired)
+
+	// The patron comes back with the entry
+	server.SetEntries(jdoe, asmith)
+	status, synced = sync()
+	assert.Equal(t, ldap.Synced{Updated: 1}, synced)
+	db.First(&patron, patron.ID)
+	assert.False(t, circulation.Expired(patron, time.Now()))
+}
+
+func TestUpdatePatronNotifiesAccountChange(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	patron := models.Patron{Barcode: "P1001", Name: "Jane Doe", Email: "jane@example.com"}
+	db.Create(&patron)
+	update := func(req PatronRequest) *http.Response {
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/patron/%d", patron.ID), bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(httpReq, -1)
+		return resp
+	}
+
+	resp := update(PatronRequest{Barcode: "P1001", Name: "Jane Doe", Email: "jane@example.com", Language: "english please"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Setting the language alone doesn't notify
+	resp = update(PatronRequest{Barcode: "P1001", Name: "Jane Doe", Email: "jane@example.com", Language: "FR"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	db.First(&patron, patron.ID)
+	assert.Equal(t, "fr", patron.Language)
+	var count int64
+	db.Model(&models.OutboxMessage{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// A French template saved by the admins is used for the patron
+	db.Create(&models.EmailTemplate{Name: notify.TemplateAccountChanged, Language: "fr",
+		Subject: "Votre compte a été modifié", Text: "Bonjour {{.Name}}{{if .Blocked}}, votre compte est bloqué{{end}}"})
+
+	resp = update(PatronRequest{Barcode: "P1001", Name: "Jane Doe", Email: "jane.doe@example.com", Language: "fr", Blocked: true})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var message models.OutboxMessage
+	assert.NoError(t, db.First(&message).Error)
+	assert.Equal(t, notify.TemplateAccountChanged, message.Template)
+	assert.Equal(t, "jane@example.com,jane.doe@example.com", message.Recipients)
+	assert.Equal(t, "Votre compte a été modifié", message.Subject)
+	assert.Contains(t, message.Body, "Bonjour Jane Doe, votre compte est bloqué")
+	// The saved template has no HTML, the built-in layout doesn't add any
+	assert.Empty(t, message.HTML)
+}
+
+func TestLoanNotices(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	patron := models.Patron{Barcode: "P1001", Name: "Jane Doe", Email: "jane@example.com"}
+	db.Create(&patron)
+	noEmail := models.Patron{Barcode: "P1002", Name: "Mark Roe"}
+	db.Create(&noEmail)
+
+	now := time.Now()
+	loan := func(title string, patron models.Patron, dueAt time.Time) models.Loan {
+		book := models.Book{Title: title, ISBN: title, PublishedDate: now, AuthorID: author.ID}
+		db.Create(&book)
+		loan := models.Loan{BookID: book.ID, PatronID: patron.ID, CheckedOutAt: now.Add(-14 * 24 * time.Hour), DueAt: dueAt}
+		db.Create(&loan)
+		return loan
+	}
+	dueSoon := loan("Due Tomorrow", patron, now.Add(30*time.Hour))
+	loan("Due Next Week", patron, now.Add(7*24*time.Hour))
+	overdue := loan("Due Yesterday", patron, now.Add(-20*time.Hour))
+	loan("Unreachable", noEmail, now.Add(-20*time.Hour))
+
+	notices, err := circulation.SendNotices(db, now)
+	assert.NoError(t, err)
+	assert.Equal(t, circulation.Notices{DueSoon: 1, Overdue: 1}, notices)
+
+	var messages []models.OutboxMessage
+	db.Order("id").Find(&messages)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, notify.TemplateDueSoon, messages[0].Template)
+	assert.Equal(t, `"Due Tomorrow" is due on `+dueSoon.DueAt.Format("January 2"), messages[0].Subject)
+	assert.Contains(t, messages[0].Body, "in 2 day(s)")
+	assert.Contains(t, messages[0].HTML, "<strong>Due Tomorrow</strong>")
+	assert.Equal(t, notify.TemplateOverdue, messages[1].Template)
+	assert.Contains(t, messages[1].Body, "1 day(s) overdue")
+
+	// Each notice is sent once per due date
+	notices, _ = circulation.SendNotices(db, now.Add(time.Hour))
+	assert.Equal(t, circulation.Notices{}, notices)
+
+	var book models.Book
+	db.First(&book, overdue.BookID)
+	_, err = circulation.Renew(db, patron, book, now)
+	assert.NoError(t, err)
+	notices, _ = circulation.SendNotices(db, now.Add(13*24*time.Hour))
+	assert.Equal(t, circulation.Notices{DueSoon: 1, Overdue: 2}, notices)
+}
@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"errors"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entity type of the roles in the audit log
+const entityRole = "role"
+
+// Permissions are the names of the auth.Perm constants, they replace the ones of the role on update.
+// RequireTwoFactor makes the users of the role enroll in two-factor authentication before they can use their permissions.
+type RoleRequest struct {
+	Name             string   `json:"name"`
+	Permissions      []string `json:"permissions"`
+	RequireTwoFactor bool     `json:"requireTwoFactor"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAllRoles godoc
+// @Summary      Get all roles
+// @Description  Get the roles with their permissions, and the names of all the permissions
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/role [get]
+func GetAllRoles(c *fiber.Ctx) error {
+	ensureDB()
+
+	var roles []models.Role
+	if err := db.Preload("Permissions").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch roles",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":       false,
+		"data":        roles,
+		"permissions": auth.AllPermissions,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// CreateRole godoc
+// @Summary      Create a new role
+// @Description  Create a role with some of the permissions
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        role  body  RoleRequest  true  "Role data"
+// @Success      201  {object}  models.Role
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/role [post]
+func CreateRole(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	role := models.Role{}
+	if err := applyRoleRequest(&role, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var existingRole models.Role
+	if err := db.Where("name = ?", role.Name).First(&existingRole).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Role already exists",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionCreate, entityRole, role.ID, nil, role)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create role",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"error": false,
+		"data":  role,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// UpdateRole godoc
+// @Summary      Update an existing role
+// @Description  Rename a role or change its permissions and two-factor policy, the users having it get the changes on their next request
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        roleid  path  string       true  "Role ID"
+// @Param        role    body  RoleRequest  true  "Updated role data"
+// @Success      200  {object}  models.Role
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/role/{roleid} [put]
+func UpdateRole(c *fiber.Ctx) error {
+	ensureDB()
+
+	role, ferr := findRole(c.Params("roleid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	previousRole := role
+	if err := applyRoleRequest(&role, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	// The default roles are looked up by name (the first admin, the new users), they can't be renamed
+	if _, ok := auth.DefaultRoles[previousRole.Name]; ok && role.Name != previousRole.Name {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Default roles can't be renamed",
+		})
+	}
+
+	var conflictingRole models.Role
+	if err := db.Where("name = ? AND id <> ?", role.Name, role.ID).First(&conflictingRole).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Role already exists",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Replace(role.Permissions); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionUpdate, entityRole, role.ID, previousRole, role)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update role",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  role,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// DeleteRole godoc
+// @Summary      Delete a role
+// @Description  Delete a role no user has, the default roles can't be deleted
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        roleid  path  string  true  "Role ID"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/role/{roleid} [delete]
+func DeleteRole(c *fiber.Ctx) error {
+	ensureDB()
+
+	role, ferr := findRole(c.Params("roleid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	if _, ok := auth.DefaultRoles[role.Name]; ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Default roles can't be deleted",
+		})
+	}
+
+	var users int64
+	if err := db.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to count the users of the role",
+		})
+	}
+	if users > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Role is given to users",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(tx, c, history.ActionDelete, entityRole, role.ID, role, nil); err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete role",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Role deleted successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// findRole returns the role of an ID with its permissions, the error has the status and message of the response.
+func findRole(id string) (models.Role, *fiber.Error) {
+	var role models.Role
+
+	if id == "" {
+		return role, fiber.NewError(fiber.StatusBadRequest, "Enter Role ID")
+	}
+
+	if err := db.Preload("Permissions").First(&role, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return role, fiber.NewError(fiber.StatusNotFound, "Role not found")
+		}
+		return role, fiber.NewError(fiber.StatusInternalServerError, "Failed to get role")
+	}
+	return role, nil
+}
+
+func applyRoleRequest(role *models.Role, req RoleRequest) error {
+	if req.Name == "" {
+		return errors.New("Name is required")
+	}
+
+	var permissions []models.Permission
+	if len(req.Permissions) > 0 {
+		if err := db.Where("name IN ?", req.Permissions).Find(&permissions).Error; err != nil {
+			return errors.New("Failed to get permissions")
+		}
+	}
+	found := map[string]bool{}
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range req.Permissions {
+		if !found[name] {
+			return errors.New("Unknown permission " + name)
+		}
+	}
+
+	role.Name = req.Name
+	role.Permissions = permissions
+	role.RequireTwoFactor = req.RequireTwoFactor
+	return nil
+}
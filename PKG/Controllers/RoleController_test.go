@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// accessToken returns the token of a new user having a role
+func accessToken(t *testing.T, username, roleName string, patronID *uint) string {
+	user := createTestUser(t, username, "correct horse")
+
+	var role models.Role
+	config.GetDB().Where("name = ?", roleName).First(&role)
+	config.GetDB().Model(&user).Updates(map[string]any{"role_id": role.ID, "patron_id": patronID})
+
+	tokens, err := auth.Issue(config.GetDB(), user, time.Now())
+	assert.NoError(t, err)
+	return tokens.AccessToken
+}
+
+func requestAs(app *fiber.App, method, path, token string) *http.Response {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ := app.Test(req, -1)
+	return resp
+}
+
+// protectedApp has the routes behind the middlewares like in Library_Management_System_Routes
+func protectedApp() *fiber.App {
+	app := fiber.New()
+	app.Use("/api", auth.Middleware())
+	app.Post("/api/book", auth.Require(auth.PermCatalogWrite), CreateBook)
+	app.Delete("/api/book/:bookid", auth.Require(auth.PermCatalogDelete), DeleteBook)
+	app.Get("/api/patron/:patronid/loans", auth.RequireAny(auth.PermPatronsRead, auth.PermOwnLoansRead), GetPatronLoans)
+	app.Post("/api/auth/2fa/enroll", EnrollTwoFactor)
+	app.Post("/api/auth/2fa/confirm", ConfirmTwoFactor)
+	app.Delete("/api/auth/2fa", DisableTwoFactor)
+	return app
+}
+
+func TestRequirePermission(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	app := protectedApp()
+	member := accessToken(t, "member", auth.RoleMember, nil)
+	librarian := accessToken(t, "librarian", auth.RoleLibrarian, nil)
+	admin := accessToken(t, "admin", auth.RoleAdmin, nil)
+
+	resp := requestAs(app, http.MethodPost, "/api/book", member)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, true, result["error"])
+	assert.Equal(t, "Missing permission catalog:write", result["message"])
+
+	// The librarian gets to the handler which refuses the empty body
+	resp = requestAs(app, http.MethodPost, "/api/book", librarian)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = requestAs(app, http.MethodDelete, "/api/book/1", librarian)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = requestAs(app, http.MethodDelete, "/api/book/1", admin)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The change of a role applies to the tokens already issued
+	var role models.Role
+	db.Where("name = ?", auth.RoleLibrarian).First(&role)
+	var permission models.Permission
+	db.Where("name = ?", auth.PermCatalogDelete).First(&permission)
+	db.Model(&role).Association("Permissions").Append(&permission)
+
+	resp = requestAs(app, http.MethodDelete, "/api/book/1", librarian)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRequireDisabledUser(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	app := protectedApp()
+	token := accessToken(t, "librarian", auth.RoleLibrarian, nil)
+	db.Model(&models.User{}).Where("username = ?", "librarian").Update("disabled", true)
+
+	resp := requestAs(app, http.MethodPost, "/api/book", token)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestMemberOwnLoans(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	own := models.Patron{Barcode: "P1", Name: "Member"}
+	other := models.Patron{Barcode: "P2", Name: "Other"}
+	db.Create(&own)
+	db.Create(&other)
+
+	app := protectedApp()
+	member := accessToken(t, "member", auth.RoleMember, &own.ID)
+	librarian := accessToken(t, "librarian", auth.RoleLibrarian, nil)
+
+	resp := requestAs(app, http.MethodGet, "/api/patron/"+strconv.Itoa(int(own.ID))+"/loans", member)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = requestAs(app, http.MethodGet, "/api/patron/"+strconv.Itoa(int(other.ID))+"/loans", member)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = requestAs(app, http.MethodGet, "/api/patron/"+strconv.Itoa(int(other.ID))+"/loans", librarian)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestManageRoles(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	resp := postJSON(app, "/api/role", RoleRequest{Name: "auditor", Permissions: []string{"audit:everything"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = postJSON(app, "/api/role", RoleRequest{Name: "auditor", Permissions: []string{auth.PermAuditRead}})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var created struct {
+		Data models.Role `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	assert.Equal(t, 1, len(created.Data.Permissions))
+
+	resp = postJSON(app, "/api/role", RoleRequest{Name: "auditor"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// A user is created as a member unless a role is given
+	resp = postJSON(app, "/api/user", UserRequest{Username: "reader", Password: "correct horse"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = postJSON(app, "/api/user", UserRequest{Username: "auditor", Password: "correct horse", Role: "auditor"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var reader models.User
+	db.Preload("Role").Where("username = ?", "reader").First(&reader)
+	assert.Equal(t, auth.RoleMember, reader.Role.Name)
+
+	roleID := strconv.Itoa(int(created.Data.ID))
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, "/api/role/"+roleID, nil), -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, "/api/role/"+strconv.Itoa(int(*reader.RoleID)), nil), -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	db.Where("username = ?", "auditor").Delete(&models.User{})
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, "/api/role/"+roleID, nil), -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
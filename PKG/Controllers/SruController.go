@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"net"
+	"strconv"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	marc "github.com/Pyramakerz/Library_Management_System/PKG/Marc"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	sru "github.com/Pyramakerz/Library_Management_System/PKG/Sru"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Number of records returned when maximumRecords is not sent, and its upper bound
+const (
+	sruDefaultRecords = 10
+	sruMaxRecords     = 100
+)
+
+// Columns searched by each CQL index, the books are joined with their author
+var sruIndexColumns = map[string][]string{
+	"cql.serverchoice": {"books.title", "authors.name"},
+	"cql.anywhere":     {"books.title", "authors.name", "books.isbn", "books.subject"},
+	"title":            {"books.title"},
+	"dc.title":         {"books.title"},
+	"author":           {"authors.name"},
+	"creator":          {"authors.name"},
+	"dc.creator":       {"authors.name"},
+	"isbn":             {"books.isbn"},
+	"bath.isbn":        {"books.isbn"},
+	"dc.identifier":    {"books.isbn"},
+	"subject":          {"books.subject"},
+	"dc.subject":       {"books.subject"},
+}
+
+var sruIndexes = []sru.Index{
+	{Set: "dc", Name: "title", Title: "Title"},
+	{Set: "dc", Name: "creator", Title: "Author"},
+	{Set: "bath", Name: "isbn", Title: "ISBN"},
+	{Set: "dc", Name: "subject", Title: "Subject"},
+	{Set: "cql", Name: "serverChoice", Title: "Title or author"},
+	{Set: "cql", Name: "anywhere", Title: "Any field"},
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Sru godoc
+// @Summary      SRU 1.2 and 2.0 server
+// @Description  Search of the books with CQL queries, indexes: title (dc.title), author (dc.creator), isbn (bath.isbn), subject (dc.subject), cql.serverChoice (title or author).
+// @Description  Relations: =, ==, exact, any, all, adj, <> and the * and ? wildcards, booleans: and, or, not. Errors are returned as SRU diagnostics with a 200 status.
+// @Tags         sru
+// @Produce      xml
+// @Param        operation       query  string  false  "searchRetrieve or explain (searchRetrieve when a query is sent, explain otherwise)"
+// @Param        version         query  string  false  "1.2 or 2.0 (1.2 when operation is sent, 2.0 otherwise)"
+// @Param        query           query  string  false  "CQL query ==> title=hobbit and author=tolkien"
+// @Param        startRecord     query  int     false  "Position of the first record, starting at 1"
+// @Param        maximumRecords  query  int     false  "Number of records (10 by default, 100 max)"
+// @Param        recordSchema    query  string  false  "dc (default) or marcxml"
+// @Success      200  {object}  any
+// @Router       /sru [get]
+func Sru(c *fiber.Ctx) error {
+	ensureDB()
+
+	operation := c.Query("operation")
+	version := c.Query("version")
+	if version == "" {
+		// SRU 2.0 has no operation parameter
+		version = sru.Version20
+		if operation != "" {
+			version = sru.Version12
+		}
+	}
+	if version != sru.Version12 && version != sru.Version20 {
+		return writeSruDiagnostic(c, sru.Version12, operation, sru.NewDiagnostic(sru.DiagnosticUnsupportedVersion, version))
+	}
+
+	if operation == "" {
+		operation = "explain"
+		if c.Query("query") != "" {
+			operation = "searchRetrieve"
+		}
+	}
+
+	switch operation {
+	case "explain":
+		return sruExplain(c, version)
+	case "searchRetrieve":
+		return sruSearchRetrieve(c, version)
+	}
+	return writeSruDiagnostic(c, version, "searchRetrieve", sru.NewDiagnostic(sru.DiagnosticUnsupportedOperation, operation))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func sruExplain(c *fiber.Ctx, version string) error {
+	response := sru.NewExplainResponse(version)
+
+	// Hostname keeps the port of the Host header
+	host, port, err := net.SplitHostPort(c.Hostname())
+	if err != nil {
+		host, port = c.Hostname(), "80"
+		if c.Protocol() == "https" {
+			port = "443"
+		}
+	}
+
+	explain := sru.Explain(version, host, port, "sru", config.Getenv("SRU_DATABASE_TITLE", "Library Management System"), sruIndexes, sruDefaultRecords, sruMaxRecords)
+	record := sru.NewRecord(version, sru.SchemaDC, 0, explain)
+	record.RecordSchema = sru.ExplainSchema
+	response.Record = &record
+
+	return writeSru(c, response)
+}
+
+func sruSearchRetrieve(c *fiber.Ctx, version string) error {
+	response := sru.NewSearchRetrieveResponse(version)
+	fail := func(err error) error {
+		response.Records = nil
+		response.Diagnostics = sru.NewDiagnostics(version, err)
+		return writeSru(c, response)
+	}
+
+	query := c.Query("query")
+	if query == "" {
+		return fail(sru.NewDiagnostic(sru.DiagnosticMandatoryParameter, "query"))
+	}
+
+	schema, ok := sruSchema(c.Query("recordSchema"))
+	if !ok {
+		return fail(sru.NewDiagnostic(sru.DiagnosticUnknownSchema, c.Query("recordSchema")))
+	}
+
+	// Only the records sent as XML are supported
+	packing := c.Query("recordPacking", "xml")
+	if version == sru.Version20 {
+		packing = c.Query("recordXMLEscaping", "xml")
+	}
+	if packing != "xml" {
+		return fail(sru.NewDiagnostic(sru.DiagnosticUnsupportedParameterValue, packing))
+	}
+
+	start, err := strconv.Atoi(c.Query("startRecord", "1"))
+	if err != nil || start < 1 {
+		return fail(sru.NewDiagnostic(sru.DiagnosticUnsupportedParameterValue, "startRecord"))
+	}
+	limit, err := strconv.Atoi(c.Query("maximumRecords", strconv.Itoa(sruDefaultRecords)))
+	if err != nil || limit < 0 {
+		return fail(sru.NewDiagnostic(sru.DiagnosticUnsupportedParameterValue, "maximumRecords"))
+	}
+	if limit > sruMaxRecords {
+		limit = sruMaxRecords
+	}
+
+	node, err := sru.ParseCQL(query)
+	if err != nil {
+		return fail(err)
+	}
+	condition, args, err := sru.ToSQL(node, sruIndexColumns)
+	if err != nil {
+		return fail(err)
+	}
+
+	search := db.Model(&models.Book{}).
+		Joins("JOIN authors ON authors.id = books.author_id AND authors.deleted_at IS NULL").
+		Where(condition, args...).
+		Session(&gorm.Session{}) // a new session so the count and the page can both be run on the same conditions
+
+	if err := search.Count(&response.NumberOfRecords).Error; err != nil {
+		return fail(err)
+	}
+	if response.NumberOfRecords > 0 && int64(start) > response.NumberOfRecords {
+		return fail(sru.NewDiagnostic(sru.DiagnosticFirstRecordOutOfRange, strconv.Itoa(start)))
+	}
+	if limit == 0 || response.NumberOfRecords == 0 {
+		return writeSru(c, response)
+	}
+
+	var books []models.Book
+	if err := search.Preload("Author").Order("books.id").Offset(start - 1).Limit(limit).Find(&books).Error; err != nil {
+		return fail(err)
+	}
+
+	response.Records = &sru.Records{}
+	for i, book := range books {
+		var content any
+		if schema == sru.SchemaMARCXML {
+			content = marc.ToXML(marc.FromBook(book))
+		} else {
+			content = sru.DublinCore(book)
+		}
+		response.Records.Records = append(response.Records.Records, sru.NewRecord(version, schema, start+i, content))
+	}
+
+	if next := start + len(books); int64(next) <= response.NumberOfRecords {
+		response.NextRecordPosition = next
+	}
+
+	return writeSru(c, response)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// sruSchema returns the schema of a recordSchema parameter given by its short name or its identifier.
+func sruSchema(recordSchema string) (string, bool) {
+	if recordSchema == "" {
+		return sru.SchemaDC, true
+	}
+	for schema, identifier := range sru.SchemaIdentifiers {
+		if recordSchema == schema || recordSchema == identifier {
+			return schema, true
+		}
+	}
+	return "", false
+}
+
+func writeSruDiagnostic(c *fiber.Ctx, version, operation string, diagnostic *sru.Diagnostic) error {
+	if operation == "explain" {
+		response := sru.NewExplainResponse(version)
+		response.Diagnostics = sru.NewDiagnostics(version, diagnostic)
+		return writeSru(c, response)
+	}
+
+	response := sru.NewSearchRetrieveResponse(version)
+	response.Diagnostics = sru.NewDiagnostics(version, diagnostic)
+	return writeSru(c, response)
+}
+
+// writeSru sends the response, SRU diagnostics are sent with a 200 status like the records.
+func writeSru(c *fiber.Ctx, response any) error {
+	out, err := xml.Marshal(response)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to write the SRU response",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(fiber.StatusOK).Send(append([]byte(xml.Header), out...))
+}
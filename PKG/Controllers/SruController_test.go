@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSruExplain(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/sru?operation=explain&version=1.2", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "<explainResponse")
+}
+
+func TestSruSearchRetrieve(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+
+	book := models.Book{
+		Title:         "Sample Book",
+		ISBN:          "1234567890",
+		PublishedDate: time.Now(),
+		AuthorID:      author.ID,
+	}
+	db.Create(&book)
+
+	query := url.QueryEscape(`title any "sample other" and author=doe`)
+	req := httptest.NewRequest(http.MethodGet, "/sru?version=2.0&recordSchema=marcxml&query="+query, nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// The records are fetched with the same conditions as the count
+	assert.Contains(t, string(body), "numberOfRecords>1<")
+	assert.Contains(t, string(body), "Sample Book")
+}
+
+func TestSruUnsupportedIndex(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/sru?operation=searchRetrieve&version=1.2&query=publisher%3Dpenguin", nil)
+	resp, _ := app.Test(req, -1)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "info:srw/diagnostic/1/16")
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"strconv"
+
+	search "github.com/Pyramakerz/Library_Management_System/PKG/Search"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Suggest godoc
+// @Summary      Autocomplete titles and authors
+// @Description  Get the most popular book titles and author names having a word starting with the typed prefix
+// @Tags         search
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        q      query  string  true   "Typed prefix"
+// @Param        limit  query  int     false  "Max number of suggestions (default 10, max 50)"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/suggest [get]
+func Suggest(c *fiber.Ctx) error {
+	ensureDB()
+
+	prefix := c.Query("q")
+
+	if prefix == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Query q is required",
+		})
+	}
+
+	limit := defaultSuggestLimit
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid limit",
+			})
+		}
+		limit = min(n, maxSuggestLimit)
+	}
+
+	suggestions, err := search.Suggest(db, prefix, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to get suggestions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  suggestions,
+	})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	search "github.com/Pyramakerz/Library_Management_System/PKG/Search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggest(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "Seamus Heaney", Email: "seamus@example.com"}
+	db.Create(&author)
+
+	books := []models.Book{
+		{Title: "Searchable Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID},
+		{Title: "The Sea Wolf", ISBN: "1234567891", PublishedDate: time.Now(), AuthorID: author.ID},
+		{Title: "North", ISBN: "1234567892", PublishedDate: time.Now(), AuthorID: author.ID},
+	}
+	db.Create(&books)
+	// The test app doesn't register search.Watch, the index built by an earlier test would be served
+	search.Invalidate()
+
+	// Well above the views other tests may have left on the same IDs
+	for range 1000 {
+		search.RecordView(books[1].ID)
+	}
+	for range 500 {
+		search.RecordView(books[0].ID)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/suggest?q=sea&limit=5", nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data []search.Suggestion `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	var texts []string
+	for _, s := range result.Data {
+		texts = append(texts, s.Text)
+	}
+	// "The Sea Wolf" matches on its second word, the author scores the views of all their books
+	assert.Equal(t, []string{"Seamus Heaney", "The Sea Wolf", "Searchable Book"}, texts)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/suggest?q=sea+w&limit=5", nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	result.Data = nil
+	json.NewDecoder(resp.Body).Decode(&result)
+	if assert.Len(t, result.Data, 1) {
+		assert.Equal(t, "book", result.Data[0].Type)
+		assert.Equal(t, books[1].ID, result.Data[0].ID)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/suggest?q=sea&limit=1", nil)
+	resp, _ = app.Test(req, -1)
+	result.Data = nil
+	json.NewDecoder(resp.Body).Decode(&result)
+	if assert.Len(t, result.Data, 1) {
+		assert.Equal(t, "author", result.Data[0].Type)
+	}
+}
+
+func TestSuggestWithoutQuery(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/suggest", nil)
+	resp, _ := app.Test(req, -1)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
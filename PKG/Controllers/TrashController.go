@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	trash "github.com/Pyramakerz/Library_Management_System/PKG/Trash"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// A soft-deleted book, PurgeAt is when it will be hard deleted (none when the trash is kept forever)
+type TrashedBook struct {
+	models.Book
+	DeletedAt time.Time  `json:"deletedAt"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"`
+}
+
+// A soft-deleted author
+type TrashedAuthor struct {
+	models.Author
+	DeletedAt time.Time  `json:"deletedAt"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"`
+}
+
+func purgeAt(deletedAt time.Time) *time.Time {
+	retention := trash.Retention()
+	if retention == 0 {
+		return nil
+	}
+	at := deletedAt.Add(retention)
+	return &at
+}
+
+// refuseHardDelete returns the status and message of the response when a hard delete can't go on, 0 when it can.
+// The checked out books are never deleted, the records deleted in cascade need the confirmation token or force=true.
+func refuseHardDelete(c *fiber.Ctx, deps trash.Dependencies) (int, string) {
+	if deps.ActiveLoans > 0 {
+		return fiber.StatusConflict, "Books are checked out, check them in first"
+	}
+	if deps.Cascades() && !c.QueryBool("force") && c.Query("confirm") != deps.ConfirmationToken {
+		return fiber.StatusPreconditionRequired, "Other records are deleted with it, send the confirmation token as confirm or force=true"
+	}
+	return 0, ""
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetBookTrash godoc
+// @Summary      Get the soft-deleted books
+// @Description  Get the books in the trash, the last deleted first, with when they were deleted and when they will be purged
+// @Tags         books
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {array}   TrashedBook
+// @Failure      500  {object}  any
+// @Router       /api/book/trash [get]
+func GetBookTrash(c *fiber.Ctx) error {
+	ensureDB()
+
+	var books []models.Book
+	err := db.Unscoped().
+		Preload("Author", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&books).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the trash",
+		})
+	}
+
+	trashed := make([]TrashedBook, 0, len(books))
+	for _, book := range books {
+		trashed = append(trashed, TrashedBook{Book: book, DeletedAt: book.DeletedAt.Time, PurgeAt: purgeAt(book.DeletedAt.Time)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  trashed,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAuthorTrash godoc
+// @Summary      Get the soft-deleted authors
+// @Description  Get the authors in the trash, the last deleted first, with when they were deleted and when they will be purged
+// @Tags         authors
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {array}   TrashedAuthor
+// @Failure      500  {object}  any
+// @Router       /api/author/trash [get]
+func GetAuthorTrash(c *fiber.Ctx) error {
+	ensureDB()
+
+	var authors []models.Author
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&authors).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch the trash",
+		})
+	}
+
+	trashed := make([]TrashedAuthor, 0, len(authors))
+	for _, author := range authors {
+		trashed = append(trashed, TrashedAuthor{Author: author, DeletedAt: author.DeletedAt.Time, PurgeAt: purgeAt(author.DeletedAt.Time)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  trashed,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RestoreBook godoc
+// @Summary      Restore a soft-deleted book
+// @Description  Take a book out of the trash, it fails when its ISBN was given to another book or its author is in the trash
+// @Tags         books
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        bookid   path    string  true   "Book ID"
+// @Success      200  {object}  models.Book
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/book/{bookid}/restore [post]
+func RestoreBook(c *fiber.Ctx) error {
+	ensureDB()
+
+	id := c.Params("bookid")
+
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter Book ID",
+		})
+	}
+
+	var book models.Book
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").First(&book, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Book not found in the trash",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find book",
+		})
+	}
+
+	// The ISBN may have been given to another book while this one was in the trash
+	var existingBookWithISBN models.Book
+	if err := db.Where("isbn = ? AND id <> ?", book.ISBN, book.ID).First(&existingBookWithISBN).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "ISBN already exists",
+		})
+	}
+
+	var author models.Author
+	if err := db.First(&author, book.AuthorID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   true,
+				"message": "Author of the book is deleted, restore the author first",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find author",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&book).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		book.DeletedAt = gorm.DeletedAt{}
+		book.Author = author
+		if _, err := history.Record(tx, history.Book(book, history.ActionRestore, actor(c))); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionRestore, history.EntityBook, book.ID, nil, book)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to restore book",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  book,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RestoreAuthor godoc
+// @Summary      Restore a soft-deleted author
+// @Description  Take an author out of the trash with the books deleted with them, it fails when their email or the ISBN of one of these books was given to another record
+// @Tags         authors
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        authorid  path    string  true   "Author ID"
+// @Success      200  {object}  models.Author
+// @Failure      400  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/author/{authorid}/restore [post]
+func RestoreAuthor(c *fiber.Ctx) error {
+	ensureDB()
+
+	id := c.Params("authorid")
+
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enter Author ID",
+		})
+	}
+
+	var author models.Author
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").First(&author, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": "Author not found in the trash",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find author",
+		})
+	}
+
+	// The email may have been given to another author while this one was in the trash
+	var conflictingAuthorEmail models.Author
+	if err := db.Where("email = ? AND id <> ?", author.Email, author.ID).First(&conflictingAuthorEmail).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Email already exists",
+		})
+	}
+
+	// The books soft deleted with the author have the same deletion time, the ones deleted before stay in the trash
+	var books []models.Book
+	if err := db.Unscoped().Where("author_id = ? AND deleted_at = ?", author.ID, author.DeletedAt.Time).Find(&books).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to find the books of the author",
+		})
+	}
+	for _, book := range books {
+		var existingBookWithISBN models.Book
+		if err := db.Where("isbn = ? AND id <> ?", book.ISBN, book.ID).First(&existingBookWithISBN).Error; err == nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   true,
+				"message": "ISBN " + book.ISBN + " of a book of the author already exists",
+			})
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&author).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		author.DeletedAt = gorm.DeletedAt{}
+		if _, err := history.Record(tx, history.Author(author, history.ActionRestore, actor(c))); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, c, history.ActionRestore, history.EntityAuthor, author.ID, nil, author); err != nil {
+			return err
+		}
+
+		for _, book := range books {
+			if err := tx.Unscoped().Model(&book).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			book.DeletedAt = gorm.DeletedAt{}
+			if _, err := history.Record(tx, history.Book(book, history.ActionRestore, actor(c))); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, c, history.ActionRestore, history.EntityBook, book.ID, nil, book); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to restore author",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":         false,
+		"data":          author,
+		"restoredBooks": len(books),
+	})
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	trash "github.com/Pyramakerz/Library_Management_System/PKG/Trash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashAndRestore(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Sample Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+
+	db.Delete(&book)
+	db.Delete(&author)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/book/trash", nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data []map[string]any `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if assert.Len(t, result.Data, 1) {
+		assert.Equal(t, "Sample Book", result.Data[0]["title"])
+		assert.NotEmpty(t, result.Data[0]["deletedAt"])
+		assert.NotEmpty(t, result.Data[0]["purgeAt"])
+	}
+
+	// The author is in the trash too so the book can't come back first
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/book/%d/restore", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/author/%d/restore", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/book/%d/restore", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/book/%d", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Restoring again finds nothing in the trash
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/book/%d/restore", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	kept := models.Book{Title: "Kept Book", ISBN: "1111111111", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&kept)
+	old := models.Book{Title: "Old Book", ISBN: "2222222222", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&old)
+	db.Delete(&old)
+	db.Delete(&author)
+
+	purged, err := trash.Purge(db, time.Now().Add(time.Minute))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{old.ID}, purged.Books)
+	// The author still has a book so they are kept
+	assert.Empty(t, purged.Authors)
+
+	var count int64
+	db.Unscoped().Model(&models.Book{}).Where("id = ?", old.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	db.Unscoped().Model(&models.Author{}).Where("id = ?", author.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestSoftDeleteAuthorCascade(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	deletedBefore := models.Book{Title: "Deleted Before", ISBN: "1111111111", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&deletedBefore)
+	db.Delete(&deletedBefore)
+	book := models.Book{Title: "Sample Book", ISBN: "2222222222", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/author/softdelete/%d", author.ID), nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/book/%d", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/author/%d/restore", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		RestoredBooks int `json:"restoredBooks"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, 1, result.RestoredBooks)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/book/%d", book.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The book deleted on its own stays in the trash
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/book/%d", deletedBefore.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestSoftDeleteAuthorRestrict(t *testing.T) {
+	t.Setenv("SOFT_DELETE_AUTHOR_BOOKS", trash.RestrictBooks)
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	db.Create(&models.Book{Title: "Sample Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID})
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/author/softdelete/%d", author.ID), nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/author/%d", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeleteAuthorConfirmation(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Sample Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+	patron := models.Patron{Barcode: "P1001", Name: "Jane Doe"}
+	db.Create(&patron)
+	returned := time.Now()
+	db.Create(&models.Loan{BookID: book.ID, PatronID: patron.ID, CheckedOutAt: time.Now(), DueAt: time.Now(), ReturnedAt: &returned})
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/author/%d", author.ID), nil)
+	resp, _ := app.Test(req, -1)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	var result struct {
+		Data trash.Dependencies `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, int64(1), result.Data.Books)
+	assert.Equal(t, int64(1), result.Data.Loans)
+	assert.NotEmpty(t, result.Data.ConfirmationToken)
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/author/%d?confirm=wrong", author.ID), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/author/%d?confirm=%s", author.ID, result.Data.ConfirmationToken), nil)
+	resp, _ = app.Test(req, -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var count int64
+	db.Unscoped().Model(&models.Book{}).Where("id = ?", book.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// The final snapshot of the book deleted in cascade is in the audit log
+	db.Model(&models.AuditLog{}).Where("entity_type = ? AND entity_id = ? AND action = ?", "book", book.ID, "delete").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestDeleteCheckedOutBook(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	author := models.Author{Name: "John Doe", Email: "john@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Sample Book", ISBN: "1234567890", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+	patron := models.Patron{Barcode: "P1001", Name: "Jane Doe"}
+	db.Create(&patron)
+	db.Create(&models.Loan{BookID: book.ID, PatronID: patron.ID, CheckedOutAt: time.Now(), DueAt: time.Now()})
+
+	for _, path := range []string{
+		fmt.Sprintf("/api/book/%d?force=true", book.ID),
+		fmt.Sprintf("/api/author/%d?force=true", author.ID),
+	} {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		resp, _ := app.Test(req, -1)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	}
+}
@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	ldap "github.com/Pyramakerz/Library_Management_System/PKG/Ldap"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Code is a code of the authenticator app, or a recovery code where it is accepted
+type TwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// Password of the current user, an access token alone can't bind an authenticator app to the account
+type EnrollTwoFactorRequest struct {
+	Password string `json:"password"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// EnrollTwoFactor godoc
+// @Summary      Start the two-factor enrollment
+// @Description  Generate the secret of the authenticator app of the current user, the user sends their password again.
+// @Description  Returns the otpauth:// uri and the same uri as a PNG QR code (qrCode, a data: URI) for the app to scan.
+// @Description  Two-factor authentication is enabled once a code of the app is confirmed, enrolling again replaces a secret not confirmed yet
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        password  body  EnrollTwoFactorRequest  true  "Password of the current user"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Failure      502  {object}  any
+// @Router       /api/auth/2fa/enroll [post]
+func EnrollTwoFactor(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := currentUser(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var req EnrollTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	if auth.SingleSignOn(user) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Single sign-on users use the two-factor authentication of their identity provider",
+		})
+	}
+	if user.TotpEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Two-factor authentication is already enabled",
+		})
+	}
+
+	// With a stolen access token of a user who hasn't enrolled, the thief could otherwise add their own app
+	// and keep the account once the role requires two-factor authentication
+	if ferr := checkPassword(c, user, req.Password); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	secret := auth.NewTotpSecret()
+	uri := auth.ProvisioningURI(secret, user.Username)
+	qrCode, err := auth.QRCode(uri)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to enroll",
+		})
+	}
+
+	if err := db.Model(&user).Update("totp_secret", secret).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to enroll",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data": fiber.Map{
+			"secret": secret,
+			"uri":    uri,
+			"qrCode": qrCode,
+		},
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ConfirmTwoFactor godoc
+// @Summary      Enable two-factor authentication
+// @Description  Confirm the enrollment with a code of the authenticator app, the next logins ask for a code.
+// @Description  Returns the recovery codes, they are shown once and each one logs in once instead of a code
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        code  body  TwoFactorRequest  true  "Code of the authenticator app"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/2fa/confirm [post]
+func ConfirmTwoFactor(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := currentUser(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var req TwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	if user.TotpEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Two-factor authentication is already enabled",
+		})
+	}
+	if user.TotpSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Enroll with /api/auth/2fa/enroll first",
+		})
+	}
+
+	step, ok := auth.CheckTotp(user.TotpSecret, req.Code, time.Now(), user.TotpLastStep)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Invalid two-factor code",
+		})
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		previousUser := user
+		user.TotpEnabled, user.TotpLastStep = true, step
+		if err := tx.Model(&user).Updates(map[string]any{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		var err error
+		if codes, err = auth.NewRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionUpdate, entityUser, user.ID, previousUser, user)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to enable two-factor authentication",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data": fiber.Map{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate the recovery codes
+// @Description  Replace the recovery codes of the current user, the old ones can't be used anymore
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        code  body  TwoFactorRequest  true  "Code of the authenticator app or recovery code"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/2fa/recovery [post]
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := twoFactorUser(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	codes, err := auth.NewRecoveryCodes(db, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to generate the recovery codes",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data": fiber.Map{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// DisableTwoFactor godoc
+// @Summary      Disable two-factor authentication
+// @Description  Remove the authenticator app and the recovery codes of the current user, refused when their role requires two-factor authentication
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        code  body  TwoFactorRequest  true  "Code of the authenticator app or recovery code"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/auth/2fa [delete]
+func DisableTwoFactor(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := twoFactorUser(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	if user.Role != nil && user.Role.RequireTwoFactor {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Your role requires two-factor authentication",
+		})
+	}
+
+	if err := resetTwoFactor(c, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to disable two-factor authentication",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Two-factor authentication disabled successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ResetUserTwoFactor godoc
+// @Summary      Reset the two-factor authentication of a user
+// @Description  Remove the authenticator app and the recovery codes of a user who lost them and log them out everywhere,
+// @Description  they log in with their password and enroll again
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        userid  path  string  true  "User ID"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/user/{userid}/2fa [delete]
+func ResetUserTwoFactor(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := findUser(c.Params("userid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	if err := resetTwoFactor(c, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to reset two-factor authentication",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "Two-factor authentication reset successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// twoFactorUser returns the current user after checking the code of the request, the error has the status and message of the response.
+func twoFactorUser(c *fiber.Ctx) (models.User, *fiber.Error) {
+	user, ferr := currentUser(c)
+	if ferr != nil {
+		return user, ferr
+	}
+
+	var req TwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return user, fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+
+	if !user.TotpEnabled {
+		return user, fiber.NewError(fiber.StatusConflict, "Two-factor authentication is not enabled")
+	}
+	if err := auth.VerifyTwoFactor(db, user, req.Code, time.Now()); errors.Is(err, auth.ErrTwoFactorRequired) || errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		return user, fiber.NewError(fiber.StatusBadRequest, "Invalid two-factor code")
+	} else if err != nil {
+		return user, fiber.NewError(fiber.StatusInternalServerError, "Failed to check the two-factor code")
+	}
+	return user, nil
+}
+
+// checkPassword checks the password of the current user again, with the directory for its users,
+// the error has the status and message of the response.
+func checkPassword(c *fiber.Ctx, user models.User, password string) *fiber.Error {
+	checked, err := auth.Authenticate(db, user.Username, password)
+	if errors.Is(err, auth.ErrInvalidCredentials) && user.ExternalID != nil && ldap.Settings().Enabled() {
+		// The users of the directory have no local password
+		var ferr *fiber.Error
+		if checked, ferr = ldapLogin(c, user.Username, password); ferr != nil {
+			return ferr
+		}
+	} else if errors.Is(err, auth.ErrInvalidCredentials) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid password")
+	} else if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check the password")
+	}
+
+	if checked.ID != user.ID {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid password")
+	}
+	return nil
+}
+
+// resetTwoFactor removes the secret and the recovery codes of a user and logs them out everywhere
+func resetTwoFactor(c *fiber.Ctx, user models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		previousUser := user
+		user.TotpEnabled, user.TotpSecret, user.TotpLastStep = false, "", 0
+		err := tx.Model(&user).Updates(map[string]any{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := auth.RevokeUser(tx, user.ID, time.Now()); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionUpdate, entityUser, user.ID, previousUser, user)
+	})
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonAs(app *fiber.App, method, path, token string, body any) *http.Response {
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ := app.Test(req, -1)
+	return resp
+}
+
+// enrollTwoFactor enables two-factor authentication with the token of a user and returns their secret and recovery codes
+func enrollTwoFactor(t *testing.T, app *fiber.App, token string) (string, []string) {
+	// The access token alone isn't enough, the password is sent again
+	resp := jsonAs(app, http.MethodPost, "/api/auth/2fa/enroll", token, EnrollTwoFactorRequest{})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = jsonAs(app, http.MethodPost, "/api/auth/2fa/enroll", token, EnrollTwoFactorRequest{Password: "wrong password"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = jsonAs(app, http.MethodPost, "/api/auth/2fa/enroll", token, EnrollTwoFactorRequest{Password: "correct horse"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var enrolled struct {
+		Data struct {
+			Secret string `json:"secret"`
+			URI    string `json:"uri"`
+			QRCode string `json:"qrCode"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&enrolled)
+	assert.True(t, strings.HasPrefix(enrolled.Data.URI, "otpauth://totp/"), enrolled.Data.URI)
+	assert.Contains(t, enrolled.Data.URI, "secret="+enrolled.Data.Secret)
+	assert.True(t, strings.HasPrefix(enrolled.Data.QRCode, "data:image/png;base64,"))
+
+	resp = jsonAs(app, http.MethodPost, "/api/auth/2fa/confirm", token, TwoFactorRequest{Code: "000000x"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The previous step so that the code of the current one can still be used at the login
+	code, _ := auth.TotpCode(enrolled.Data.Secret, auth.TotpStep(time.Now())-1)
+	resp = jsonAs(app, http.MethodPost, "/api/auth/2fa/confirm", token, TwoFactorRequest{Code: code})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var confirmed struct {
+		Data struct {
+			RecoveryCodes []string `json:"recoveryCodes"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&confirmed)
+	assert.Len(t, confirmed.Data.RecoveryCodes, 10)
+	return enrolled.Data.Secret, confirmed.Data.RecoveryCodes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	token := accessToken(t, "librarian", auth.RoleLibrarian, nil)
+	secret, recoveryCodes := enrollTwoFactor(t, protectedApp(), token)
+
+	resp := postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, true, body["twoFactorRequired"])
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse", Code: "123456"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	code, _ := auth.TotpCode(secret, auth.TotpStep(time.Now()))
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse", Code: code})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// A code is used once
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse", Code: code})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse", Code: strings.ToUpper(recoveryCodes[0])})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse", Code: recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = jsonAs(protectedApp(), http.MethodDelete, "/api/auth/2fa", token, TwoFactorRequest{Code: recoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var recoveryCodesLeft int64
+	db.Model(&models.RecoveryCode{}).Count(&recoveryCodesLeft)
+	assert.Zero(t, recoveryCodesLeft)
+
+	resp = postJSON(app, "/api/auth/login", LoginRequest{Username: "librarian", Password: "correct horse"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTwoFactorPolicy(t *testing.T) {
+	app := SetupFiberApp()
+
+	db := config.GetDB()
+	defer CleanDB(db)
+
+	db.Model(&models.Role{}).Where("name = ?", auth.RoleLibrarian).Update("require_two_factor", true)
+	token := accessToken(t, "librarian", auth.RoleLibrarian, nil)
+	member := accessToken(t, "member", auth.RoleMember, nil)
+
+	// The librarian has to enroll before using their permissions, the other roles are not concerned
+	resp := requestAs(protectedApp(), http.MethodPost, "/api/book", token)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, true, body["twoFactorRequired"])
+
+	resp = requestAs(protectedApp(), http.MethodGet, "/api/patron/1/loans", member)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	body = nil
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Nil(t, body["twoFactorRequired"])
+
+	_, recoveryCodes := enrollTwoFactor(t, protectedApp(), token)
+
+	resp = requestAs(protectedApp(), http.MethodPost, "/api/book", token)
+	assert.NotEqual(t, http.StatusForbidden, resp.StatusCode)
+
+	// It can't be disabled by the librarian, an admin resets it when the phone is lost
+	resp = jsonAs(protectedApp(), http.MethodDelete, "/api/auth/2fa", token, TwoFactorRequest{Code: recoveryCodes[0]})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	var user models.User
+	db.Where("username = ?", "librarian").First(&user)
+	resp, _ = app.Test(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/user/%d/2fa", user.ID), nil), -1)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	db.First(&user, user.ID)
+	assert.False(t, user.TotpEnabled)
+	assert.Empty(t, user.TotpSecret)
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entity type of the users in the audit log
+const entityUser = "user"
+
+// Minimum length of the passwords
+const minPasswordLength = 8
+
+// Password is only written, the hash is stored. It is kept on update when it is not sent, like Role (a new user is a member).
+// PatronID links a member to their patron card.
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Disabled bool   `json:"disabled"`
+	Role     string `json:"role"`
+	PatronID *uint  `json:"patronID"`
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// GetAllUsers godoc
+// @Summary      Get all users
+// @Description  Get a list of all the accounts of the API
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Success      200  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/user [get]
+func GetAllUsers(c *fiber.Ctx) error {
+	ensureDB()
+
+	var users []models.User
+	if err := db.Preload("Role").Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to fetch users",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  users,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// CreateUser godoc
+// @Summary      Create a new user
+// @Description  Create an account of the API, the password has 8 characters at least and the role is member when it is not given
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        user  body  UserRequest  true  "User data"
+// @Success      201  {object}  models.User
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/user [post]
+func CreateUser(c *fiber.Ctx) error {
+	ensureDB()
+
+	var req UserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	if req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Password is required",
+		})
+	}
+
+	if req.Role == "" {
+		req.Role = auth.RoleMember
+	}
+
+	user := models.User{}
+	if err := applyUserRequest(&user, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var existingUser models.User
+	if err := db.Where("username = ?", user.Username).First(&existingUser).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Username already exists",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, history.ActionCreate, entityUser, user.ID, nil, user)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to create user",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"error": false,
+		"data":  user,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// UpdateUser godoc
+// @Summary      Update an existing user
+// @Description  Update a user, a new password or disabling the user logs them out everywhere
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        userid  path  string       true  "User ID"
+// @Param        user    body  UserRequest  true  "Updated user data"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      409  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/user/{userid} [put]
+func UpdateUser(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := findUser(c.Params("userid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	var req UserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "Cannot parse JSON",
+		})
+	}
+
+	previousUser := user
+	if err := applyUserRequest(&user, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	var conflictingUser models.User
+	if err := db.Where("username = ? AND id <> ?", user.Username, user.ID).First(&conflictingUser).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": "Username already exists",
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&user).Error; err != nil {
+			return err
+		}
+		// The sessions opened with the old password or before the user was disabled are closed
+		if user.PasswordHash != previousUser.PasswordHash || user.Disabled {
+			if err := auth.RevokeUser(tx, user.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, c, history.ActionUpdate, entityUser, user.ID, previousUser, user)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to update user",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error": false,
+		"data":  user,
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// DeleteUser godoc
+// @Summary      Delete a user
+// @Description  Permanently delete a user and their refresh tokens
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Param        userid  path  string  true  "User ID"
+// @Success      200  {object}  any
+// @Failure      400  {object}  any
+// @Failure      401  {object}  any
+// @Failure      403  {object}  any
+// @Failure      404  {object}  any
+// @Failure      500  {object}  any
+// @Router       /api/user/{userid} [delete]
+func DeleteUser(c *fiber.Ctx) error {
+	ensureDB()
+
+	user, ferr := findUser(c.Params("userid"))
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error":   true,
+			"message": ferr.Message,
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(tx, c, history.ActionDelete, entityUser, user.ID, user, nil); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "Failed to delete user",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"error":   false,
+		"message": "User deleted successfully",
+	})
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// findUser returns the user of an ID, the error has the status and message of the response.
+func findUser(id string) (models.User, *fiber.Error) {
+	var user models.User
+
+	if id == "" {
+		return user, fiber.NewError(fiber.StatusBadRequest, "Enter User ID")
+	}
+
+	if err := db.Preload("Role").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+		return user, fiber.NewError(fiber.StatusInternalServerError, "Failed to get user")
+	}
+	return user, nil
+}
+
+func applyUserRequest(user *models.User, req UserRequest) error {
+	if req.Username == "" {
+		return errors.New("Username is required")
+	}
+
+	user.Username = req.Username
+	user.Disabled = req.Disabled
+
+	if req.Role != "" {
+		var role models.Role
+		if err := db.Where("name = ?", req.Role).First(&role).Error; err != nil {
+			return errors.New("Role not found")
+		}
+		user.RoleID = &role.ID
+		user.Role = &role
+	}
+
+	if req.PatronID != nil {
+		if _, ferr := findPatron(strconv.FormatUint(uint64(*req.PatronID), 10)); ferr != nil {
+			return errors.New("Patron not found")
+		}
+	}
+	user.PatronID = req.PatronID
+
+	if req.Password != "" {
+		if len(req.Password) < minPasswordLength {
+			return errors.New("Password must have 8 characters at least")
+		}
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			return errors.New("Invalid password")
+		}
+		user.PasswordHash = hash
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Media types of the feeds
+const (
+	AtomType = "application/atom+xml"
+	RSSType  = "application/rss+xml"
+)
+
+// Feed is a syndication feed independent of its format (Atom 1.0 or RSS 2.0).
+type Feed struct {
+	ID       string // Atom id, a URN or the URL of the feed
+	Title    string
+	Subtitle string
+	Link     string // the page of the feed for the readers
+	Self     string // the URL of the feed itself
+	Updated  time.Time
+	Items    []Item
+}
+
+type Item struct {
+	ID        string // urn:isbn:...
+	Title     string
+	Link      string
+	Author    string
+	Category  string
+	Summary   string
+	Published time.Time
+	Updated   time.Time
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Published string        `xml:"published"`
+	Updated   string        `xml:"updated"`
+	Author    *atomPerson   `xml:"author,omitempty"`
+	Category  *atomCategory `xml:"category,omitempty"`
+	Summary   string        `xml:"summary,omitempty"`
+	Link      atomLink      `xml:"link"`
+}
+
+// Atom renders the feed as Atom 1.0, author is the author of the feed (required when an entry has none).
+func Atom(feed Feed, author string) ([]byte, error) {
+	out := atomFeed{
+		Xmlns:    "http://www.w3.org/2005/Atom",
+		ID:       feed.ID,
+		Title:    feed.Title,
+		Subtitle: feed.Subtitle,
+		Updated:  feed.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: feed.Self, Type: AtomType},
+			{Rel: "alternate", Href: feed.Link},
+		},
+	}
+
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+			Summary:   item.Summary,
+			Link:      atomLink{Rel: "alternate", Href: item.Link},
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		} else {
+			entry.Author = &atomPerson{Name: author}
+		}
+		if item.Category != "" {
+			entry.Category = &atomCategory{Term: item.Category}
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	body, err := xml.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type rss struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	XmlnsAtom string     `xml:"xmlns:atom,attr"`
+	XmlnsDC   string     `xml:"xmlns:dc,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssSelf is the atom:link recommended by the RSS validators
+type rssSelf struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Category    string  `xml:"category,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders the feed as RSS 2.0, the items are dated with their publication in the feed.
+func RSS(feed Feed) ([]byte, error) {
+	description := feed.Subtitle
+	if description == "" {
+		description = feed.Title
+	}
+
+	out := rss{
+		Version:   "2.0",
+		XmlnsAtom: "http://www.w3.org/2005/Atom",
+		XmlnsDC:   "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.Link,
+			Description:   description,
+			AtomLink:      rssSelf{Rel: "self", Href: feed.Self, Type: RSSType},
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, item := range feed.Items {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Summary,
+			Creator:     item.Author,
+			Category:    item.Category,
+			GUID:        rssGUID{Value: item.ID},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	body, err := xml.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,52 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleFeed() Feed {
+	added := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return Feed{
+		ID:      "urn:library:feed:new",
+		Title:   "New acquisitions",
+		Link:    "http://localhost:9090/api/book",
+		Self:    "http://localhost:9090/feeds/new.atom",
+		Updated: added,
+		Items: []Item{{
+			ID:        "urn:isbn:0261103342",
+			Title:     "The Hobbit",
+			Link:      "http://localhost:9090/api/book/1",
+			Author:    "J. R. R. Tolkien",
+			Category:  "Fantasy fiction",
+			Summary:   "Published on 1937-09-21",
+			Published: added,
+			Updated:   added,
+		}},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	out, err := Atom(sampleFeed(), "Library")
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<feed xmlns="http://www.w3.org/2005/Atom">`))
+	assert.Contains(t, string(out), `<link rel="self" href="http://localhost:9090/feeds/new.atom" type="application/atom+xml"></link>`)
+	assert.Contains(t, string(out), "<published>2024-05-01T10:00:00Z</published>")
+	assert.Contains(t, string(out), "<author><name>J. R. R. Tolkien</name></author>")
+	assert.Contains(t, string(out), `<category term="Fantasy fiction"></category>`)
+}
+
+func TestRSS(t *testing.T) {
+	out, err := RSS(sampleFeed())
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `<rss version="2.0"`)
+	assert.Contains(t, string(out), "<description>New acquisitions</description>")
+	assert.Contains(t, string(out), `<guid isPermaLink="false">urn:isbn:0261103342</guid>`)
+	assert.Contains(t, string(out), "<pubDate>Wed, 01 May 2024 10:00:00 +0000</pubDate>")
+	assert.Contains(t, string(out), "<dc:creator>J. R. R. Tolkien</dc:creator>")
+}
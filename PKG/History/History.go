@@ -0,0 +1,168 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+// Entities having a history
+const (
+	EntityBook   = "book"
+	EntityAuthor = "author"
+)
+
+// Actions recorded in the history
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionDelete     = "delete"
+	ActionSoftDelete = "softdelete"
+	ActionRevert     = "revert"
+	ActionRestore    = "restore"
+	ActionPurge      = "purge"
+)
+
+// Change is the old and new value of a field
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Entry is a change to record, Before is the state of the record before an update
+// (the snapshot of the last revision is used when it is nil).
+type Entry struct {
+	EntityType string
+	EntityID   uint
+	Action     string
+	Actor      string
+	Before     map[string]any
+	Fields     map[string]any
+	RevertedTo int
+}
+
+// BookFields returns the fields of a book kept in its history, they have the names of the CreateBookRequest JSON.
+func BookFields(book models.Book) map[string]any {
+	return normalize(map[string]any{
+		"title":         book.Title,
+		"isbn":          book.ISBN,
+		"publishedDate": book.PublishedDate,
+		"subject":       book.Subject,
+		"authorID":      book.AuthorID,
+	})
+}
+
+// AuthorFields returns the fields of an author kept in its history.
+func AuthorFields(author models.Author) map[string]any {
+	return normalize(map[string]any{
+		"name":  author.Name,
+		"email": author.Email,
+	})
+}
+
+// normalize gives the fields the types they have once decoded from a snapshot (times are strings, numbers are float64)
+// so that they can be compared.
+func normalize(fields map[string]any) map[string]any {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return fields
+	}
+	normalized := map[string]any{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return fields
+	}
+	return normalized
+}
+
+// Diff returns the fields that changed between two snapshots.
+func Diff(before, after map[string]any) map[string]Change {
+	changes := map[string]Change{}
+
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			changes[key] = Change{From: before[key], To: after[key]}
+		}
+	}
+	return changes
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Latest returns the last revision of a record, gorm.ErrRecordNotFound when it has no history.
+func Latest(tx *gorm.DB, entityType string, entityID uint) (models.Revision, error) {
+	var revision models.Revision
+	err := tx.Where("entity_type = ? AND entity_id = ?", entityType, entityID).Order("version DESC").First(&revision).Error
+	return revision, err
+}
+
+// Revisions returns the history of a record, the oldest version first.
+func Revisions(tx *gorm.DB, entityType string, entityID uint) ([]models.Revision, error) {
+	var revisions []models.Revision
+	err := tx.Where("entity_type = ? AND entity_id = ?", entityType, entityID).Order("version").Find(&revisions).Error
+	return revisions, err
+}
+
+// Record stores the next version of a record, an update that changes nothing is not recorded (the returned revision is empty).
+func Record(tx *gorm.DB, entry Entry) (models.Revision, error) {
+	latest, err := Latest(tx, entry.EntityType, entry.EntityID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Revision{}, err
+	}
+
+	changes := map[string]Change{}
+	if entry.Action == ActionCreate || entry.Action == ActionUpdate || entry.Action == ActionRevert {
+		before := entry.Before
+		if before == nil && latest.ID != 0 && entry.Action != ActionCreate {
+			if err := json.Unmarshal(latest.Snapshot, &before); err != nil {
+				return models.Revision{}, err
+			}
+		}
+		changes = Diff(before, entry.Fields)
+
+		if len(changes) == 0 && entry.Action == ActionUpdate {
+			return models.Revision{}, nil
+		}
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return models.Revision{}, err
+	}
+	snapshot, err := json.Marshal(entry.Fields)
+	if err != nil {
+		return models.Revision{}, err
+	}
+
+	revision := models.Revision{
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Version:    latest.Version + 1,
+		Action:     entry.Action,
+		Actor:      entry.Actor,
+		Changes:    changesJSON,
+		Snapshot:   snapshot,
+		RevertedTo: entry.RevertedTo,
+	}
+	return revision, tx.Create(&revision).Error
+}
+
+// Book returns the entry of a change to a book.
+func Book(book models.Book, action, actor string) Entry {
+	return Entry{EntityType: EntityBook, EntityID: book.ID, Action: action, Actor: actor, Fields: BookFields(book)}
+}
+
+// Author returns the entry of a change to an author.
+func Author(author models.Author, action, actor string) Entry {
+	return Entry{EntityType: EntityAuthor, EntityID: author.ID, Action: action, Actor: actor, Fields: AuthorFields(author)}
+}
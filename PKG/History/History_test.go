@@ -0,0 +1,42 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookFields(t *testing.T) {
+	fields := BookFields(models.Book{
+		Title:         "The Hobbit",
+		ISBN:          "0261103342",
+		PublishedDate: time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC),
+		Subject:       "Fantasy fiction",
+		AuthorID:      3,
+	})
+
+	assert.Equal(t, "The Hobbit", fields["title"])
+	assert.Equal(t, "1937-09-21T00:00:00Z", fields["publishedDate"])
+	assert.Equal(t, float64(3), fields["authorID"])
+}
+
+func TestDiff(t *testing.T) {
+	before := AuthorFields(models.Author{Name: "John Doe", Email: "john@example.com"})
+	after := AuthorFields(models.Author{Name: "John Doe", Email: "jdoe@example.com"})
+
+	changes := Diff(before, after)
+
+	assert.Len(t, changes, 1)
+	assert.Equal(t, Change{From: "john@example.com", To: "jdoe@example.com"}, changes["email"])
+	assert.Empty(t, Diff(after, after))
+}
+
+func TestDiffCreate(t *testing.T) {
+	changes := Diff(nil, AuthorFields(models.Author{Name: "John Doe", Email: "john@example.com"}))
+
+	assert.Len(t, changes, 2)
+	assert.Nil(t, changes["name"].From)
+	assert.Equal(t, "John Doe", changes["name"].To)
+}
@@ -0,0 +1,196 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	goldap "github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotConfigured      = errors.New("the directory is not configured")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUsernameTaken      = errors.New("the username belongs to a local user")
+)
+
+// Actor of the changes made by the directory in the audit log
+const Actor = "ldap"
+
+// Config of the directory, read from the LDAP_ environment variables
+type Config struct {
+	URL          string // ldap:// or ldaps://
+	StartTLS     bool
+	BindDN       string // the service account searching the directory
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // %s is the escaped username
+	PatronFilter string
+
+	// Attributes of the entries
+	UsernameAttribute string
+	BarcodeAttribute  string
+	NameAttribute     string
+	EmailAttribute    string
+	ExpiresAttribute  string // a generalized time, optional
+}
+
+// Settings returns the configuration of the directory, it is off while LDAP_URL is not set.
+func Settings() Config {
+	return Config{
+		URL:               config.Getenv("LDAP_URL", ""),
+		StartTLS:          config.Getenv("LDAP_START_TLS", "false") == "true",
+		BindDN:            config.Getenv("LDAP_BIND_DN", ""),
+		BindPassword:      config.Getenv("LDAP_BIND_PASSWORD", ""),
+		BaseDN:            config.Getenv("LDAP_BASE_DN", ""),
+		UserFilter:        config.Getenv("LDAP_USER_FILTER", "(&(objectClass=inetOrPerson)(uid=%s))"),
+		PatronFilter:      config.Getenv("LDAP_PATRON_FILTER", "(objectClass=inetOrPerson)"),
+		UsernameAttribute: config.Getenv("LDAP_ATTR_USERNAME", "uid"),
+		BarcodeAttribute:  config.Getenv("LDAP_ATTR_BARCODE", "employeeNumber"),
+		NameAttribute:     config.Getenv("LDAP_ATTR_NAME", "cn"),
+		EmailAttribute:    config.Getenv("LDAP_ATTR_EMAIL", "mail"),
+		ExpiresAttribute:  config.Getenv("LDAP_ATTR_EXPIRES", ""),
+	}
+}
+
+// Enabled tells if the directory is configured.
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+func (c Config) attributes() []string {
+	attributes := []string{c.UsernameAttribute, c.BarcodeAttribute, c.NameAttribute, c.EmailAttribute}
+	if c.ExpiresAttribute != "" {
+		attributes = append(attributes, c.ExpiresAttribute)
+	}
+	return attributes
+}
+
+// ExternalID identifies the users and the patrons of the directory by their username.
+func ExternalID(username string) string {
+	return auth.DirectoryPrefix + username
+}
+
+// Dial connects to the directory and binds as the service account (anonymously when LDAP_BIND_DN is not set).
+func Dial(settings Config) (*goldap.Conn, error) {
+	if !settings.Enabled() {
+		return nil, ErrNotConfigured
+	}
+
+	conn, err := goldap.DialURL(settings.URL, goldap.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(30 * time.Second)
+
+	if settings.StartTLS {
+		u, err := url.Parse(settings.URL)
+		if err == nil {
+			err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if settings.BindDN != "" {
+		if err := conn.Bind(settings.BindDN, settings.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("bind as %s: %w", settings.BindDN, err)
+		}
+	}
+	return conn, nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Authenticate checks a username and password by binding as the user in the directory and returns their user,
+// created on the first login (just-in-time) with the role of LDAP_ROLE and linked to the patron synced from the same entry.
+// created tells if the user is new.
+func Authenticate(tx *gorm.DB, username, password string) (user models.User, created bool, err error) {
+	settings := Settings()
+
+	// An empty password is an unauthenticated bind which succeeds without checking anything (RFC 4513 5.1.2)
+	if username == "" || password == "" {
+		return user, false, ErrInvalidCredentials
+	}
+
+	conn, err := Dial(settings)
+	if err != nil {
+		return user, false, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(goldap.NewSearchRequest(settings.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(settings.UserFilter, goldap.EscapeFilter(username)), settings.attributes(), nil))
+	if err != nil {
+		return user, false, err
+	}
+	if len(result.Entries) != 1 {
+		return user, false, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return user, false, ErrInvalidCredentials
+		}
+		return user, false, err
+	}
+
+	return provision(tx, entry.GetAttributeValue(settings.UsernameAttribute))
+}
+
+func provision(tx *gorm.DB, username string) (user models.User, created bool, err error) {
+	if username == "" {
+		return user, false, ErrInvalidCredentials
+	}
+	externalID := ExternalID(username)
+
+	var role models.Role
+	if err := tx.Where("name = ?", config.Getenv("LDAP_ROLE", auth.RoleMember)).First(&role).Error; err != nil {
+		return user, false, fmt.Errorf("role of LDAP_ROLE: %w", err)
+	}
+
+	// The patron card of the user, when the sync created it
+	var patronID *uint
+	var patron models.Patron
+	if err := tx.Where("external_id = ?", externalID).First(&patron).Error; err == nil {
+		patronID = &patron.ID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, false, err
+	}
+
+	err = tx.Where("external_id = ?", externalID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// A local account is never taken over by a directory user having the same name
+		var existing models.User
+		if err := tx.Where("username = ?", username).First(&existing).Error; err == nil {
+			return user, false, ErrUsernameTaken
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, false, err
+		}
+
+		// No password, it is checked by the directory
+		user = models.User{Username: username, ExternalID: &externalID, RoleID: &role.ID, PatronID: patronID}
+		return user, true, tx.Create(&user).Error
+	} else if err != nil {
+		return user, false, err
+	}
+
+	if patronID != nil && (user.PatronID == nil || *user.PatronID != *patronID) {
+		user.PatronID = patronID
+		if err := tx.Model(&user).Update("patron_id", *patronID).Error; err != nil {
+			return user, false, err
+		}
+	}
+	return user, false, nil
+}
@@ -0,0 +1,63 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockServerSearch(t *testing.T) {
+	server := NewMockServer(
+		MockEntry{DN: "cn=library,dc=example,dc=com", Password: "library"},
+		MockEntry{DN: "uid=jdoe,ou=people,dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"inetOrPerson"}, "uid": {"jdoe"}, "cn": {"John Doe"}}},
+		MockEntry{DN: "uid=asmith,ou=people,dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"inetOrPerson"}, "uid": {"asmith"}}},
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go server.Serve(listener)
+
+	settings := Config{URL: "ldap://" + listener.Addr().String(), BindDN: "cn=library,dc=example,dc=com", BindPassword: "wrong"}
+	_, err = Dial(settings)
+	assert.True(t, goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials))
+
+	settings.BindPassword = "library"
+	conn, err := Dial(settings)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	search := func(filter string) []string {
+		result, err := conn.SearchWithPaging(goldap.NewSearchRequest("ou=people,dc=example,dc=com", goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+			filter, []string{"uid"}, nil), 10)
+		assert.NoError(t, err)
+		var uids []string
+		for _, entry := range result.Entries {
+			uids = append(uids, entry.GetAttributeValue("uid"))
+			assert.Empty(t, entry.GetAttributeValue("cn"))
+		}
+		return uids
+	}
+	assert.Equal(t, []string{"jdoe", "asmith"}, search("(objectClass=inetOrPerson)"))
+	assert.Equal(t, []string{"jdoe"}, search("(&(objectClass=inetOrPerson)(UID=JDOE))"))
+	assert.Equal(t, []string{"asmith"}, search("(!(cn=*))"))
+	assert.Empty(t, search("(|(uid=nobody)(uid=))"))
+}
+
+func TestPatronOf(t *testing.T) {
+	settings := Config{UsernameAttribute: "uid", BarcodeAttribute: "employeeNumber", NameAttribute: "cn", EmailAttribute: "mail", ExpiresAttribute: "description"}
+	entry := goldap.NewEntry("uid=jdoe,dc=example,dc=com", map[string][]string{
+		"uid": {"jdoe"}, "employeeNumber": {"L1001"}, "cn": {"John Doe"}, "description": {"20300101120000Z"},
+	})
+
+	patron, ok := patronOf(settings, entry)
+	assert.True(t, ok)
+	assert.Equal(t, "ldap|jdoe", *patron.ExternalID)
+	assert.Equal(t, time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC), patron.ExpiresAt.UTC())
+
+	// An entry without a barcode is skipped
+	_, ok = patronOf(settings, goldap.NewEntry("uid=asmith,dc=example,dc=com", map[string][]string{"uid": {"asmith"}, "cn": {"Alice Smith"}}))
+	assert.False(t, ok)
+}
@@ -0,0 +1,239 @@
+package ldap
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// MockEntry is an entry of the mock directory, a bind with its DN needs Password (an entry without one can't bind)
+type MockEntry struct {
+	DN         string
+	Attributes map[string][]string
+	Password   string
+}
+
+// MockServer is an LDAP server for the tests and the local development (CMD/MockLdap). It only knows the simple bind and
+// the search with the and, or, not, equality and presence filters, which is what the login and the sync use.
+// The controls (paging) are ignored, every entry is returned at once.
+type MockServer struct {
+	mu      sync.Mutex
+	entries []MockEntry
+}
+
+// NewMockServer returns a server with the given entries.
+func NewMockServer(entries ...MockEntry) *MockServer {
+	return &MockServer{entries: entries}
+}
+
+// SetEntries replaces the entries of the directory.
+func (m *MockServer) SetEntries(entries ...MockEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = entries
+}
+
+// ListenAndServe listens on a TCP address and serves the connections, it only returns on error.
+func (m *MockServer) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return m.Serve(listener)
+}
+
+// Serve serves the connections of listener until it is closed.
+func (m *MockServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go m.serveConn(conn)
+	}
+}
+
+func (m *MockServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		request, err := ber.ReadPacket(reader)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+		id, _ := request.Children[0].Value.(int64)
+		op := request.Children[1]
+
+		var responses []*ber.Packet
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			responses = []*ber.Packet{result(goldap.ApplicationBindResponse, m.bind(op))}
+		case goldap.ApplicationSearchRequest:
+			responses = m.search(op)
+		case goldap.ApplicationUnbindRequest:
+			return
+		case goldap.ApplicationExtendedRequest:
+			// StartTLS and the other extended operations
+			responses = []*ber.Packet{result(goldap.ApplicationExtendedResponse, goldap.LDAPResultUnwillingToPerform)}
+		default:
+			return
+		}
+
+		for _, response := range responses {
+			message := ber.NewSequence("LDAP Response")
+			message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+			message.AppendChild(response)
+			if _, err := conn.Write(message.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind returns the result code of a simple bind, an empty name and password is an anonymous bind.
+func (m *MockServer) bind(op *ber.Packet) int {
+	if len(op.Children) < 3 {
+		return goldap.LDAPResultProtocolError
+	}
+	name, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+	if name == "" && password == "" {
+		return goldap.LDAPResultSuccess
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.entries {
+		if strings.EqualFold(entry.DN, name) && entry.Password != "" && entry.Password == password {
+			return goldap.LDAPResultSuccess
+		}
+	}
+	return goldap.LDAPResultInvalidCredentials
+}
+
+func (m *MockServer) search(op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(goldap.ApplicationSearchResultDone, goldap.LDAPResultProtocolError)}
+	}
+	base := strings.ToLower(op.Children[0].Data.String())
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var requested []string
+	for _, attribute := range op.Children[7].Children {
+		requested = append(requested, attribute.Data.String())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var responses []*ber.Packet
+	for _, entry := range m.entries {
+		if !inScope(strings.ToLower(entry.DN), base, scope) || !matches(entry, filter) {
+			continue
+		}
+
+		response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+		attributes := ber.NewSequence("Attributes")
+		for name, values := range entry.Attributes {
+			if !wanted(name, requested) {
+				continue
+			}
+			attribute := ber.NewSequence("Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		response.AppendChild(attributes)
+		responses = append(responses, response)
+	}
+	return append(responses, result(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess))
+}
+
+// result returns an LDAPResult without message
+func result(tag ber.Tag, code int) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return packet
+}
+
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case goldap.ScopeBaseObject:
+		return dn == base
+	case goldap.ScopeSingleLevel:
+		parent := ""
+		if i := strings.Index(dn, ","); i >= 0 {
+			parent = dn[i+1:]
+		}
+		return parent == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+func wanted(name string, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, r := range requested {
+		if r == "*" || strings.EqualFold(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches evaluates a filter on an entry, the names and the values are compared without case.
+func matches(entry MockEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case goldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range values(entry, filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterPresent:
+		return len(values(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func values(entry MockEntry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
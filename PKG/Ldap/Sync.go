@@ -0,0 +1,211 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	audit "github.com/Pyramakerz/Library_Management_System/PKG/Audit"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ErrNoEntries is returned when the patron filter matches nothing, the patrons are left as they are
+var ErrNoEntries = errors.New("the directory returned no patron, nothing is synced")
+
+// Entity type of the patrons in the audit log
+const entityPatron = "patron"
+
+// Number of entries read at once from the directory
+const pageSize = 500
+
+// Synced counts the patrons changed by a sync, the skipped entries miss an attribute or use the barcode of another patron
+type Synced struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Expired int `json:"expired"`
+	Skipped int `json:"skipped"`
+}
+
+// Interval is the time between two syncs, set in minutes with LDAP_SYNC_INTERVAL_MINUTES (0 turns the scheduled sync off).
+func Interval() time.Duration {
+	minutes, err := strconv.Atoi(config.Getenv("LDAP_SYNC_INTERVAL_MINUTES", "60"))
+	if err != nil || minutes < 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Sync creates and updates the patrons of the entries of LDAP_PATRON_FILTER and expires the patrons whose entry is gone.
+// An expired patron can't borrow anymore, the patron comes back when the entry does. The patrons deleted in the API are left alone.
+func Sync(tx *gorm.DB, now time.Time) (Synced, error) {
+	var synced Synced
+	settings := Settings()
+
+	conn, err := Dial(settings)
+	if err != nil {
+		return synced, err
+	}
+	defer conn.Close()
+
+	result, err := conn.SearchWithPaging(goldap.NewSearchRequest(settings.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		settings.PatronFilter, settings.attributes(), nil), pageSize)
+	if err != nil {
+		return synced, err
+	}
+	// A wrong filter or base DN must not expire every patron
+	if len(result.Entries) == 0 {
+		return synced, ErrNoEntries
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range result.Entries {
+		patron, ok := patronOf(settings, entry)
+		if !ok {
+			synced.Skipped++
+			continue
+		}
+		seen[*patron.ExternalID] = true
+
+		action, err := syncPatron(tx, patron)
+		if err != nil {
+			fmt.Printf("Failed to sync the patron %s: %v\n", entry.DN, err)
+			synced.Skipped++
+			continue
+		}
+		switch action {
+		case history.ActionCreate:
+			synced.Created++
+		case history.ActionUpdate:
+			synced.Updated++
+		}
+	}
+
+	var patrons []models.Patron
+	if err := tx.Where("external_id LIKE ? AND (expires_at IS NULL OR expires_at > ?)", ExternalID("%"), now).Find(&patrons).Error; err != nil {
+		return synced, err
+	}
+	for _, patron := range patrons {
+		if seen[*patron.ExternalID] {
+			continue
+		}
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			previous := patron
+			patron.ExpiresAt = &now
+			if err := tx.Model(&patron).Update("expires_at", now).Error; err != nil {
+				return err
+			}
+			return record(tx, history.ActionUpdate, patron.ID, previous, patron)
+		})
+		if err != nil {
+			return synced, err
+		}
+		synced.Expired++
+	}
+	return synced, nil
+}
+
+// patronOf returns the patron of an entry, ok is false when it has no username, barcode or name.
+func patronOf(settings Config, entry *goldap.Entry) (models.Patron, bool) {
+	username := entry.GetAttributeValue(settings.UsernameAttribute)
+	patron := models.Patron{
+		Barcode: entry.GetAttributeValue(settings.BarcodeAttribute),
+		Name:    entry.GetAttributeValue(settings.NameAttribute),
+		Email:   entry.GetAttributeValue(settings.EmailAttribute),
+	}
+	if username == "" || patron.Barcode == "" || patron.Name == "" {
+		return patron, false
+	}
+	externalID := ExternalID(username)
+	patron.ExternalID = &externalID
+
+	if settings.ExpiresAttribute != "" {
+		if value := entry.GetAttributeValue(settings.ExpiresAttribute); value != "" {
+			expiresAt, err := ber.ParseGeneralizedTime([]byte(value))
+			if err != nil {
+				return patron, false
+			}
+			patron.ExpiresAt = &expiresAt
+		}
+	}
+	return patron, true
+}
+
+// syncPatron saves the patron of an entry, the returned action is empty when nothing changed.
+func syncPatron(tx *gorm.DB, patron models.Patron) (string, error) {
+	action := ""
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var existing models.Patron
+		err := tx.Unscoped().Where("external_id = ?", *patron.ExternalID).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if existing.DeletedAt.Valid {
+			return nil
+		}
+
+		var conflicting models.Patron
+		if err := tx.Unscoped().Where("barcode = ? AND id <> ?", patron.Barcode, existing.ID).First(&conflicting).Error; err == nil {
+			return fmt.Errorf("the barcode %s belongs to the patron %d", patron.Barcode, conflicting.ID)
+		}
+
+		if existing.ID == 0 {
+			action = history.ActionCreate
+			if err := tx.Create(&patron).Error; err != nil {
+				return err
+			}
+			return record(tx, action, patron.ID, nil, patron)
+		}
+
+		if existing.Barcode == patron.Barcode && existing.Name == patron.Name && existing.Email == patron.Email && sameTime(existing.ExpiresAt, patron.ExpiresAt) {
+			return nil
+		}
+		action = history.ActionUpdate
+		updated := existing
+		updated.Barcode, updated.Name, updated.Email, updated.ExpiresAt = patron.Barcode, patron.Name, patron.Email, patron.ExpiresAt
+		err = tx.Model(&existing).Select("barcode", "name", "email", "expires_at").Updates(&updated).Error
+		if err != nil {
+			return err
+		}
+		return record(tx, action, existing.ID, existing, updated)
+	})
+	return action, err
+}
+
+func record(tx *gorm.DB, action string, patronID uint, before, after any) error {
+	_, err := audit.Record(tx, audit.Entry{Actor: Actor, Action: action, EntityType: entityPatron, EntityID: patronID, Before: before, After: after})
+	return err
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Schedule syncs the patrons now and then every Interval() in the background, nothing is done when the directory is not configured.
+func Schedule(db *gorm.DB) {
+	interval := Interval()
+	if !Settings().Enabled() || interval == 0 {
+		return
+	}
+
+	go func() {
+		for {
+			synced, err := Sync(db, time.Now())
+			if err != nil {
+				fmt.Printf("Failed to sync the patrons from the directory: %v\n", err)
+			} else if synced != (Synced{}) {
+				fmt.Printf("Synced the patrons from the directory: %d created, %d updated, %d expired, %d skipped\n",
+					synced.Created, synced.Updated, synced.Expired, synced.Skipped)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
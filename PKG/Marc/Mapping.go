@@ -0,0 +1,127 @@
+package marc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+)
+
+// BookFields are the catalog fields found in a bibliographic record:
+// 020 $a ==> ISBN, 100 $a ==> Author name, 245 $a $b ==> Title, 264 $c (or 260 $c, or 008/07-10) ==> Published date,
+// 650 $a ==> Subject (the first topical term, it is optional).
+type BookFields struct {
+	Title         string
+	ISBN          string
+	PublishedDate time.Time
+	Subject       string
+	AuthorName    string
+}
+
+var yearRegex = regexp.MustCompile(`\d{4}`)
+
+// ToBook maps a record to the book fields, it fails when a field required by models.Book is missing.
+func ToBook(r *Record) (BookFields, error) {
+	var fields BookFields
+
+	if r == nil {
+		return fields, errors.New("empty record")
+	}
+
+	title := r.Field("245")
+	fields.Title = trimPunctuation(title.Subfield('a'))
+	if remainder := trimPunctuation(title.Subfield('b')); remainder != "" {
+		fields.Title += ": " + remainder
+	}
+	if fields.Title == "" {
+		return fields, errors.New("245 $a (title) is missing")
+	}
+	if len(fields.Title) > 100 {
+		return fields, errors.New("245 (title) is longer than 100 characters")
+	}
+
+	// 020 $a may be followed by a qualifier ==> "9780261103344 (pbk.)"
+	if isbn := strings.Fields(r.Field("020").Subfield('a')); len(isbn) > 0 {
+		fields.ISBN = isbn[0]
+	}
+	if fields.ISBN == "" {
+		return fields, errors.New("020 $a (ISBN) is missing")
+	}
+
+	author := r.Field("100")
+	fields.AuthorName = trimPunctuation(author.Subfield('a'))
+	if fields.AuthorName == "" {
+		return fields, errors.New("100 $a (main entry personal name) is missing")
+	}
+	// Indicator 1 = surname first ==> "Tolkien, J. R. R." is stored as "J. R. R. Tolkien"
+	if author.Ind1 == '1' {
+		if surname, forename, ok := strings.Cut(fields.AuthorName, ", "); ok {
+			fields.AuthorName = forename + " " + surname
+		}
+	}
+
+	fields.Subject = strings.TrimSuffix(trimPunctuation(r.Field("650").Subfield('a')), ".")
+
+	date := r.Field("264").Subfield('c')
+	if date == "" {
+		date = r.Field("260").Subfield('c')
+	}
+	if date == "" {
+		if fixed := r.Control("008"); len(fixed) >= 11 {
+			date = fixed[7:11]
+		}
+	}
+	year, err := strconv.Atoi(yearRegex.FindString(date))
+	if err != nil {
+		return fields, errors.New("264 $c (date of publication) is missing")
+	}
+	fields.PublishedDate = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	return fields, nil
+}
+
+// FromBook builds the bibliographic record of a book, its Author must be preloaded.
+func FromBook(book models.Book) *Record {
+	year := book.PublishedDate.Year()
+
+	record := &Record{Leader: DefaultLeader}
+	record.ControlFields = []ControlField{
+		{Tag: "001", Value: strconv.FormatUint(uint64(book.ID), 10)},
+		// 008 ==> date entered, single known date, year, unknown place, no attempt to code, undetermined language
+		{Tag: "008", Value: fmt.Sprintf("%ss%04d    xx |||||||||||||||||und d", time.Now().Format("060102"), year)},
+	}
+
+	record.DataFields = []DataField{
+		{Tag: "020", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: book.ISBN}}},
+	}
+
+	if book.Author.Name != "" {
+		ind1, name := byte('0'), book.Author.Name
+		// "John Doe" ==> "Doe, John"
+		if i := strings.LastIndex(name, " "); i > 0 {
+			ind1, name = '1', name[i+1:]+", "+name[:i]
+		}
+		record.DataFields = append(record.DataFields, DataField{Tag: "100", Ind1: ind1, Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: name}}})
+	}
+
+	record.DataFields = append(record.DataFields,
+		DataField{Tag: "245", Ind1: '1', Ind2: '0', Subfields: []Subfield{{Code: 'a', Value: book.Title}}},
+		DataField{Tag: "264", Ind1: ' ', Ind2: '1', Subfields: []Subfield{{Code: 'c', Value: strconv.Itoa(year)}}},
+	)
+
+	if book.Subject != "" {
+		// Indicator 2 = 4 ==> source of the heading not specified
+		record.DataFields = append(record.DataFields, DataField{Tag: "650", Ind1: ' ', Ind2: '4', Subfields: []Subfield{{Code: 'a', Value: book.Subject}}})
+	}
+
+	return record
+}
+
+// trimPunctuation removes the ISBD punctuation ending a subfield ==> "The hobbit :" becomes "The hobbit".
+func trimPunctuation(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;,="))
+}
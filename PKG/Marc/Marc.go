@@ -0,0 +1,236 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ISO 2709 separators
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+const (
+	leaderLength   = 24
+	directoryEntry = 12
+	// DefaultLeader is a leader of a new bibliographic record (n = new, a = language material, m = monograph, a = UTF-8)
+	// the lengths and the base address are computed when the record is written.
+	DefaultLeader = "00000nam a2200000 i 4500"
+)
+
+// Record is one MARC21 bibliographic record.
+type Record struct {
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+// ControlField is a field from 001 to 009, it has no indicators nor subfields.
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+type DataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Field returns the first data field having this tag or nil.
+func (r *Record) Field(tag string) *DataField {
+	for i := range r.DataFields {
+		if r.DataFields[i].Tag == tag {
+			return &r.DataFields[i]
+		}
+	}
+	return nil
+}
+
+// Control returns the value of the control field having this tag or "".
+func (r *Record) Control(tag string) string {
+	for _, f := range r.ControlFields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Subfield returns the value of the first subfield having this code or "".
+func (f *DataField) Subfield(code byte) string {
+	if f == nil {
+		return ""
+	}
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// ReadISO2709 reads all the records of an ISO 2709 stream.
+// A record that cannot be decoded doesn't stop the reading, its error is returned at the same position in errs.
+func ReadISO2709(r io.Reader) (records []*Record, errs []error) {
+	br := bufio.NewReader(r)
+
+	for {
+		raw, err := br.ReadBytes(recordTerminator)
+		raw = bytes.TrimLeft(raw, "\r\n ")
+		if len(raw) > 0 {
+			record, decodeErr := decodeISO2709(raw)
+			records = append(records, record)
+			errs = append(errs, decodeErr)
+		}
+		if err != nil {
+			// io.EOF or a read error, in both cases nothing more can be read
+			if !errors.Is(err, io.EOF) {
+				records = append(records, nil)
+				errs = append(errs, err)
+			}
+			return records, errs
+		}
+	}
+}
+
+func decodeISO2709(raw []byte) (*Record, error) {
+	if len(raw) < leaderLength+1 {
+		return nil, errors.New("record is shorter than its leader")
+	}
+
+	leader := string(raw[:leaderLength])
+	baseAddress, ok := number(leader[12:17])
+	if !ok || baseAddress <= leaderLength || baseAddress > len(raw) {
+		return nil, fmt.Errorf("invalid base address %q", leader[12:17])
+	}
+
+	directory := raw[leaderLength : baseAddress-1]
+	if len(directory)%directoryEntry != 0 {
+		return nil, errors.New("invalid directory length")
+	}
+
+	record := &Record{Leader: leader}
+	for i := 0; i < len(directory); i += directoryEntry {
+		entry := string(directory[i : i+directoryEntry])
+		tag := entry[:3]
+		length, ok1 := number(entry[3:7])
+		start, ok2 := number(entry[7:12])
+		if !ok1 || !ok2 || length < 1 {
+			return nil, fmt.Errorf("invalid directory entry %q", entry)
+		}
+		end := baseAddress + start + length
+		if end > len(raw) {
+			return nil, fmt.Errorf("directory entry %q points past the end of the record", entry)
+		}
+
+		// Remove the field terminator
+		data := bytes.TrimSuffix(raw[baseAddress+start:end], []byte{fieldTerminator})
+
+		if isControlTag(tag) {
+			record.ControlFields = append(record.ControlFields, ControlField{Tag: tag, Value: string(data)})
+			continue
+		}
+
+		if len(data) < 2 {
+			return nil, fmt.Errorf("field %s has no indicators", tag)
+		}
+		field := DataField{Tag: tag, Ind1: data[0], Ind2: data[1]}
+		for _, part := range bytes.Split(data[2:], []byte{subfieldDelimiter}) {
+			if len(part) == 0 {
+				continue
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: part[0], Value: string(part[1:])})
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+
+	return record, nil
+}
+
+// number parses a fixed width numeric field of the leader or the directory, only ASCII digits are allowed
+// (strconv.Atoi would also take a sign, so "-0001" would make a negative start).
+func number(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// WriteISO2709 writes the records in ISO 2709, the lengths and addresses of the leader are recomputed.
+func WriteISO2709(w io.Writer, records ...*Record) error {
+	for _, r := range records {
+		if _, err := w.Write(encodeISO2709(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeISO2709(r *Record) []byte {
+	var directory, data bytes.Buffer
+
+	addField := func(tag string, content []byte) {
+		content = append(content, fieldTerminator)
+		fmt.Fprintf(&directory, "%3s%04d%05d", tag, len(content), data.Len())
+		data.Write(content)
+	}
+
+	for _, f := range r.ControlFields {
+		addField(f.Tag, []byte(f.Value))
+	}
+	for _, f := range r.DataFields {
+		content := []byte{f.indicator(f.Ind1), f.indicator(f.Ind2)}
+		for _, s := range f.Subfields {
+			content = append(content, subfieldDelimiter, s.Code)
+			content = append(content, s.Value...)
+		}
+		addField(f.Tag, content)
+	}
+	directory.WriteByte(fieldTerminator)
+
+	leader := r.Leader
+	if len(leader) != leaderLength {
+		leader = DefaultLeader
+	}
+	baseAddress := leaderLength + directory.Len()
+	recordLength := baseAddress + data.Len() + 1
+
+	out := make([]byte, 0, recordLength)
+	out = fmt.Appendf(out, "%05d%s%05d%s", recordLength, leader[5:12], baseAddress, leader[17:])
+	out = append(out, directory.Bytes()...)
+	out = append(out, data.Bytes()...)
+	return append(out, recordTerminator)
+}
+
+func (f *DataField) indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
+
+func isControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
@@ -0,0 +1,145 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// Namespace of MARCXML (http://www.loc.gov/standards/marcxml/)
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"collection"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Xmlns         string            `xml:"xmlns,attr,omitempty"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadMARCXML reads a MARCXML document, its root can be a <collection> or a single <record>.
+func ReadMARCXML(r io.Reader) ([]*Record, error) {
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("no MARCXML record found")
+			}
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "collection":
+			var collection xmlCollection
+			if err := decoder.DecodeElement(&collection, &start); err != nil {
+				return nil, err
+			}
+			records := make([]*Record, 0, len(collection.Records))
+			for _, x := range collection.Records {
+				records = append(records, x.toRecord())
+			}
+			return records, nil
+		case "record":
+			var x xmlRecord
+			if err := decoder.DecodeElement(&x, &start); err != nil {
+				return nil, err
+			}
+			return []*Record{x.toRecord()}, nil
+		default:
+			return nil, errors.New("root element must be a MARCXML collection or record")
+		}
+	}
+}
+
+// WriteMARCXML writes the records as a MARCXML <collection>.
+func WriteMARCXML(w io.Writer, records ...*Record) error {
+	if _, err := io.WriteString(w, xml.Header+`<collection xmlns="`+Namespace+`">`); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	for _, r := range records {
+		if err := encoder.Encode(ToXML(r)); err != nil {
+			return err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "</collection>")
+	return err
+}
+
+// ToXML returns the record as a value that can be encoded with encoding/xml,
+// it is used to embed MARCXML inside other XML documents.
+func ToXML(r *Record) any {
+	leader := r.Leader
+	if len(leader) != leaderLength {
+		leader = DefaultLeader
+	}
+
+	x := xmlRecord{Xmlns: Namespace, Leader: leader}
+	for _, f := range r.ControlFields {
+		x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+	}
+	for _, f := range r.DataFields {
+		d := xmlDataField{Tag: f.Tag, Ind1: string(f.indicator(f.Ind1)), Ind2: string(f.indicator(f.Ind2))}
+		for _, s := range f.Subfields {
+			d.Subfields = append(d.Subfields, xmlSubfield{Code: string(s.Code), Value: s.Value})
+		}
+		x.DataFields = append(x.DataFields, d)
+	}
+	return x
+}
+
+func (x xmlRecord) toRecord() *Record {
+	r := &Record{Leader: x.Leader}
+	for _, f := range x.ControlFields {
+		r.ControlFields = append(r.ControlFields, ControlField{Tag: f.Tag, Value: f.Value})
+	}
+	for _, f := range x.DataFields {
+		d := DataField{Tag: f.Tag, Ind1: firstByte(f.Ind1), Ind2: firstByte(f.Ind2)}
+		for _, s := range f.Subfields {
+			d.Subfields = append(d.Subfields, Subfield{Code: firstByte(s.Code), Value: s.Value})
+		}
+		r.DataFields = append(r.DataFields, d)
+	}
+	return r
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
@@ -0,0 +1,115 @@
+package marc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleBook() models.Book {
+	return models.Book{
+		ID:            7,
+		Title:         "The Hobbit",
+		ISBN:          "9780261103344",
+		PublishedDate: time.Date(1937, time.September, 21, 0, 0, 0, 0, time.UTC),
+		Subject:       "Fantasy fiction",
+		Author:        models.Author{Name: "J. R. R. Tolkien"},
+	}
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteISO2709(&buf, FromBook(sampleBook()), FromBook(sampleBook()))
+	assert.NoError(t, err)
+
+	records, errs := ReadISO2709(&buf)
+
+	assert.Len(t, records, 2)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+
+	fields, err := ToBook(records[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "The Hobbit", fields.Title)
+	assert.Equal(t, "9780261103344", fields.ISBN)
+	assert.Equal(t, "J. R. R. Tolkien", fields.AuthorName)
+	assert.Equal(t, 1937, fields.PublishedDate.Year())
+	assert.Equal(t, "Fantasy fiction", fields.Subject)
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMARCXML(&buf, FromBook(sampleBook()))
+	assert.NoError(t, err)
+
+	records, err := ReadMARCXML(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	fields, err := ToBook(records[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "The Hobbit", fields.Title)
+	assert.Equal(t, "J. R. R. Tolkien", fields.AuthorName)
+}
+
+func TestToBookFromCatalogingRecord(t *testing.T) {
+	doc := `<record xmlns="http://www.loc.gov/MARC21/slim">
+		<leader>00000cam a2200000 i 4500</leader>
+		<controlfield tag="008">970121s1937    enk           000 1 eng d</controlfield>
+		<datafield tag="020" ind1=" " ind2=" "><subfield code="a">0261103342 (pbk.)</subfield></datafield>
+		<datafield tag="100" ind1="1" ind2=" "><subfield code="a">Tolkien, J. R. R.,</subfield></datafield>
+		<datafield tag="245" ind1="1" ind2="4"><subfield code="a">The hobbit :</subfield><subfield code="b">or there and back again /</subfield></datafield>
+	</record>`
+
+	records, err := ReadMARCXML(strings.NewReader(doc))
+	assert.NoError(t, err)
+
+	fields, err := ToBook(records[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "The hobbit: or there and back again", fields.Title)
+	assert.Equal(t, "0261103342", fields.ISBN)
+	assert.Equal(t, "J. R. R. Tolkien", fields.AuthorName)
+	assert.Equal(t, 1937, fields.PublishedDate.Year())
+}
+
+func TestToBookMissingTitle(t *testing.T) {
+	record := &Record{DataFields: []DataField{{Tag: "020", Subfields: []Subfield{{Code: 'a', Value: "123"}}}}}
+
+	_, err := ToBook(record)
+
+	assert.Error(t, err)
+}
+
+func TestReadISO2709InvalidRecord(t *testing.T) {
+	records, errs := ReadISO2709(strings.NewReader("not a marc record\x1d"))
+
+	assert.Len(t, records, 1)
+	assert.Error(t, errs[0])
+}
+
+func TestReadISO2709MalformedDirectory(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteISO2709(&buf, FromBook(sampleBook())))
+	valid := buf.Bytes()
+
+	// The first directory entry starts right after the leader: tag (3), length (4), start (5)
+	for name, entry := range map[string]string{
+		"signed length":  "001+01000000",
+		"negative start": "0010010-0001",
+		"zero length":    "001000000000",
+		"past the end":   "001999900000",
+		"letters":        "0010010000a0",
+	} {
+		raw := append([]byte{}, valid...)
+		copy(raw[leaderLength:], entry)
+
+		records, errs := ReadISO2709(bytes.NewReader(raw))
+
+		assert.Len(t, records, 1, name)
+		assert.Error(t, errs[0], name)
+	}
+}
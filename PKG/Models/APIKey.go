@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey gives an integration (discovery layer, kiosks) access to the API without a user, only the SHA-256 of the key is stored.
+// Its scopes give it the permissions of the routes, see auth.ScopePermissions.
+type APIKey struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"type:varchar(100);not null" json:"name"`
+	// Prefix ==> the first characters of the key to recognize it in the list, the rest is never shown again after its creation
+	Prefix  string `gorm:"type:varchar(16);not null" json:"prefix"`
+	KeyHash string `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	// Scopes ==> separated by spaces like the OAuth scopes
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	// CreatedBy ==> the user who issued the key, nil when it was issued with another API key or the user is deleted
+	CreatedBy *uint     `gorm:"index" json:"createdBy"`
+	Creator   *User     `gorm:"foreignKey:CreatedBy;constraint:OnDelete:SET NULL;" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
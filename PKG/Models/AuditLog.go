@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogAppendOnly is returned by GORM when an audit log is updated or deleted
+var ErrAuditLogAppendOnly = errors.New("audit logs are append-only")
+
+// AuditLog is one mutating API call, every log is chained to the previous one by its hash so that a changed or removed row is detected.
+type AuditLog struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Actor      string `gorm:"type:varchar(100);not null;index" json:"actor"`
+	Action     string `gorm:"type:varchar(20);not null;index" json:"action"`
+	EntityType string `gorm:"type:varchar(20);not null;index:idx_audit_entity" json:"entityType"`
+	EntityID   uint   `gorm:"not null;index:idx_audit_entity" json:"entityID"`
+	// Before ==> the record before the call (null on create), After ==> the record after the call (null on delete)
+	Before    json.RawMessage `gorm:"type:text" json:"before"`
+	After     json.RawMessage `gorm:"type:text" json:"after"`
+	RequestID string          `gorm:"type:varchar(100);index" json:"requestID"`
+	IP        string          `gorm:"type:varchar(45)" json:"ip"`
+	CreatedAt time.Time       `gorm:"index" json:"createdAt"`
+	// PrevHash ==> Hash of the previous log (empty for the first one), Hash ==> SHA-256 of this log and PrevHash
+	PrevHash string `gorm:"type:char(64);not null" json:"prevHash"`
+	Hash     string `gorm:"type:char(64);not null;uniqueIndex" json:"hash"`
+}
+
+// The logs can only be created, raw SQL is still possible and is what the hash chain detects
+func (*AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func (*AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
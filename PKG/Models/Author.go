@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -10,5 +12,8 @@ type Author struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
 	Name      string         `gorm:"type:varchar(100);not null" json:"name"`
 	Email     string         `gorm:"type:varchar(100);uniqueIndex;not null" json:"email"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// CreatedAt and UpdatedAt ==> GORM sets them on Create() and Save() because of their names
 }
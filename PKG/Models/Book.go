@@ -8,13 +8,18 @@ import (
 
 type Book struct {
 	// uint ==> unsigned integer, It can store positive values and zero.
-	ID            uint           `gorm:"primaryKey" json:"id"`
-	Title         string         `gorm:"type:varchar(100);not null" json:"title"`
-	ISBN          string         `gorm:"type:varchar(100);uniqueIndex;not null" json:"isbn"`
-	PublishedDate time.Time      `gorm:"not null" json:"publishedDate"`
-	AuthorID      uint           `gorm:"not null" json:"authorID"`
-	Author        Author         `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE;" json:"author"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Title         string    `gorm:"type:varchar(100);not null" json:"title"`
+	ISBN          string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"isbn"`
+	PublishedDate time.Time `gorm:"not null" json:"publishedDate"`
+	Subject       string    `gorm:"type:varchar(100);index" json:"subject"`
+	AuthorID      uint      `gorm:"not null" json:"authorID"`
+	Author        Author    `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE;" json:"author"`
+	CreatedAt     time.Time `gorm:"index" json:"createdAt"`
+	UpdatedAt     time.Time `gorm:"index" json:"updatedAt"`
+	// CreatedAt ==> GORM sets it on Create(), it is the acquisition date of the book (new arrivals and feeds)
+	// UpdatedAt ==> GORM sets it on every Create() and Save(), it is the datestamp of the record for the harvesters (OAI-PMH)
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	// for handling soft deletes
 	// When a record is "deleted," the current timestamp is set in the Time field, and the Valid field is set to true. Records with a Valid value of false are considered not deleted.
 	// json:"-"` ==> to ignore this field when marshalling or unmarshalling JSON.
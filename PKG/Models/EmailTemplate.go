@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailTemplate replaces the built-in template of a notice in a language, it is edited by the admins with /api/template.
+// Removing it brings the built-in template back.
+type EmailTemplate struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"type:varchar(100);not null;uniqueIndex:idx_email_template" json:"name"`
+	// Language ==> a lowercase language tag like en or pt-br
+	Language  string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_email_template" json:"language"`
+	Subject   string    `gorm:"type:varchar(255);not null;default:''" json:"subject"`
+	Text      string    `gorm:"type:text;not null" json:"text"`
+	HTML      string    `gorm:"type:text" json:"html"`
+	UpdatedBy string    `gorm:"type:varchar(100)" json:"updatedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
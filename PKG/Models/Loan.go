@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+type Loan struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	BookID       uint      `gorm:"not null;index" json:"bookID"`
+	Book         Book      `gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE;" json:"book"`
+	PatronID     uint      `gorm:"not null;index" json:"patronID"`
+	Patron       Patron    `gorm:"foreignKey:PatronID;constraint:OnDelete:CASCADE;" json:"patron"`
+	CheckedOutAt time.Time `gorm:"not null" json:"checkedOutAt"`
+	DueAt        time.Time `gorm:"not null" json:"dueAt"`
+	// ReturnedAt ==> nil while the book is checked out, a book has at most one loan that isn't returned
+	ReturnedAt *time.Time `gorm:"index" json:"returnedAt"`
+	Renewals   int        `gorm:"not null;default:0" json:"renewals"`
+	// DueSoonNoticeAt, OverdueNoticeAt ==> when the notices were written to the outbox, cleared by a renewal
+	DueSoonNoticeAt *time.Time `json:"dueSoonNoticeAt"`
+	OverdueNoticeAt *time.Time `json:"overdueNoticeAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginState is a single sign-on login on its way through the identity provider, it is deleted when the user comes back.
+// The state in the URL finds it again, the nonce is checked in the ID token and the PKCE verifier never leaves the server.
+type LoginState struct {
+	ID           uint      `gorm:"primaryKey"`
+	State        string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Nonce        string    `gorm:"type:varchar(64);not null"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxMessage is a notification written in the transaction of the change it tells about, the outbox worker sends it afterwards.
+// A rolled back change is never notified and a message is not lost while the mail server is down, it is retried with a growing delay
+// and dead-lettered after the last attempt.
+type OutboxMessage struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Template string `gorm:"type:varchar(100);not null" json:"template"`
+	// Recipients ==> the email addresses separated by commas
+	Recipients string `gorm:"type:text;not null" json:"recipients"`
+	Subject    string `gorm:"type:varchar(255);not null" json:"subject"`
+	Body       string `gorm:"type:text;not null" json:"body"`
+	// HTML ==> the HTML version of Body, empty for a plain text message
+	HTML string `gorm:"type:text" json:"html"`
+	// Status ==> pending until it is sent, dead once every attempt failed (see the outbox package)
+	Status   string `gorm:"type:varchar(20);not null;index:idx_outbox_due" json:"status"`
+	Attempts int    `gorm:"not null;default:0" json:"attempts"`
+	// NextAttemptAt ==> when a pending message is sent, pushed back after each failure and while a worker is sending it
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_due" json:"nextAttemptAt"`
+	LastError     string     `gorm:"type:text" json:"lastError"`
+	SentAt        *time.Time `json:"sentAt"`
+	CreatedAt     time.Time  `gorm:"index" json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
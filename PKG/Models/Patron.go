@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Patron struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	Barcode string `gorm:"type:varchar(100);uniqueIndex;not null" json:"barcode"`
+	Name    string `gorm:"type:varchar(100);not null" json:"name"`
+	Email   string `gorm:"type:varchar(100)" json:"email"`
+	// Language ==> the language of the notices sent to the patron, a tag like en or pt-br (the default language when it is empty)
+	Language string `gorm:"type:varchar(20);not null;default:''" json:"language"`
+	// PinHash ==> bcrypt hash of the PIN typed at the self-checkout kiosks, it is never sent back
+	PinHash string `gorm:"type:varchar(100)" json:"-"`
+	Blocked bool   `gorm:"not null;default:false" json:"blocked"`
+	// ExternalID ==> the username of a patron synced from the directory (LDAP), nil for a patron created in the API
+	ExternalID *string `gorm:"type:varchar(255);uniqueIndex" json:"externalID"`
+	// ExpiresAt ==> the patron can't borrow nor renew from then on, set by the directory sync
+	ExpiresAt *time.Time     `json:"expiresAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimitBucket is the token bucket of a client when the rate limits are shared in the database (RATE_LIMIT_STORE=database).
+// Key is the class, the ID of the client and the budget, like "user:5:write".
+type RateLimitBucket struct {
+	Key    string  `gorm:"column:bucket_key;type:varchar(191);primaryKey" json:"key"`
+	Tokens float64 `gorm:"not null" json:"tokens"`
+	// UpdatedAt ==> when Tokens were counted, set by the store
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false;not null" json:"updatedAt"`
+	// FullAt ==> when the bucket is full again, it can be removed from then on
+	FullAt time.Time `gorm:"not null;index" json:"fullAt"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a long-lived token exchanged for a new access token, only the SHA-256 of the token is stored.
+// A token is used once, the refresh revokes it and issues the next one of the same family.
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"not null;index" json:"userID"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	TokenHash string `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	// Family ==> the tokens rotated from the same login, a revoked token used again revokes the whole family (it was stolen)
+	Family    string     `gorm:"type:char(32);not null;index" json:"family"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Revision is a version of a book or an author, a new one is recorded for every change.
+type Revision struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	EntityType string `gorm:"type:varchar(20);not null;uniqueIndex:idx_revision_version" json:"entityType"`
+	EntityID   uint   `gorm:"not null;uniqueIndex:idx_revision_version" json:"entityID"`
+	Version    int    `gorm:"not null;uniqueIndex:idx_revision_version" json:"version"`
+	Action     string `gorm:"type:varchar(20);not null" json:"action"`
+	Actor      string `gorm:"type:varchar(100);not null" json:"actor"`
+	// Changes ==> {"title": {"from": "Old", "to": "New"}}, Snapshot ==> the fields of the record after the change
+	Changes    json.RawMessage `gorm:"type:text" json:"changes"`
+	Snapshot   json.RawMessage `gorm:"type:text" json:"snapshot"`
+	RevertedTo int             `gorm:"not null;default:0" json:"revertedTo,omitempty"`
+	CreatedAt  time.Time       `gorm:"index" json:"createdAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// Role is given to users, its permissions are the actions they can do on the API
+type Role struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	// RequireTwoFactor ==> the users of the role can't use their permissions before they enroll in two-factor authentication
+	RequireTwoFactor bool         `gorm:"not null;default:false" json:"requireTwoFactor"`
+	Permissions      []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE;" json:"permissions"`
+}
+
+// Permission is checked by the routes, its name is one of the auth.Perm constants
+type Permission struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+}
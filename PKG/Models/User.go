@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// User is an account of the API, the members, librarians and admins log in with it to get their tokens
+type User struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"type:varchar(100);uniqueIndex;not null" json:"username"`
+	// PasswordHash ==> bcrypt hash of the password, it is never sent back
+	PasswordHash string `gorm:"type:varchar(100);not null" json:"-"`
+	Disabled     bool   `gorm:"not null;default:false" json:"disabled"`
+	// TotpSecret ==> base32 secret of the authenticator app (two-factor authentication), set on enrollment and used once TotpEnabled
+	TotpSecret  string `gorm:"type:varchar(64);not null;default:''" json:"-"`
+	TotpEnabled bool   `gorm:"not null;default:false" json:"totpEnabled"`
+	// TotpLastStep ==> time step of the last accepted code, a code can't be used twice
+	TotpLastStep int64 `gorm:"not null;default:0" json:"-"`
+	// ExternalID ==> the issuer and subject of a user logged in through single sign-on (OIDC), nil for a local user
+	ExternalID *string `gorm:"type:varchar(255);uniqueIndex" json:"externalID"`
+	// RoleID ==> nil for a user without any permission
+	RoleID *uint `gorm:"index" json:"roleID"`
+	Role   *Role `gorm:"foreignKey:RoleID;constraint:OnDelete:SET NULL;" json:"role,omitempty"`
+	// PatronID ==> the patron card of a member, they can read the loans of this patron
+	PatronID  *uint     `gorm:"index" json:"patronID"`
+	Patron    *Patron   `gorm:"foreignKey:PatronID;constraint:OnDelete:SET NULL;" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
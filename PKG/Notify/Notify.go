@@ -0,0 +1,266 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+)
+
+var ErrNoRecipient = errors.New("the message has no recipient")
+
+// Message is an email, Body is the plain text and HTML the optional HTML version of the same message
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+	HTML    string
+}
+
+// Notifier delivers the messages, the implementation is chosen with NOTIFIER.
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// Kinds of notifiers of NOTIFIER
+const (
+	KindLog  = "log"
+	KindSMTP = "smtp"
+	KindFile = "file"
+)
+
+// FromSettings returns the notifier of NOTIFIER: log (default, the messages are only printed), smtp or file (the messages are
+// written as .eml files in NOTIFY_DIR).
+func FromSettings() (Notifier, error) {
+	switch kind := config.Getenv("NOTIFIER", KindLog); kind {
+	case KindLog:
+		return LogNotifier{}, nil
+	case KindSMTP:
+		port, err := strconv.Atoi(config.Getenv("SMTP_PORT", "587"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+		timeout, err := strconv.Atoi(config.Getenv("SMTP_TIMEOUT_SECONDS", "30"))
+		if err != nil || timeout <= 0 {
+			return nil, errors.New("invalid SMTP_TIMEOUT_SECONDS, it must be a number of seconds above 0")
+		}
+		notifier := SMTPNotifier{
+			Host:     config.Getenv("SMTP_HOST", ""),
+			Port:     port,
+			Username: config.Getenv("SMTP_USERNAME", ""),
+			Password: config.Getenv("SMTP_PASSWORD", ""),
+			From:     config.Getenv("SMTP_FROM", ""),
+			Timeout:  time.Duration(timeout) * time.Second,
+		}
+		if notifier.Host == "" || notifier.From == "" {
+			return nil, errors.New("SMTP_HOST and SMTP_FROM are required to send emails")
+		}
+		return notifier, nil
+	case KindFile:
+		return FileNotifier{Dir: config.Getenv("NOTIFY_DIR", "mail"), From: config.Getenv("SMTP_FROM", "library@localhost")}, nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q, use log, smtp or file", kind)
+	}
+}
+
+var (
+	defaultNotifier Notifier
+	defaultOnce     sync.Once
+)
+
+// Default returns the notifier of the settings, read once. Wrong settings fall back to the log notifier so nothing is lost silently.
+func Default() Notifier {
+	defaultOnce.Do(func() {
+		notifier, err := FromSettings()
+		if err != nil {
+			fmt.Printf("Failed to set up the notifications, they are only logged: %v\n", err)
+			notifier = LogNotifier{}
+		}
+		defaultNotifier = notifier
+	})
+	return defaultNotifier
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// LogNotifier prints the messages instead of sending them, for the development
+type LogNotifier struct{}
+
+func (LogNotifier) Send(msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipient
+	}
+	fmt.Printf("Notification to %s: %s\n%s\n", strings.Join(msg.To, ", "), msg.Subject, msg.Body)
+	return nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// SMTPNotifier sends the messages to a mail server, with STARTTLS when the server offers it.
+// Username and Password are left empty for a server without authentication.
+type SMTPNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// Timeout bounds the whole exchange with the server, defaultSMTPTimeout when 0
+	Timeout time.Duration
+}
+
+const defaultSMTPTimeout = 30 * time.Second
+
+// Send drives the SMTP client itself, smtp.SendMail has no timeout and a server that stops answering would block the outbox.
+func (n SMTPNotifier) Send(msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipient
+	}
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+
+	conn, err := (&net.Dialer{Timeout: timeout}).Dial("tcp", net.JoinHostPort(n.Host, strconv.Itoa(n.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		// PlainAuth refuses to send the password without TLS, except to localhost
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(compose(n.From, msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// The server accepted the message, a failing QUIT must not send it again
+	client.Quit()
+	return nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// FileNotifier writes every message to a new .eml file in Dir, to check the messages without a mail server or hand them to another tool
+type FileNotifier struct {
+	Dir  string
+	From string
+}
+
+func (n FileNotifier) Send(msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipient
+	}
+	if err := os.MkdirAll(n.Dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	// Written under a temporary name first so that a tool watching the directory never reads half a message
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000Z"), randomHex(4))
+	tmp := filepath.Join(n.Dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, compose(n.From, msg, now), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(n.Dir, name))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// compose returns the RFC 5322 message, the subject is encoded for the non-ASCII characters.
+// A message with HTML is multipart/alternative with the plain text first, for the clients which don't show HTML.
+func compose(from string, msg Message, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+		b.WriteString(crlf(msg.Body))
+		return b.Bytes()
+	}
+
+	parts := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Body},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		// The HTML lines can be longer than the 998 characters allowed in a message
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(crlf(part.content)))
+		qp.Close()
+	}
+	parts.Close()
+	return b.Bytes()
+}
+
+// crlf returns the text with CRLF line endings
+func crlf(text string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// randomHex panics as crypto/rand never fails on the supported systems
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,235 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	t.Setenv("LIBRARY_NAME", "City Library")
+	msg, err := Render(nil, TemplateAuthorEmailChanged, "", []string{"old@example.com", "new@example.com"}, map[string]any{
+		"Name": "<Jane> Doe", "PreviousEmail": "old@example.com", "Email": "new@example.com",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old@example.com", "new@example.com"}, msg.To)
+	assert.Equal(t, "Your email address was changed", msg.Subject)
+	assert.Contains(t, msg.Body, "Hello <Jane> Doe,")
+	assert.Contains(t, msg.Body, "from old@example.com to new@example.com")
+	assert.True(t, strings.HasSuffix(msg.Body, "--\nCity Library\n"))
+	// The HTML is escaped and wrapped in the layout
+	assert.Contains(t, msg.HTML, "<p>Hello &lt;Jane&gt; Doe,</p>")
+	assert.Contains(t, msg.HTML, "<title>Your email address was changed</title>")
+	assert.Contains(t, msg.HTML, "City Library</h1>")
+
+	_, err = Render(nil, TemplateAuthorEmailChanged, "", nil, map[string]any{"Name": "Jane Doe"})
+	assert.Error(t, err)
+	_, err = Render(nil, "unknown", "", nil, nil)
+	assert.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestResolve(t *testing.T) {
+	stored := map[string]Template{
+		TemplateOverdue + "|fr": {Subject: "« {{.Title}} » est en retard", Text: "Bonjour {{.Name}}"},
+	}
+	source := func(name, language string) (Template, bool, error) {
+		t, ok := stored[name+"|"+language]
+		return t, ok, nil
+	}
+
+	// The base language, then the default language
+	tmpl, language, err := Resolve(source, TemplateOverdue, "fr-CA")
+	assert.NoError(t, err)
+	assert.Equal(t, "fr", language)
+	assert.Equal(t, "Bonjour {{.Name}}", tmpl.Text)
+
+	_, language, _ = Resolve(source, TemplateOverdue, "de")
+	assert.Equal(t, "en", language)
+	_, language, _ = Resolve(source, TemplateOverdue, "not a language")
+	assert.Equal(t, "en", language)
+
+	t.Setenv("NOTIFY_DEFAULT_LANGUAGE", "FR")
+	_, language, _ = Resolve(source, TemplateOverdue, "")
+	assert.Equal(t, "fr", language)
+	// The built-in templates are in English
+	_, language, _ = Resolve(source, TemplateDueSoon, "")
+	assert.Equal(t, "en", language)
+
+	msg, err := Render(source, TemplateOverdue, "fr", []string{"jane@example.com"}, Samples[TemplateOverdue])
+	assert.NoError(t, err)
+	assert.Equal(t, "« The Pragmatic Programmer » est en retard", msg.Subject)
+	assert.Empty(t, msg.HTML)
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check(TemplateDueSoon, Templates[TemplateDueSoon]["en"]))
+	assert.NoError(t, Check(TemplateLayout, Templates[TemplateLayout]["en"]))
+	assert.NoError(t, Check(TemplateDueSoon, Template{Subject: "Due {{.DueAt.Format \"02/01\"}}", Text: "{{.Title}}"}))
+
+	assert.Error(t, Check(TemplateDueSoon, Template{Subject: "Due", Text: "{{.Fine}}"}))
+	assert.Error(t, Check(TemplateDueSoon, Template{Subject: "Due", Text: "{{.Title"}))
+	assert.Error(t, Check(TemplateDueSoon, Template{Subject: "Due", Text: "Hi", HTML: "<p>{{.Fine}}</p>"}))
+	assert.Error(t, Check(TemplateDueSoon, Template{Text: "Hi"}))
+	// The layout wraps every notice, it doesn't know their fields
+	assert.Error(t, Check(TemplateLayout, Template{Text: "{{.Content}} {{.Title}}"}))
+	assert.ErrorIs(t, Check("unknown", Template{}), ErrUnknownTemplate)
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	language, err := NormalizeLanguage(" pt_BR ")
+	assert.NoError(t, err)
+	assert.Equal(t, "pt-br", language)
+
+	_, err = NormalizeLanguage("english please")
+	assert.ErrorIs(t, err, ErrInvalidLanguage)
+}
+
+func TestComposeHTML(t *testing.T) {
+	raw := compose("library@example.com", Message{
+		To: []string{"jane@example.com"}, Subject: "Hello", Body: "Hi Jane\n", HTML: "<p>Hi Jane</p>\n",
+	}, time.Now())
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	assert.NoError(t, err)
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := parts.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", text.Header.Get("Content-Type"))
+	content, _ := io.ReadAll(text)
+	assert.Equal(t, "Hi Jane\r\n", string(content))
+
+	html, err := parts.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+	content, _ = io.ReadAll(html)
+	assert.Equal(t, "<p>Hi Jane</p>\r\n", string(content))
+}
+
+func TestFileNotifier(t *testing.T) {
+	dir := t.TempDir()
+	notifier := FileNotifier{Dir: dir, From: "library@example.com"}
+
+	assert.ErrorIs(t, notifier.Send(Message{Subject: "Nobody"}), ErrNoRecipient)
+	assert.NoError(t, notifier.Send(Message{To: []string{"jane@example.com"}, Subject: "Réservation prête", Body: "Line 1\nLine 2\n"}))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+	raw, _ := os.ReadFile(files[0])
+	message := string(raw)
+	assert.Contains(t, message, "From: library@example.com\r\n")
+	assert.Contains(t, message, "To: jane@example.com\r\n")
+	assert.Contains(t, message, "Subject: =?utf-8?q?R=C3=A9servation_pr=C3=AAte?=\r\n")
+	assert.True(t, strings.HasSuffix(message, "\r\n\r\nLine 1\r\nLine 2\r\n"))
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// A mail server accepting everything, without extensions so no STARTTLS
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost\r\n"))
+		var lines []string
+		data := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case data && line == ".":
+				data = false
+				conn.Write([]byte("250 queued\r\n"))
+			case data:
+			case strings.HasPrefix(line, "DATA"):
+				data = true
+				conn.Write([]byte("354 go ahead\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				conn.Write([]byte("221 bye\r\n"))
+				received <- lines
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	t.Setenv("NOTIFIER", KindSMTP)
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_FROM", "library@example.com")
+	notifier, err := FromSettings()
+	assert.NoError(t, err)
+
+	assert.NoError(t, notifier.Send(Message{To: []string{"jane@example.com"}, Subject: "Hello", Body: "Hi"}))
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<library@example.com>")
+	assert.Contains(t, lines, "RCPT TO:<jane@example.com>")
+	assert.Contains(t, lines, "Subject: Hello")
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// A mail server accepting the connection and never answering
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	notifier := SMTPNotifier{Host: host, Port: portNumber, From: "library@example.com", Timeout: 200 * time.Millisecond}
+
+	start := time.Now()
+	err = notifier.Send(Message{To: []string{"jane@example.com"}, Subject: "Hello", Body: "Hi"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFromSettings(t *testing.T) {
+	t.Setenv("NOTIFIER", "")
+	notifier, err := FromSettings()
+	assert.NoError(t, err)
+	assert.IsType(t, LogNotifier{}, notifier)
+
+	t.Setenv("NOTIFIER", KindSMTP)
+	t.Setenv("SMTP_HOST", "")
+	_, err = FromSettings()
+	assert.Error(t, err)
+
+	t.Setenv("NOTIFIER", "pigeon")
+	_, err = FromSettings()
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"errors"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+// Stored returns the source of the templates saved in the database with tx
+func Stored(tx *gorm.DB) Source {
+	return func(name, language string) (Template, bool, error) {
+		var stored models.EmailTemplate
+		err := tx.Where("name = ? AND language = ?", name, language).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Template{}, false, nil
+		} else if err != nil {
+			return Template{}, false, err
+		}
+		return Template{Subject: stored.Subject, Text: stored.Text, HTML: stored.HTML}, true, nil
+	}
+}
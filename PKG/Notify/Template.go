@@ -0,0 +1,376 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+)
+
+// Names of the templates
+const (
+	// TemplateLayout wraps the text and the HTML of every message with the branding of the library, {{.Content}} is the message
+	TemplateLayout             = "layout"
+	TemplateDueSoon            = "due_soon"
+	TemplateOverdue            = "overdue"
+	TemplateHoldAvailable      = "hold_available"
+	TemplateAccountChanged     = "account_changed"
+	TemplateAuthorEmailChanged = "author_email_changed"
+)
+
+// Names lists the templates, the layout first
+var Names = []string{TemplateLayout, TemplateDueSoon, TemplateOverdue, TemplateHoldAvailable, TemplateAccountChanged, TemplateAuthorEmailChanged}
+
+var (
+	ErrUnknownTemplate = errors.New("unknown template")
+	ErrInvalidLanguage = errors.New("the language must be a language tag like en or pt-br")
+)
+
+// Template of a message, Subject and Text are text/template and HTML is html/template with the data given to Render.
+// A template without HTML sends plain text emails, the subject of the layout is not used.
+type Template struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Source returns the template of a name in exactly one language, ok is false when it has none (see Stored).
+type Source func(name, language string) (t Template, ok bool, err error)
+
+// DefaultLanguage is the language of the recipients without one and of the last fallback, set with NOTIFY_DEFAULT_LANGUAGE.
+func DefaultLanguage() string {
+	language, err := NormalizeLanguage(config.Getenv("NOTIFY_DEFAULT_LANGUAGE", "en"))
+	if err != nil || language == "" {
+		return "en"
+	}
+	return language
+}
+
+// LibraryName is the name signing the messages, set with LIBRARY_NAME.
+func LibraryName() string {
+	return config.Getenv("LIBRARY_NAME", "The Library")
+}
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// NormalizeLanguage lowercases a language tag, an empty tag stays empty
+func NormalizeLanguage(language string) (string, error) {
+	language = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(language), "_", "-"))
+	if language != "" && !languagePattern.MatchString(language) {
+		return "", ErrInvalidLanguage
+	}
+	return language, nil
+}
+
+// fallbacks returns the languages tried for a language: itself, its base language (pt for pt-br) and the default language
+func fallbacks(language string) []string {
+	var languages []string
+	add := func(language string) {
+		for _, l := range languages {
+			if l == language {
+				return
+			}
+		}
+		languages = append(languages, language)
+	}
+
+	if language, err := NormalizeLanguage(language); err == nil && language != "" {
+		add(language)
+		if base, _, found := strings.Cut(language, "-"); found {
+			add(base)
+		}
+	}
+	add(DefaultLanguage())
+	return languages
+}
+
+// Resolve returns the template used for a language and the language it is written in. The template of source (the database)
+// comes before the built-in one of the same language, then the base language and the default language are tried.
+func Resolve(source Source, name, language string) (Template, string, error) {
+	if _, ok := Templates[name]; !ok {
+		return Template{}, "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+	for _, language := range fallbacks(language) {
+		if source != nil {
+			t, ok, err := source(name, language)
+			if err != nil {
+				return Template{}, "", err
+			} else if ok {
+				return t, language, nil
+			}
+		}
+		if t, ok := Templates[name][language]; ok {
+			return t, language, nil
+		}
+	}
+	// The default language may have no built-in template when it is set to another language
+	return Templates[name]["en"], "en", nil
+}
+
+// Render returns the message of a template for the recipients in their language, wrapped in the layout.
+// The data gets the name of the library as Library.
+func Render(source Source, name, language string, to []string, data map[string]any) (Message, error) {
+	t, language, err := Resolve(source, name, language)
+	if err != nil {
+		return Message{}, err
+	}
+	layout, _, err := Resolve(source, TemplateLayout, language)
+	if err != nil {
+		return Message{}, err
+	}
+	return render(name, t, layout, to, data)
+}
+
+// Preview renders a template with its sample data, draft replaces the template of the language when it is not nil.
+// The preview of the layout wraps the due soon notice.
+func Preview(source Source, name, language string, draft *Template) (Message, error) {
+	if _, ok := Templates[name]; !ok {
+		return Message{}, fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+	content := name
+	if name == TemplateLayout {
+		content = TemplateDueSoon
+	}
+
+	t, _, err := Resolve(source, content, language)
+	if err != nil {
+		return Message{}, err
+	}
+	layout, _, err := Resolve(source, TemplateLayout, language)
+	if err != nil {
+		return Message{}, err
+	}
+	if draft != nil && name == TemplateLayout {
+		layout = *draft
+	} else if draft != nil {
+		t = *draft
+	}
+	return render(content, t, layout, []string{"patron@example.com"}, Samples[content])
+}
+
+// Check reports the errors of a template, it is rendered with the sample data so a field the notice doesn't have is an error.
+// The layout wraps every notice, it can only use Library, Subject and Content.
+func Check(name string, t Template) error {
+	if _, ok := Templates[name]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+
+	if name == TemplateLayout {
+		if strings.TrimSpace(t.Text) == "" {
+			return errors.New("text is required")
+		}
+		values := map[string]any{"Library": LibraryName(), "Subject": "Subject", "Content": "Content"}
+		if _, err := executeText(name+".text", t.Text, values); err != nil {
+			return err
+		}
+		values["Content"] = htmltemplate.HTML("<p>Content</p>")
+		_, err := executeHTML(name+".html", t.HTML, values)
+		return err
+	}
+
+	if strings.TrimSpace(t.Subject) == "" || strings.TrimSpace(t.Text) == "" {
+		return errors.New("subject and text are required")
+	}
+	_, err := Preview(nil, name, DefaultLanguage(), &t)
+	return err
+}
+
+// render executes a template and wraps it in the layout
+func render(name string, t, layout Template, to []string, data map[string]any) (Message, error) {
+	values := map[string]any{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Library"] = LibraryName()
+
+	subject, err := executeText(name+".subject", t.Subject, values)
+	if err != nil {
+		return Message{}, err
+	}
+	// A subject is one line
+	subject = strings.Join(strings.Fields(subject), " ")
+	values["Subject"] = subject
+
+	text, err := executeText(name+".text", t.Text, values)
+	if err != nil {
+		return Message{}, err
+	}
+	values["Content"] = text
+	if text, err = executeText(TemplateLayout+".text", layout.Text, values); err != nil {
+		return Message{}, err
+	}
+
+	html := ""
+	if t.HTML != "" {
+		content, err := executeHTML(name+".html", t.HTML, values)
+		if err != nil {
+			return Message{}, err
+		}
+		// A layout without HTML sends the HTML of the message as it is
+		html = content
+		if strings.TrimSpace(layout.HTML) != "" {
+			values["Content"] = htmltemplate.HTML(content)
+			if html, err = executeHTML(TemplateLayout+".html", layout.HTML, values); err != nil {
+				return Message{}, err
+			}
+		}
+	}
+	return Message{To: to, Subject: subject, Body: text, HTML: html}, nil
+}
+
+func executeText(name, text string, data any) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func executeHTML(name, text string, data any) (string, error) {
+	t, err := htmltemplate.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Templates are the built-in templates by name and language, the ones saved with /api/template come first
+var Templates = map[string]map[string]Template{
+	TemplateLayout: {
+		"en": {
+			Text: `{{.Content}}
+--
+{{.Library}}
+`,
+			HTML: `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="margin:0;padding:24px;background:#f4f4f5;font-family:Arial,Helvetica,sans-serif;color:#18181b">
+<div style="max-width:560px;margin:0 auto;background:#ffffff;border-radius:8px;padding:24px">
+<h1 style="margin:0 0 16px;font-size:20px;color:#1e3a8a">{{.Library}}</h1>
+{{.Content}}
+</div>
+<p style="max-width:560px;margin:16px auto 0;font-size:12px;color:#71717a">This message was sent by {{.Library}}.</p>
+</body>
+</html>
+`,
+		},
+	},
+	TemplateDueSoon: {
+		"en": {
+			Subject: `"{{.Title}}" is due on {{.DueAt.Format "January 2"}}`,
+			Text: `Hello {{.Name}},
+
+"{{.Title}}" is due on {{.DueAt.Format "Monday, January 2, 2006"}}, in {{.Days}} day(s).
+Please return or renew it before then.
+`,
+			HTML: `<p>Hello {{.Name}},</p>
+<p><strong>{{.Title}}</strong> is due on <strong>{{.DueAt.Format "Monday, January 2, 2006"}}</strong>, in {{.Days}} day(s).</p>
+<p>Please return or renew it before then.</p>
+`,
+		},
+	},
+	TemplateOverdue: {
+		"en": {
+			Subject: `"{{.Title}}" is overdue`,
+			Text: `Hello {{.Name}},
+
+"{{.Title}}" was due on {{.DueAt.Format "Monday, January 2, 2006"}} and is {{.Days}} day(s) overdue.
+Please return it as soon as possible.
+`,
+			HTML: `<p>Hello {{.Name}},</p>
+<p><strong>{{.Title}}</strong> was due on {{.DueAt.Format "Monday, January 2, 2006"}} and is <strong>{{.Days}} day(s) overdue</strong>.</p>
+<p>Please return it as soon as possible.</p>
+`,
+		},
+	},
+	TemplateHoldAvailable: {
+		"en": {
+			Subject: `"{{.Title}}" is ready for pickup`,
+			Text: `Hello {{.Name}},
+
+"{{.Title}}" that you placed on hold is ready for pickup until {{.PickupBy.Format "Monday, January 2, 2006"}}.
+`,
+			HTML: `<p>Hello {{.Name}},</p>
+<p><strong>{{.Title}}</strong> that you placed on hold is ready for pickup until <strong>{{.PickupBy.Format "Monday, January 2, 2006"}}</strong>.</p>
+`,
+		},
+	},
+	TemplateAccountChanged: {
+		"en": {
+			Subject: `Your library account was changed`,
+			Text: `Hello {{.Name}},
+
+Your library account {{.Barcode}} was changed:
+{{if .NameChanged}}- your name was changed from {{.PreviousName}} to {{.Name}}
+{{end}}{{if .EmailChanged}}- your email address was changed from {{.PreviousEmail}} to {{.Email}}
+{{end}}{{if .PinChanged}}- your PIN was changed
+{{end}}{{if .BlockedChanged}}{{if .Blocked}}- your account was blocked, please contact the library
+{{else}}- your account was unblocked
+{{end}}{{end}}
+If you didn't ask for this change, please contact the library.
+`,
+			HTML: `<p>Hello {{.Name}},</p>
+<p>Your library account {{.Barcode}} was changed:</p>
+<ul>
+{{if .NameChanged}}<li>your name was changed from {{.PreviousName}} to {{.Name}}</li>{{end}}
+{{if .EmailChanged}}<li>your email address was changed from {{.PreviousEmail}} to {{.Email}}</li>{{end}}
+{{if .PinChanged}}<li>your PIN was changed</li>{{end}}
+{{if .BlockedChanged}}{{if .Blocked}}<li>your account was blocked, please contact the library</li>{{else}}<li>your account was unblocked</li>{{end}}{{end}}
+</ul>
+<p>If you didn't ask for this change, please contact the library.</p>
+`,
+		},
+	},
+	TemplateAuthorEmailChanged: {
+		"en": {
+			Subject: "Your email address was changed",
+			Text: `Hello {{.Name}},
+
+The email address of your author record at the library was changed from {{.PreviousEmail}} to {{.Email}}.
+If you didn't ask for this change, please contact the library.
+`,
+			HTML: `<p>Hello {{.Name}},</p>
+<p>The email address of your author record at the library was changed from {{.PreviousEmail}} to <strong>{{.Email}}</strong>.</p>
+<p>If you didn't ask for this change, please contact the library.</p>
+`,
+		},
+	},
+}
+
+// Samples are the data of the previews, every notice is sent with these fields
+var Samples = map[string]map[string]any{
+	TemplateDueSoon: {
+		"Name": "Jane Doe", "Title": "The Pragmatic Programmer", "DueAt": time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC), "Days": 2,
+	},
+	TemplateOverdue: {
+		"Name": "Jane Doe", "Title": "The Pragmatic Programmer", "DueAt": time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC), "Days": 3,
+	},
+	TemplateHoldAvailable: {
+		"Name": "Jane Doe", "Title": "The Pragmatic Programmer", "PickupBy": time.Date(2025, 3, 21, 18, 0, 0, 0, time.UTC),
+	},
+	TemplateAccountChanged: {
+		"Name": "Jane Doe", "Barcode": "P000123",
+		"NameChanged": false, "PreviousName": "Jane Doe",
+		"EmailChanged": true, "PreviousEmail": "jane@example.com", "Email": "jane.doe@example.com",
+		"PinChanged": false, "BlockedChanged": false, "Blocked": false,
+	},
+	TemplateAuthorEmailChanged: {
+		"Name": "John Doe", "PreviousEmail": "john@example.com", "Email": "johnny@example.com",
+	},
+}
@@ -0,0 +1,243 @@
+package oai
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+)
+
+// OAI-PMH 2.0 (http://www.openarchives.org/OAI/openarchivesprotocol.html)
+const (
+	Namespace      = "http://www.openarchives.org/OAI/2.0/"
+	schemaLocation = Namespace + " http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	xsiNamespace   = "http://www.w3.org/2001/XMLSchema-instance"
+
+	// Datestamps are sent with the seconds granularity
+	DatestampLayout = "2006-01-02T15:04:05Z"
+	dayLayout       = "2006-01-02"
+)
+
+// Error codes of the protocol
+const (
+	BadArgument             = "badArgument"
+	BadResumptionToken      = "badResumptionToken"
+	BadVerb                 = "badVerb"
+	CannotDisseminateFormat = "cannotDisseminateFormat"
+	IDDoesNotExist          = "idDoesNotExist"
+	NoRecordsMatch          = "noRecordsMatch"
+	NoSetHierarchy          = "noSetHierarchy"
+)
+
+// Metadata formats that can be disseminated
+const (
+	PrefixDC      = "oai_dc"
+	PrefixMARCXML = "marc21"
+)
+
+var MetadataFormats = []MetadataFormat{
+	{Prefix: PrefixDC, Schema: "http://www.openarchives.org/OAI/2.0/oai_dc.xsd", Namespace: "http://www.openarchives.org/OAI/2.0/oai_dc/"},
+	{Prefix: PrefixMARCXML, Schema: "http://www.loc.gov/standards/marcxml/schema/MARC21slim.xsd", Namespace: "http://www.loc.gov/MARC21/slim"},
+}
+
+// Response is the OAI-PMH root element, only one of the verb elements (or Errors) is set.
+type Response struct {
+	XMLName           xml.Name `xml:"OAI-PMH"`
+	Xmlns             string   `xml:"xmlns,attr"`
+	XmlnsXsi          string   `xml:"xmlns:xsi,attr"`
+	XsiSchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	ResponseDate      string   `xml:"responseDate"`
+	Request           Request  `xml:"request"`
+	Errors            []Error  `xml:"error,omitempty"`
+
+	Identify            *Identify            `xml:"Identify,omitempty"`
+	ListMetadataFormats *ListMetadataFormats `xml:"ListMetadataFormats,omitempty"`
+	GetRecord           *GetRecord           `xml:"GetRecord,omitempty"`
+	ListRecords         *ListRecords         `xml:"ListRecords,omitempty"`
+	ListIdentifiers     *ListIdentifiers     `xml:"ListIdentifiers,omitempty"`
+}
+
+// Request echoes the arguments, they must be left out when the response is a badVerb or badArgument error.
+type Request struct {
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+	BaseURL         string `xml:",chardata"`
+}
+
+type Error struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+type Identify struct {
+	RepositoryName    string `xml:"repositoryName"`
+	BaseURL           string `xml:"baseURL"`
+	ProtocolVersion   string `xml:"protocolVersion"`
+	AdminEmail        string `xml:"adminEmail"`
+	EarliestDatestamp string `xml:"earliestDatestamp"`
+	DeletedRecord     string `xml:"deletedRecord"`
+	Granularity       string `xml:"granularity"`
+}
+
+type MetadataFormat struct {
+	Prefix    string `xml:"metadataPrefix"`
+	Schema    string `xml:"schema"`
+	Namespace string `xml:"metadataNamespace"`
+}
+
+type ListMetadataFormats struct {
+	Formats []MetadataFormat `xml:"metadataFormat"`
+}
+
+type Header struct {
+	Status     string `xml:"status,attr,omitempty"`
+	Identifier string `xml:"identifier"`
+	Datestamp  string `xml:"datestamp"`
+}
+
+type Metadata struct {
+	Content any
+}
+
+type Record struct {
+	Header   Header    `xml:"header"`
+	Metadata *Metadata `xml:"metadata,omitempty"`
+}
+
+type GetRecord struct {
+	Record Record `xml:"record"`
+}
+
+type ResumptionToken struct {
+	CompleteListSize int64  `xml:"completeListSize,attr"`
+	Cursor           int    `xml:"cursor,attr"`
+	Value            string `xml:",chardata"`
+}
+
+type ListRecords struct {
+	Records         []Record         `xml:"record"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type ListIdentifiers struct {
+	Headers         []Header         `xml:"header"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+// NewResponse returns a response to request with the namespaces of the protocol.
+func NewResponse(request Request) *Response {
+	return &Response{
+		Xmlns:             Namespace,
+		XmlnsXsi:          xsiNamespace,
+		XsiSchemaLocation: schemaLocation,
+		ResponseDate:      time.Now().UTC().Format(DatestampLayout),
+		Request:           request,
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type dublinCore struct {
+	XMLName           xml.Name `xml:"oai_dc:dc"`
+	XmlnsOaiDC        string   `xml:"xmlns:oai_dc,attr"`
+	XmlnsDC           string   `xml:"xmlns:dc,attr"`
+	XmlnsXsi          string   `xml:"xmlns:xsi,attr"`
+	XsiSchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Title             string   `xml:"dc:title"`
+	Creator           string   `xml:"dc:creator,omitempty"`
+	Subject           string   `xml:"dc:subject,omitempty"`
+	Date              string   `xml:"dc:date"`
+	Type              string   `xml:"dc:type"`
+	Identifier        []string `xml:"dc:identifier"`
+}
+
+// DublinCore returns the unqualified Dublin Core (oai_dc) description of a book, its Author must be preloaded.
+func DublinCore(book models.Book) any {
+	return dublinCore{
+		XmlnsOaiDC:        "http://www.openarchives.org/OAI/2.0/oai_dc/",
+		XmlnsDC:           "http://purl.org/dc/elements/1.1/",
+		XmlnsXsi:          xsiNamespace,
+		XsiSchemaLocation: "http://www.openarchives.org/OAI/2.0/oai_dc/ http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+		Title:             book.Title,
+		Creator:           book.Author.Name,
+		Subject:           book.Subject,
+		Date:              book.PublishedDate.Format(dayLayout),
+		Type:              "Text",
+		Identifier:        []string{"urn:isbn:" + book.ISBN},
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Identifier returns the OAI identifier of a book ==> oai:library.example.org:book/12
+func Identifier(repositoryIdentifier string, bookID uint) string {
+	return fmt.Sprintf("oai:%s:book/%d", repositoryIdentifier, bookID)
+}
+
+// ParseIdentifier returns the book ID of an OAI identifier of this repository.
+func ParseIdentifier(repositoryIdentifier, identifier string) (uint, error) {
+	id, ok := strings.CutPrefix(identifier, "oai:"+repositoryIdentifier+":book/")
+	if !ok {
+		return 0, errors.New("unknown identifier")
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n == 0 {
+		return 0, errors.New("unknown identifier")
+	}
+	return uint(n), nil
+}
+
+// ParseDatestamp parses a from or until argument, day reports if it has the day granularity.
+func ParseDatestamp(s string) (t time.Time, day bool, err error) {
+	if t, err = time.Parse(DatestampLayout, s); err == nil {
+		return t, false, nil
+	}
+	if t, err = time.Parse(dayLayout, s); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a valid datestamp", s)
+}
+
+// Token is the state of an incomplete list, it is sent to the harvester as an opaque resumption token.
+type Token struct {
+	MetadataPrefix string
+	From           string
+	Until          string
+	LastID         uint // the list continues after this book ID
+	Cursor         int  // number of records already sent
+}
+
+func (t Token) Encode() string {
+	raw := strings.Join([]string{t.MetadataPrefix, t.From, t.Until, strconv.FormatUint(uint64(t.LastID), 10), strconv.Itoa(t.Cursor)}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeToken(s string) (Token, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Token{}, errors.New("invalid resumption token")
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 5 {
+		return Token{}, errors.New("invalid resumption token")
+	}
+
+	lastID, err1 := strconv.ParseUint(parts[3], 10, 64)
+	cursor, err2 := strconv.Atoi(parts[4])
+	if err1 != nil || err2 != nil {
+		return Token{}, errors.New("invalid resumption token")
+	}
+
+	return Token{MetadataPrefix: parts[0], From: parts[1], Until: parts[2], LastID: uint(lastID), Cursor: cursor}, nil
+}
@@ -0,0 +1,61 @@
+package oai
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	token := Token{MetadataPrefix: PrefixDC, From: "2024-01-01", LastID: 42, Cursor: 100}
+
+	decoded, err := DecodeToken(token.Encode())
+
+	assert.NoError(t, err)
+	assert.Equal(t, token, decoded)
+
+	_, err = DecodeToken("not a token")
+	assert.Error(t, err)
+}
+
+func TestIdentifier(t *testing.T) {
+	id, err := ParseIdentifier("library.local", Identifier("library.local", 12))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(12), id)
+
+	_, err = ParseIdentifier("library.local", "oai:other.org:book/12")
+	assert.Error(t, err)
+}
+
+func TestParseDatestamp(t *testing.T) {
+	_, day, err := ParseDatestamp("2024-05-01")
+	assert.NoError(t, err)
+	assert.True(t, day)
+
+	_, day, err = ParseDatestamp("2024-05-01T10:00:00Z")
+	assert.NoError(t, err)
+	assert.False(t, day)
+
+	_, _, err = ParseDatestamp("01/05/2024")
+	assert.Error(t, err)
+}
+
+func TestDublinCoreRecord(t *testing.T) {
+	book := models.Book{Title: "The Hobbit", ISBN: "0261103342", PublishedDate: time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC), Author: models.Author{Name: "J. R. R. Tolkien"}}
+
+	response := NewResponse(Request{Verb: "GetRecord", BaseURL: "http://localhost:9090/oai"})
+	response.GetRecord = &GetRecord{Record: Record{
+		Header:   Header{Identifier: Identifier("library.local", 1), Datestamp: "2024-05-01T10:00:00Z"},
+		Metadata: &Metadata{Content: DublinCore(book)},
+	}}
+
+	out, err := xml.Marshal(response)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(out), "<metadata><oai_dc:dc "))
+	assert.Contains(t, string(out), "<dc:title>The Hobbit</dc:title>")
+	assert.Contains(t, string(out), "<dc:identifier>urn:isbn:0261103342</dc:identifier>")
+}
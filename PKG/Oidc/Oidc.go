@@ -0,0 +1,266 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+)
+
+var (
+	ErrNotConfigured  = errors.New("single sign-on is not configured")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+// Config of the identity provider, read from the OIDC_ environment variables
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       string // separated by spaces
+	GroupsClaim  string
+}
+
+// Settings returns the configuration of the identity provider, single sign-on is off while OIDC_ISSUER or OIDC_CLIENT_ID is not set.
+func Settings() Config {
+	return Config{
+		Issuer:       strings.TrimSuffix(config.Getenv("OIDC_ISSUER", ""), "/"),
+		ClientID:     config.Getenv("OIDC_CLIENT_ID", ""),
+		ClientSecret: config.Getenv("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  config.Getenv("OIDC_REDIRECT_URL", "http://localhost:9090/api/auth/oidc/callback"),
+		Scopes:       config.Getenv("OIDC_SCOPES", "openid profile email groups"),
+		GroupsClaim:  config.Getenv("OIDC_GROUPS_CLAIM", "groups"),
+	}
+}
+
+// Enabled tells if single sign-on is configured.
+func (c Config) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// Identity is the user logged in by the identity provider
+type Identity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Provider is an identity provider found with OpenID Connect Discovery
+type Provider struct {
+	Config                Config
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+
+	keys *keySet
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+var (
+	cached   *Provider
+	cachedMu sync.Mutex
+)
+
+// Get returns the provider of the current settings, it is discovered on the first login and again when the settings change.
+func Get() (*Provider, error) {
+	settings := Settings()
+	if !settings.Enabled() {
+		return nil, ErrNotConfigured
+	}
+
+	cachedMu.Lock()
+	defer cachedMu.Unlock()
+	if cached != nil && cached.Config == settings {
+		return cached, nil
+	}
+
+	provider, err := Discover(settings)
+	if err != nil {
+		return nil, err
+	}
+	cached = provider
+	return provider, nil
+}
+
+// Discover reads the endpoints of a provider from its /.well-known/openid-configuration document.
+func Discover(settings Config) (*Provider, error) {
+	var document struct {
+		Provider
+		Issuer string `json:"issuer"`
+	}
+	if err := getJSON(settings.Issuer+"/.well-known/openid-configuration", &document); err != nil {
+		return nil, err
+	}
+	// The issuer of the document must be the configured one (OpenID Connect Discovery 4.3)
+	if document.Issuer != settings.Issuer {
+		return nil, fmt.Errorf("the provider issuer %q is not %q", document.Issuer, settings.Issuer)
+	}
+	if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" || document.JwksURI == "" {
+		return nil, errors.New("the provider configuration misses an endpoint")
+	}
+
+	provider := document.Provider
+	provider.Config = settings
+	provider.keys = &keySet{uri: provider.JwksURI}
+	return &provider, nil
+}
+
+// AuthURL returns where the user is sent to log in, the state and the nonce are checked on the way back
+// and the PKCE challenge binds the code to the verifier kept by the server.
+func (p *Provider) AuthURL(state, nonce, verifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.Config.ClientID},
+		"redirect_uri":          {p.Config.RedirectURL},
+		"scope":                 {p.Config.Scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades the authorization code for the tokens of the user and returns the ID token.
+func (p *Provider) Exchange(code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.Config.RedirectURL},
+		"client_id":     {p.Config.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.Config.ClientSecret != "" {
+		form.Set("client_secret", p.Config.ClientSecret)
+	}
+
+	resp, err := client.PostForm(p.TokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint: no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// Verify checks the signature, the issuer, the audience, the expiry and the nonce of an ID token and returns its user.
+func (p *Provider) Verify(raw, nonce string, now time.Time) (Identity, error) {
+	payload, err := p.keys.verify(raw)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	if claims["iss"] != p.Config.Issuer {
+		return Identity{}, fmt.Errorf("%w: wrong issuer", ErrInvalidIDToken)
+	}
+	if !slices.Contains(claimStrings(claims["aud"]), p.Config.ClientID) {
+		return Identity{}, fmt.Errorf("%w: wrong audience", ErrInvalidIDToken)
+	}
+	if exp, ok := claims["exp"].(float64); !ok || now.Unix() >= int64(exp) {
+		return Identity{}, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if claims["nonce"] != nonce {
+		return Identity{}, fmt.Errorf("%w: wrong nonce", ErrInvalidIDToken)
+	}
+
+	identity := Identity{Issuer: p.Config.Issuer, Groups: claimStrings(claims[p.Config.GroupsClaim])}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Username, _ = claims["preferred_username"].(string)
+	if identity.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Email
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+	return identity, nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// RandomString returns 32 random bytes in base64url, for the states, the nonces and the PKCE verifiers (43 characters).
+func RandomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Challenge returns the S256 PKCE challenge of a verifier (RFC 7636).
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(uri string, v any) error {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", uri, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// claimStrings reads a claim that is a string or an array of strings (aud, groups)
+func claimStrings(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
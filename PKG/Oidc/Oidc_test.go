@@ -0,0 +1,117 @@
+package oidc
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRedirectURL = "http://localhost:9090/api/auth/oidc/callback"
+
+var noRedirect = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+func startMock(t *testing.T) (*MockProvider, *Provider) {
+	mock, err := NewMockProvider("", "library", MockUser{Subject: "42", Username: "jdoe", Email: "jdoe@example.com", Groups: []string{"lms-staff"}})
+	assert.NoError(t, err)
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	mock.Issuer = server.URL
+
+	provider, err := Discover(Config{Issuer: server.URL, ClientID: "library", RedirectURL: testRedirectURL, Scopes: "openid", GroupsClaim: "groups"})
+	assert.NoError(t, err)
+	return mock, provider
+}
+
+// authorize follows the login at the provider and returns the code and state of the callback
+func authorize(t *testing.T, provider *Provider, state, nonce, verifier string) (string, string) {
+	resp, err := noRedirect.Get(provider.AuthURL(state, nonce, verifier))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestLoginFlow(t *testing.T) {
+	_, provider := startMock(t)
+
+	verifier := RandomString()
+	code, state := authorize(t, provider, "state", "nonce", verifier)
+	assert.Equal(t, "state", state)
+
+	idToken, err := provider.Exchange(code, verifier)
+	assert.NoError(t, err)
+
+	identity, err := provider.Verify(idToken, "nonce", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Issuer: provider.Config.Issuer, Subject: "42", Username: "jdoe", Email: "jdoe@example.com", Groups: []string{"lms-staff"}}, identity)
+
+	// A code is used once
+	_, err = provider.Exchange(code, verifier)
+	assert.Error(t, err)
+}
+
+func TestExchangeChecksPKCE(t *testing.T) {
+	_, provider := startMock(t)
+
+	code, _ := authorize(t, provider, "state", "nonce", RandomString())
+	_, err := provider.Exchange(code, RandomString())
+	assert.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestVerifyRejectsBadTokens(t *testing.T) {
+	mock, provider := startMock(t)
+	now := time.Now()
+
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"iss": provider.Config.Issuer, "sub": "42", "aud": "library", "exp": now.Add(time.Minute).Unix(), "nonce": "nonce"}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	valid, _ := mock.Sign(claims(nil))
+	_, err := provider.Verify(valid, "nonce", now)
+	assert.NoError(t, err)
+
+	for name, changes := range map[string]map[string]any{
+		"issuer":   {"iss": "https://evil.example.com"},
+		"audience": {"aud": []string{"other"}},
+		"expired":  {"exp": now.Add(-time.Minute).Unix()},
+		"nonce":    {"nonce": "replayed"},
+	} {
+		token, _ := mock.Sign(claims(changes))
+		_, err := provider.Verify(token, "nonce", now)
+		assert.ErrorIs(t, err, ErrInvalidIDToken, name)
+	}
+
+	// Signed by another key
+	other, _ := NewMockProvider(provider.Config.Issuer, "library", MockUser{})
+	forged, _ := other.Sign(claims(nil))
+	_, err = provider.Verify(forged, "nonce", now)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+	// Not signed
+	payload := strings.Split(valid, ".")[1]
+	_, err = provider.Verify(base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))+"."+payload+".", "nonce", now)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestRoleFor(t *testing.T) {
+	t.Setenv("OIDC_ROLE_MAPPING", "lms-admins=admin, lms-staff=librarian")
+
+	assert.Equal(t, "admin", RoleFor([]string{"lms-staff", "lms-admins"}))
+	assert.Equal(t, "librarian", RoleFor([]string{"lms-staff"}))
+	assert.Equal(t, "member", RoleFor(nil))
+
+	t.Setenv("OIDC_DEFAULT_ROLE", "reader")
+	assert.Equal(t, "reader", RoleFor([]string{"everyone"}))
+}
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+var ErrUsernameTaken = errors.New("the username belongs to a local user")
+
+// GroupRole maps a group of the identity provider to a local role
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// RoleMapping reads OIDC_ROLE_MAPPING, "group=role" pairs separated by commas from the most to the least privileged.
+func RoleMapping() []GroupRole {
+	mapping := []GroupRole{}
+	for _, pair := range strings.Split(config.Getenv("OIDC_ROLE_MAPPING", ""), ",") {
+		group, role, ok := strings.Cut(pair, "=")
+		if group, role = strings.TrimSpace(group), strings.TrimSpace(role); ok && group != "" && role != "" {
+			mapping = append(mapping, GroupRole{Group: group, Role: role})
+		}
+	}
+	return mapping
+}
+
+// RoleFor returns the role of the first mapping having one of the groups, OIDC_DEFAULT_ROLE (member by default) when none matches.
+func RoleFor(groups []string) string {
+	for _, mapping := range RoleMapping() {
+		if slices.Contains(groups, mapping.Group) {
+			return mapping.Role
+		}
+	}
+	return config.Getenv("OIDC_DEFAULT_ROLE", auth.RoleMember)
+}
+
+// ExternalID identifies the user of an identity provider, the subject is only unique for its issuer.
+func ExternalID(identity Identity) string {
+	return identity.Issuer + "|" + identity.Subject
+}
+
+// Provision returns the user of an identity, it is created on the first login (just-in-time) and gets the role of its groups
+// on every login so that the identity provider stays the reference. created tells if the user is new.
+func Provision(tx *gorm.DB, identity Identity) (user models.User, created bool, err error) {
+	roleName := RoleFor(identity.Groups)
+	var role models.Role
+	if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return user, false, fmt.Errorf("role %q of the groups %v: %w", roleName, identity.Groups, err)
+	}
+
+	externalID := ExternalID(identity)
+	err = tx.Where("external_id = ?", externalID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// A local account is never taken over by a user of the identity provider having the same name
+		var existing models.User
+		if err := tx.Where("username = ?", identity.Username).First(&existing).Error; err == nil {
+			return user, false, ErrUsernameTaken
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, false, err
+		}
+
+		// No password, the user can only log in through the identity provider
+		user = models.User{Username: identity.Username, ExternalID: &externalID, RoleID: &role.ID}
+		return user, true, tx.Create(&user).Error
+	} else if err != nil {
+		return user, false, err
+	}
+
+	if user.RoleID == nil || *user.RoleID != role.ID {
+		user.RoleID = &role.ID
+		if err := tx.Model(&user).Update("role_id", role.ID).Error; err != nil {
+			return user, false, err
+		}
+	}
+	return user, false, nil
+}
@@ -0,0 +1,272 @@
+package opds
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"time"
+)
+
+// Media types of OPDS 1.2 (Atom) and OPDS 2.0 (JSON) documents
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	JSONType        = "application/opds+json"
+	OpenSearchType  = "application/opensearchdescription+xml"
+	RecordType      = "application/xml" // metadata record linked by the publications
+
+	// The catalog has no ebook files, a publication is acquired by borrowing it from the library
+	BorrowRel = "http://opds-spec.org/acquisition/borrow"
+)
+
+// Feed is a catalog page independent of the OPDS version, it has navigation entries or publications (Acquisition).
+type Feed struct {
+	ID           string
+	Title        string
+	Updated      time.Time
+	Links        []Link
+	Navigation   []Navigation
+	Publications []Publication
+	Acquisition  bool
+}
+
+type Link struct {
+	Rel       string `json:"rel,omitempty"`
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+type Navigation struct {
+	ID      string
+	Title   string
+	Summary string
+	Href    string
+	// Acquisition reports if the linked feed lists publications
+	Acquisition bool
+}
+
+type Publication struct {
+	ID       string // urn:isbn:...
+	Title    string
+	Author   string
+	Subject  string
+	Issued   time.Time
+	Modified time.Time
+	Href     string // public page to borrow the book, the publication has no acquisition link when empty
+	Record   string // public metadata record of the book, linked as alternate
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	Xmlns     string      `xml:"xmlns,attr"`
+	XmlnsDC   string      `xml:"xmlns:dc,attr"`
+	XmlnsOPDS string      `xml:"xmlns:opds,attr"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomEntry struct {
+	ID         string        `xml:"id"`
+	Title      string        `xml:"title"`
+	Updated    string        `xml:"updated"`
+	Author     *atomAuthor   `xml:"author,omitempty"`
+	Issued     string        `xml:"dc:issued,omitempty"`
+	Identifier string        `xml:"dc:identifier,omitempty"`
+	Category   *atomCategory `xml:"category,omitempty"`
+	Content    *atomContent  `xml:"content,omitempty"`
+	Links      []atomLink    `xml:"link"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom renders the feed as an OPDS 1.2 catalog.
+func Atom(feed Feed, author string) ([]byte, error) {
+	updated := feed.Updated.UTC().Format(time.RFC3339)
+
+	out := atomFeed{
+		Xmlns:     "http://www.w3.org/2005/Atom",
+		XmlnsDC:   "http://purl.org/dc/terms/",
+		XmlnsOPDS: "http://opds-spec.org/2010/catalog",
+		ID:        feed.ID,
+		Title:     feed.Title,
+		Updated:   updated,
+		Author:    atomAuthor{Name: author},
+	}
+
+	for _, l := range feed.Links {
+		out.Links = append(out.Links, atomLink{Rel: l.Rel, Href: l.Href, Type: l.Type, Title: l.Title})
+	}
+
+	for _, n := range feed.Navigation {
+		linkType := NavigationType
+		if n.Acquisition {
+			linkType = AcquisitionType
+		}
+		out.Entries = append(out.Entries, atomEntry{
+			ID:      n.ID,
+			Title:   n.Title,
+			Updated: updated,
+			Content: &atomContent{Type: "text", Value: n.Summary},
+			Links:   []atomLink{{Rel: "subsection", Href: n.Href, Type: linkType}},
+		})
+	}
+
+	for _, p := range feed.Publications {
+		entry := atomEntry{
+			ID:         p.ID,
+			Title:      p.Title,
+			Updated:    p.Modified.UTC().Format(time.RFC3339),
+			Issued:     p.Issued.Format("2006-01-02"),
+			Identifier: p.ID,
+		}
+		if p.Record != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: p.Record, Type: RecordType})
+		}
+		if p.Href != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: BorrowRel, Href: p.Href, Type: "text/html"})
+		}
+		if p.Author != "" {
+			entry.Author = &atomAuthor{Name: p.Author}
+		}
+		if p.Subject != "" {
+			entry.Category = &atomCategory{Term: p.Subject, Label: p.Subject}
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	body, err := xml.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type jsonFeed struct {
+	Metadata     jsonMetadata      `json:"metadata"`
+	Links        []Link            `json:"links"`
+	Navigation   []Link            `json:"navigation,omitempty"`
+	Publications []jsonPublication `json:"publications,omitempty"`
+}
+
+type jsonMetadata struct {
+	Title    string `json:"title"`
+	Modified string `json:"modified,omitempty"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []Link                  `json:"links"`
+}
+
+type jsonContributor struct {
+	Name string `json:"name"`
+}
+
+type jsonPublicationMetadata struct {
+	Type       string            `json:"@type"`
+	Identifier string            `json:"identifier"`
+	Title      string            `json:"title"`
+	Author     []jsonContributor `json:"author,omitempty"`
+	Subject    []string          `json:"subject,omitempty"`
+	Published  string            `json:"published"`
+	Modified   string            `json:"modified"`
+}
+
+// JSON renders the feed as an OPDS 2.0 catalog.
+func JSON(feed Feed) ([]byte, error) {
+	out := jsonFeed{
+		Metadata: jsonMetadata{Title: feed.Title, Modified: feed.Updated.UTC().Format(time.RFC3339)},
+		Links:    feed.Links,
+	}
+
+	for _, n := range feed.Navigation {
+		out.Navigation = append(out.Navigation, Link{Href: n.Href, Title: n.Title, Type: JSONType})
+	}
+
+	for _, p := range feed.Publications {
+		publication := jsonPublication{
+			Metadata: jsonPublicationMetadata{
+				Type:       "http://schema.org/Book",
+				Identifier: p.ID,
+				Title:      p.Title,
+				Published:  p.Issued.Format("2006-01-02"),
+				Modified:   p.Modified.UTC().Format(time.RFC3339),
+			},
+			Links: []Link{},
+		}
+		if p.Record != "" {
+			publication.Links = append(publication.Links, Link{Rel: "alternate", Href: p.Record, Type: RecordType})
+		}
+		if p.Href != "" {
+			publication.Links = append(publication.Links, Link{Rel: BorrowRel, Href: p.Href, Type: "text/html"})
+		}
+		if p.Author != "" {
+			publication.Metadata.Author = []jsonContributor{{Name: p.Author}}
+		}
+		if p.Subject != "" {
+			publication.Metadata.Subject = []string{p.Subject}
+		}
+		out.Publications = append(out.Publications, publication)
+	}
+
+	return json.Marshal(out)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"OpenSearchDescription"`
+	Xmlns         string          `xml:"xmlns,attr"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	URL           []openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// OpenSearch renders the OpenSearch description of the catalog search, template has a {searchTerms} placeholder.
+func OpenSearch(name, template string) ([]byte, error) {
+	body, err := xml.Marshal(openSearchDescription{
+		Xmlns:         "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:     name,
+		Description:   "Search the books by title or author",
+		InputEncoding: "UTF-8",
+		URL:           []openSearchURL{{Type: AcquisitionType, Template: template}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
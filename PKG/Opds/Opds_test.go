@@ -0,0 +1,73 @@
+package opds
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleFeed() Feed {
+	return Feed{
+		ID:          "urn:library:opds:new",
+		Title:       "New arrivals",
+		Updated:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Links:       []Link{{Rel: "self", Href: "http://localhost:9090/opds/new", Type: AcquisitionType}},
+		Acquisition: true,
+		Publications: []Publication{{
+			ID:      "urn:isbn:0261103342",
+			Title:   "The Hobbit",
+			Author:  "J. R. R. Tolkien",
+			Subject: "Fantasy fiction",
+			Issued:  time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC),
+			Href:    "https://opac.example.org/record/1",
+			Record:  "http://localhost:9090/oai?verb=GetRecord",
+		}},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	out, err := Atom(sampleFeed(), "Library")
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `<feed xmlns="http://www.w3.org/2005/Atom"`)
+	assert.Contains(t, string(out), `<dc:issued>1937-09-21</dc:issued>`)
+	assert.Contains(t, string(out), `<link rel="http://opds-spec.org/acquisition/borrow" href="https://opac.example.org/record/1" type="text/html">`)
+	assert.Contains(t, string(out), `<category term="Fantasy fiction" label="Fantasy fiction">`)
+}
+
+func TestJSON(t *testing.T) {
+	out, err := JSON(sampleFeed())
+	assert.NoError(t, err)
+
+	var feed map[string]any
+	assert.NoError(t, json.Unmarshal(out, &feed))
+	publications := feed["publications"].([]any)
+	assert.Len(t, publications, 1)
+	metadata := publications[0].(map[string]any)["metadata"].(map[string]any)
+	assert.Equal(t, "The Hobbit", metadata["title"])
+	assert.Equal(t, "urn:isbn:0261103342", metadata["identifier"])
+}
+
+func TestWithoutBorrowLink(t *testing.T) {
+	feed := sampleFeed()
+	feed.Publications[0].Href = ""
+
+	out, err := Atom(feed, "Library")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "acquisition/borrow")
+
+	// The record is still linked, an OPDS 2 publication needs at least one link
+	out, err = JSON(feed)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"links":[{"rel":"alternate","href":"http://localhost:9090/oai?verb=GetRecord","type":"application/xml"}]`)
+	assert.NotContains(t, string(out), "acquisition/borrow")
+}
+
+func TestOpenSearch(t *testing.T) {
+	out, err := OpenSearch("Library", "http://localhost:9090/opds/search?q={searchTerms}")
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `template="http://localhost:9090/opds/search?q={searchTerms}"`)
+}
@@ -0,0 +1,192 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	notify "github.com/Pyramakerz/Library_Management_System/PKG/Notify"
+	"gorm.io/gorm"
+)
+
+// Status of the messages
+const (
+	StatusPending = "pending" // waiting for its next attempt
+	StatusSent    = "sent"
+	StatusDead    = "dead" // every attempt failed, it stays until it is replayed
+)
+
+// ErrNotDead is returned when replaying a message which didn't fail, a pending message is already retried and a sent one would be sent twice
+var ErrNotDead = errors.New("only the dead messages can be replayed")
+
+// Number of messages sent at once by the worker
+const batchSize = 100
+
+// Lease is how long a message is hidden from the other workers while one is sending it, a worker which dies meanwhile
+// leaves the message to be retried after the lease.
+const Lease = 10 * time.Minute
+
+// Config of the worker
+type Config struct {
+	MaxAttempts int           // attempts before a message is dead
+	Backoff     time.Duration // delay after the first failure, doubled after each next one
+	MaxBackoff  time.Duration
+	Poll        time.Duration // time between two runs of the worker, 0 when it doesn't run
+}
+
+// Settings reads the config of the worker from OUTBOX_MAX_ATTEMPTS (default 8), OUTBOX_BACKOFF_SECONDS (default 30),
+// OUTBOX_MAX_BACKOFF_MINUTES (default 60) and OUTBOX_POLL_SECONDS (default 5, 0 turns the worker off).
+func Settings() Config {
+	return Config{
+		MaxAttempts: setting("OUTBOX_MAX_ATTEMPTS", 8, 1),
+		Backoff:     time.Duration(setting("OUTBOX_BACKOFF_SECONDS", 30, 1)) * time.Second,
+		MaxBackoff:  time.Duration(setting("OUTBOX_MAX_BACKOFF_MINUTES", 60, 1)) * time.Minute,
+		Poll:        time.Duration(setting("OUTBOX_POLL_SECONDS", 5, 0)) * time.Second,
+	}
+}
+
+// setting reads a number, fallback is used when it is missing, invalid or below min
+func setting(key string, fallback, min int) int {
+	n, err := strconv.Atoi(config.Getenv(key, strconv.Itoa(fallback)))
+	if err != nil || n < min {
+		return fallback
+	}
+	return n
+}
+
+// Delay returns the time to wait after the failed attempt number attempts (from 1) before the next one
+func (c Config) Delay(attempts int) time.Duration {
+	delay := c.Backoff
+	for i := 1; i < attempts && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return delay
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Enqueue renders a template for the recipients in their language (the default one when it is empty) and writes it to the outbox
+// in tx, it is sent once tx is committed.
+func Enqueue(tx *gorm.DB, template, language string, to []string, data map[string]any, now time.Time) (models.OutboxMessage, error) {
+	if len(to) == 0 {
+		return models.OutboxMessage{}, notify.ErrNoRecipient
+	}
+	msg, err := notify.Render(notify.Stored(tx), template, language, to, data)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+
+	message := models.OutboxMessage{
+		Template:      template,
+		Recipients:    strings.Join(msg.To, ","),
+		Subject:       msg.Subject,
+		Body:          msg.Body,
+		HTML:          msg.HTML,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+	}
+	err = tx.Create(&message).Error
+	return message, err
+}
+
+// Message returns the message to send of an outbox message
+func Message(message models.OutboxMessage) notify.Message {
+	return notify.Message{To: strings.Split(message.Recipients, ","), Subject: message.Subject, Body: message.Body, HTML: message.HTML}
+}
+
+// Processed counts the messages of a run of the worker
+type Processed struct {
+	Sent    int `json:"sent"`
+	Retried int `json:"retried"` // failed, tried again later
+	Dead    int `json:"dead"`    // failed for the last time
+}
+
+// Process sends the pending messages due at now, the oldest first. A failed message is tried again after Config.Delay,
+// or is dead after Config.MaxAttempts attempts. Several workers can run together, each message is claimed by one of them.
+func Process(db *gorm.DB, notifier notify.Notifier, c Config, now time.Time) (Processed, error) {
+	var processed Processed
+
+	// Each send can take up to the SMTP timeout, the leases and the results are dated when they are written
+	// and not when the run started, else the lease of the last messages of a batch would already be over
+	start := time.Now()
+	clock := func() time.Time { return now.Add(time.Since(start)) }
+
+	var due []models.OutboxMessage
+	err := db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("next_attempt_at, id").Limit(batchSize).Find(&due).Error
+	if err != nil {
+		return processed, err
+	}
+
+	for _, message := range due {
+		// The attempt is counted and the message leased before sending, the update only matches when no other worker claimed it first
+		claim := db.Model(&models.OutboxMessage{}).
+			Where("id = ? AND status = ? AND attempts = ? AND next_attempt_at <= ?", message.ID, StatusPending, message.Attempts, now).
+			Updates(map[string]any{"attempts": message.Attempts + 1, "next_attempt_at": clock().Add(Lease)})
+		if claim.Error != nil {
+			return processed, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		message.Attempts++
+
+		update := map[string]any{}
+		if err := notifier.Send(Message(message)); err == nil {
+			update["status"] = StatusSent
+			update["sent_at"] = clock()
+			update["last_error"] = ""
+			processed.Sent++
+		} else if message.Attempts >= c.MaxAttempts {
+			update["status"] = StatusDead
+			update["last_error"] = err.Error()
+			processed.Dead++
+		} else {
+			update["next_attempt_at"] = clock().Add(c.Delay(message.Attempts))
+			update["last_error"] = err.Error()
+			processed.Retried++
+		}
+		if err := db.Model(&models.OutboxMessage{}).Where("id = ?", message.ID).Updates(update).Error; err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// Replay makes a dead message pending again with all its attempts, it is sent by the next run of the worker.
+func Replay(tx *gorm.DB, message *models.OutboxMessage, now time.Time) error {
+	if message.Status != StatusDead {
+		return ErrNotDead
+	}
+	message.Status = StatusPending
+	message.Attempts = 0
+	message.NextAttemptAt = now
+	return tx.Model(message).Select("status", "attempts", "next_attempt_at").Updates(message).Error
+}
+
+// Schedule runs the worker every Config.Poll in the background with the notifier.
+func Schedule(db *gorm.DB, notifier notify.Notifier) {
+	c := Settings()
+	if c.Poll == 0 {
+		return
+	}
+
+	go func() {
+		for {
+			processed, err := Process(db, notifier, c, time.Now())
+			if err != nil {
+				fmt.Printf("[outbox] Failed to process the messages: %v\n", err)
+			} else if processed.Dead > 0 {
+				fmt.Printf("[outbox] Sent %d messages, %d failed for the last time and are in the dead letters\n", processed.Sent, processed.Dead)
+			}
+			time.Sleep(c.Poll)
+		}
+	}()
+}
@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	c := Config{Backoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+
+	assert.Equal(t, 30*time.Second, c.Delay(1))
+	assert.Equal(t, time.Minute, c.Delay(2))
+	assert.Equal(t, 4*time.Minute, c.Delay(4))
+	assert.Equal(t, 5*time.Minute, c.Delay(5))
+	assert.Equal(t, 5*time.Minute, c.Delay(100))
+}
+
+func TestSettings(t *testing.T) {
+	t.Setenv("OUTBOX_MAX_ATTEMPTS", "0")
+	t.Setenv("OUTBOX_BACKOFF_SECONDS", "10")
+	t.Setenv("OUTBOX_POLL_SECONDS", "0")
+
+	c := Settings()
+	assert.Equal(t, 8, c.MaxAttempts)
+	assert.Equal(t, 10*time.Second, c.Backoff)
+	assert.Equal(t, time.Hour, c.MaxBackoff)
+	assert.Equal(t, time.Duration(0), c.Poll)
+}
+
+func TestMessage(t *testing.T) {
+	msg := Message(models.OutboxMessage{Recipients: "john@example.com,johnny@example.com", Subject: "Hello", Body: "Hi"})
+	assert.Equal(t, []string{"john@example.com", "johnny@example.com"}, msg.To)
+	assert.Equal(t, "Hello", msg.Subject)
+}
@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limit is a token bucket, it holds Burst requests and gets PerMinute of them back every minute
+type Limit struct {
+	PerMinute float64
+	Burst     int
+}
+
+// Disabled tells if the requests are not limited.
+func (l Limit) Disabled() bool {
+	return l.PerMinute <= 0 || l.Burst <= 0
+}
+
+// Result of a request taken from a bucket, RetryAfter is when the next request will be allowed when it isn't
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets, in memory for a single server or in the database for several servers sharing the limits.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// take removes a request from a bucket having tokens at updated, it returns the tokens left at now
+func take(tokens float64, updated time.Time, limit Limit, now time.Time) (float64, Result) {
+	if elapsed := now.Sub(updated); elapsed > 0 {
+		tokens += elapsed.Minutes() * limit.PerMinute
+	}
+	tokens = math.Min(tokens, float64(limit.Burst))
+
+	if tokens < 1 {
+		wait := time.Duration((1 - tokens) / limit.PerMinute * float64(time.Minute))
+		return tokens, Result{Allowed: false, RetryAfter: wait}
+	}
+	tokens--
+	return tokens, Result{Allowed: true, Remaining: int(tokens)}
+}
+
+// full tells when a bucket having tokens at updated is full again, it can then be forgotten
+func full(tokens float64, updated time.Time, limit Limit) time.Time {
+	return updated.Add(time.Duration((float64(limit.Burst) - tokens) / limit.PerMinute * float64(time.Minute)))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Classes of clients, each one has its budgets
+const (
+	ClassIP     = "ip"     // the requests without a valid access token nor API key
+	ClassUser   = "user"   // access tokens
+	ClassAPIKey = "apikey" // API keys
+)
+
+// Budgets of the routes, the reads are GET, HEAD and OPTIONS
+const (
+	BudgetRead  = "read"
+	BudgetWrite = "write"
+)
+
+// Default limits per class and budget (requests per minute and burst)
+var defaultLimits = map[string]map[string]Limit{
+	ClassIP:     {BudgetRead: {PerMinute: 60, Burst: 30}, BudgetWrite: {PerMinute: 20, Burst: 10}},
+	ClassUser:   {BudgetRead: {PerMinute: 300, Burst: 100}, BudgetWrite: {PerMinute: 120, Burst: 40}},
+	ClassAPIKey: {BudgetRead: {PerMinute: 600, Burst: 200}, BudgetWrite: {PerMinute: 300, Burst: 100}},
+}
+
+// Limits returns the limit of each class and budget, set with RATE_LIMIT_<IP|USER|APIKEY>_<READ|WRITE> as "per minute:burst"
+// (e.g. RATE_LIMIT_IP_READ=60:30, the burst is the rate when it is left out and 0 turns the limit off).
+func Limits() map[string]map[string]Limit {
+	limits := map[string]map[string]Limit{}
+	for class, budgets := range defaultLimits {
+		limits[class] = map[string]Limit{}
+		for budget, fallback := range budgets {
+			value := config.Getenv("RATE_LIMIT_"+strings.ToUpper(class)+"_"+strings.ToUpper(budget), "")
+			limits[class][budget] = parseLimit(value, fallback)
+		}
+	}
+	return limits
+}
+
+func parseLimit(value string, fallback Limit) Limit {
+	if value == "" {
+		return fallback
+	}
+	rate, burst, hasBurst := strings.Cut(value, ":")
+	perMinute, err := strconv.ParseFloat(rate, 64)
+	if err != nil || perMinute < 0 {
+		return fallback
+	}
+	limit := Limit{PerMinute: perMinute, Burst: int(math.Ceil(perMinute))}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 0 {
+			return fallback
+		}
+	}
+	return limit
+}
+
+// Client returns the class and the ID of the client of a request, the API key and the user are known after auth.Identify.
+func Client(c *fiber.Ctx) (class, id string) {
+	if key, ok := auth.APIKey(c); ok {
+		return ClassAPIKey, strconv.FormatUint(uint64(key.ID), 10)
+	}
+	if claims, ok := auth.User(c); ok {
+		return ClassUser, claims.Subject
+	}
+	return ClassIP, c.IP()
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Middleware limits the requests of each client with the Limits() of its class, a client over its budget gets 429 with Retry-After.
+// The read and write routes have their own buckets so a scraper doesn't stop the edits. It goes after auth.Identify.
+// The requests are let through when the store fails, the limit protects the API but must not take it down.
+func Middleware(store Store) fiber.Handler {
+	limits := Limits()
+
+	return func(c *fiber.Ctx) error {
+		budget := BudgetWrite
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			budget = BudgetRead
+		}
+		class, id := Client(c)
+		limit := limits[class][budget]
+		if limit.Disabled() {
+			return c.Next()
+		}
+
+		result, err := store.Take(class+":"+id+":"+budget, limit, time.Now())
+		if err != nil {
+			fmt.Printf("Failed to check the rate limit: %v\n", err)
+			return c.Next()
+		}
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		if !result.Allowed {
+			seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":   true,
+				"message": fmt.Sprintf("Too many requests, retry in %d seconds", seconds),
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{PerMinute: 6, Burst: 2}
+	now := time.Now()
+
+	result, _ := store.Take("ip:1", limit, now)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1}, result)
+	result, _ = store.Take("ip:1", limit, now)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take("ip:1", limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 10*time.Second, result.RetryAfter)
+
+	// Another client has their own bucket, and a token comes back every 10 seconds
+	result, _ = store.Take("ip:2", limit, now)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take("ip:1", limit, now.Add(10*time.Second))
+	assert.True(t, result.Allowed)
+
+	// The full buckets are removed
+	store.Take("ip:3", limit, now.Add(time.Hour))
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestParseLimit(t *testing.T) {
+	fallback := Limit{PerMinute: 60, Burst: 30}
+	assert.Equal(t, fallback, parseLimit("", fallback))
+	assert.Equal(t, Limit{PerMinute: 100, Burst: 100}, parseLimit("100", fallback))
+	assert.Equal(t, Limit{PerMinute: 100, Burst: 20}, parseLimit("100:20", fallback))
+	assert.True(t, parseLimit("0", fallback).Disabled())
+	assert.Equal(t, fallback, parseLimit("fast", fallback))
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Setenv("RATE_LIMIT_IP_READ", "2:2")
+	t.Setenv("RATE_LIMIT_IP_WRITE", "1:1")
+	t.Setenv("RATE_LIMIT_USER_READ", "0")
+
+	app := fiber.New()
+	app.Use(auth.Identify())
+	app.Use(Middleware(NewMemoryStore()))
+	app.All("/sru", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	send := func(method, token string) *http.Response {
+		req := httptest.NewRequest(method, "/sru", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, _ := app.Test(req, -1)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "").StatusCode)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "").StatusCode)
+	resp := send(http.MethodGet, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get(fiber.HeaderRetryAfter))
+
+	// The writes have their own budget
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "").StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, send(http.MethodPost, "").StatusCode)
+
+	// A user is limited on their own (not at all here), an invalid token counts on the IP
+	token, _ := auth.Sign(auth.Claims{Subject: "1", ExpiresAt: time.Now().Add(time.Minute).Unix()}, auth.Secret())
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, token).StatusCode)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, send(http.MethodGet, "invalid").StatusCode)
+}
+
+func TestDatabaseStore(t *testing.T) {
+	config.Connect()
+	db := config.GetDB()
+	db.AutoMigrate(&models.RateLimitBucket{})
+	defer db.Where("bucket_key LIKE ?", "test:%").Delete(&models.RateLimitBucket{})
+
+	// Two servers share the bucket
+	first, second := NewDatabaseStore(db), NewDatabaseStore(db)
+	limit := Limit{PerMinute: 60, Burst: 2}
+	now := time.Now()
+
+	result, err := first.Take("test:1:read", limit, now)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, _ = second.Take("test:1:read", limit, now)
+	assert.True(t, result.Allowed)
+	result, _ = first.Take("test:1:read", limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	swept, err := first.Sweep(now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, swept, int64(1))
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How often the full buckets are removed
+const sweepInterval = time.Minute
+
+// NewStore returns the store of RATE_LIMIT_STORE, memory (default) or database to share the limits between the servers of the API.
+func NewStore() Store {
+	if config.Getenv("RATE_LIMIT_STORE", "memory") == "database" {
+		return NewDatabaseStore(config.GetDB())
+	}
+	return NewMemoryStore()
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// MemoryStore keeps the buckets of one server, they are lost on restart
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}}
+}
+
+// Take removes a request from the bucket of key, a new bucket is full.
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The full buckets are the same as no bucket, removing them keeps the memory of the clients gone
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, result = take(b.tokens, b.updated, limit, now)
+	b.updated = now
+	b.full = full(b.tokens, now, limit)
+	return result, nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// DatabaseStore keeps the buckets in the rate_limit_buckets table, the servers using the same database share the limits.
+// A bucket is locked while a request is taken from it.
+type DatabaseStore struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewDatabaseStore returns a store in db, the table is created by the migration of models.RateLimitBucket.
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+// Take removes a request from the bucket of key, a new bucket is full.
+func (s *DatabaseStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	sweep := now.Sub(s.lastSweep) >= sweepInterval
+	if sweep {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if sweep {
+		if _, err := s.Sweep(now); err != nil {
+			return Result{}, err
+		}
+	}
+
+	var result Result
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// The bucket is created first so that the row exists to be locked, by this server or another one
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RateLimitBucket{
+			Key: key, Tokens: float64(limit.Burst), UpdatedAt: now, FullAt: now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var bucket models.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket_key = ?", key).First(&bucket).Error; err != nil {
+			return err
+		}
+
+		bucket.Tokens, result = take(bucket.Tokens, bucket.UpdatedAt, limit, now)
+		return tx.Model(&bucket).Updates(map[string]any{"tokens": bucket.Tokens, "updated_at": now, "full_at": full(bucket.Tokens, now, limit)}).Error
+	})
+	return result, err
+}
+
+// Sweep removes the buckets full again at now, they are recreated full. Each server sweeps every minute on its requests.
+func (s *DatabaseStore) Sweep(now time.Time) (int64, error) {
+	result := s.db.Where("full_at <= ?", now).Delete(&models.RateLimitBucket{})
+	return result.RowsAffected, result.Error
+}
@@ -1,24 +1,142 @@
 package routes
 
 import (
+	auth "github.com/Pyramakerz/Library_Management_System/PKG/Auth"
 	controllers "github.com/Pyramakerz/Library_Management_System/PKG/Controllers"
+	ratelimit "github.com/Pyramakerz/Library_Management_System/PKG/RateLimit"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 // app *fiber.App ==> pointer to configure routes and middleware for your web application.
 func Library_Management_System_Routes(app *fiber.App) {
-	app.Get("/api/author", controllers.GetAllAuthors)
-	app.Get("/api/author/:authorid", controllers.GetAuthorByID)
-	app.Post("/api/author", controllers.CreateAuthor)
-	app.Put("/api/author/:authorid", controllers.UpdateAuthor)
-	app.Delete("/api/author/:authorid", controllers.DeleteAuthor)
-	app.Delete("/api/author/softdelete/:authorid", controllers.SoftDeleteAuthor)
-
-	app.Get("/api/book", controllers.GetAllBooks)
-	app.Get("/api/book/:bookid", controllers.GetBookByID)
-	app.Post("/api/book", controllers.CreateBook)
-	app.Put("/api/book/:bookid", controllers.UpdateBook)
-	app.Delete("/api/book/:bookid", controllers.DeleteBook)
-	app.Delete("/api/book/softdelete/:bookid", controllers.SoftDeleteBook)
-	app.Get("/api/book/search/:title", controllers.SearchBooksByTitle)
+	// Every request gets an X-Request-ID (the one sent by the client is kept), it is saved in the audit log
+	app.Use(requestid.New())
+
+	// Every client has a budget of requests per minute for the reads and one for the writes, per user, API key or IP for the anonymous
+	// requests (also the login and the public harvesting routes)
+	app.Use(auth.Identify())
+	app.Use(ratelimit.Middleware(ratelimit.NewStore()))
+
+	// The login routes (also single sign-on) are the only /api routes open to everyone, the harvesting protocols (OAI-PMH, OPDS, SRU and the feeds) are public too
+	app.Post("/api/auth/login", controllers.Login)
+	app.Post("/api/auth/refresh", controllers.RefreshTokens)
+	app.Post("/api/auth/logout", controllers.Logout)
+	app.Get("/api/auth/oidc/login", controllers.OidcLogin)
+	app.Get("/api/auth/oidc/callback", controllers.OidcCallback)
+
+	// Every other /api route needs an access token or an API key, it is registered after the login routes so they don't go through it
+	app.Use("/api", auth.Middleware())
+
+	// The permission each route requires, a user without it gets 403 (the routes of the current user only need a valid token)
+	readCatalog := auth.Require(auth.PermCatalogRead)
+	writeCatalog := auth.Require(auth.PermCatalogWrite)
+	deleteCatalog := auth.Require(auth.PermCatalogDelete)
+	readPatrons := auth.Require(auth.PermPatronsRead)
+	writePatrons := auth.Require(auth.PermPatronsWrite)
+	readLoans := auth.RequireAny(auth.PermPatronsRead, auth.PermOwnLoansRead)
+	readAudit := auth.Require(auth.PermAuditRead)
+	manageUsers := auth.Require(auth.PermUsersManage)
+
+	app.Post("/api/auth/logout/all", controllers.LogoutEverywhere)
+	app.Get("/api/auth/me", controllers.GetCurrentUser)
+	app.Post("/api/auth/2fa/enroll", controllers.EnrollTwoFactor)
+	app.Post("/api/auth/2fa/confirm", controllers.ConfirmTwoFactor)
+	app.Post("/api/auth/2fa/recovery", controllers.RegenerateRecoveryCodes)
+	app.Delete("/api/auth/2fa", controllers.DisableTwoFactor)
+
+	app.Get("/api/role", manageUsers, controllers.GetAllRoles)
+	app.Post("/api/role", manageUsers, controllers.CreateRole)
+	app.Put("/api/role/:roleid", manageUsers, controllers.UpdateRole)
+	app.Delete("/api/role/:roleid", manageUsers, controllers.DeleteRole)
+
+	app.Get("/api/apikey", manageUsers, controllers.GetAllAPIKeys)
+	app.Post("/api/apikey", manageUsers, controllers.CreateAPIKey)
+	app.Delete("/api/apikey/:keyid", manageUsers, controllers.RevokeAPIKey)
+
+	app.Get("/api/user", manageUsers, controllers.GetAllUsers)
+	app.Post("/api/user", manageUsers, controllers.CreateUser)
+	app.Put("/api/user/:userid", manageUsers, controllers.UpdateUser)
+	app.Delete("/api/user/:userid", manageUsers, controllers.DeleteUser)
+	app.Delete("/api/user/:userid/2fa", manageUsers, controllers.ResetUserTwoFactor)
+
+	app.Get("/api/author", readCatalog, controllers.GetAllAuthors)
+	app.Get("/api/author/trash", writeCatalog, controllers.GetAuthorTrash)
+	app.Get("/api/author/:authorid", readCatalog, controllers.GetAuthorByID)
+	app.Post("/api/author", writeCatalog, controllers.CreateAuthor)
+	app.Put("/api/author/:authorid", writeCatalog, controllers.UpdateAuthor)
+	app.Delete("/api/author/:authorid", deleteCatalog, controllers.DeleteAuthor)
+	app.Delete("/api/author/softdelete/:authorid", writeCatalog, controllers.SoftDeleteAuthor)
+	app.Get("/api/author/:authorid/history", writeCatalog, controllers.GetAuthorHistory)
+	app.Post("/api/author/:authorid/revert/:version", writeCatalog, controllers.RevertAuthor)
+	app.Post("/api/author/:authorid/restore", writeCatalog, controllers.RestoreAuthor)
+
+	app.Get("/api/book", readCatalog, controllers.GetAllBooks)
+	app.Get("/api/book/export", readCatalog, controllers.ExportBooks)
+	app.Get("/api/book/cite", readCatalog, controllers.CiteBooks)
+	app.Get("/api/book/trash", writeCatalog, controllers.GetBookTrash)
+	app.Get("/api/book/:bookid", readCatalog, controllers.GetBookByID)
+	app.Post("/api/book", writeCatalog, controllers.CreateBook)
+	app.Post("/api/book/import", writeCatalog, controllers.ImportBooks)
+	app.Put("/api/book/:bookid", writeCatalog, controllers.UpdateBook)
+	app.Delete("/api/book/:bookid", deleteCatalog, controllers.DeleteBook)
+	app.Delete("/api/book/softdelete/:bookid", writeCatalog, controllers.SoftDeleteBook)
+	app.Get("/api/book/search/:title", readCatalog, controllers.SearchBooksByTitle)
+	app.Get("/api/book/:bookid/marc", readCatalog, controllers.ExportBookMarc)
+	app.Get("/api/book/:bookid/cite", readCatalog, controllers.CiteBook)
+	app.Get("/api/book/:bookid/history", writeCatalog, controllers.GetBookHistory)
+	app.Post("/api/book/:bookid/revert/:version", writeCatalog, controllers.RevertBook)
+	app.Post("/api/book/:bookid/restore", writeCatalog, controllers.RestoreBook)
+
+	app.Post("/api/marc/import", writeCatalog, controllers.ImportMarc)
+	app.Get("/api/marc/export", readCatalog, controllers.ExportMarc)
+
+	app.Get("/api/suggest", readCatalog, controllers.Suggest)
+
+	app.Get("/api/audit", readAudit, controllers.GetAuditLogs)
+	app.Get("/api/audit/verify", readAudit, controllers.VerifyAuditLog)
+
+	app.Get("/api/outbox", manageUsers, controllers.GetOutboxMessages)
+	app.Post("/api/outbox/replay", manageUsers, controllers.ReplayDeadOutboxMessages)
+	app.Get("/api/outbox/:messageid", manageUsers, controllers.GetOutboxMessage)
+	app.Post("/api/outbox/:messageid/replay", manageUsers, controllers.ReplayOutboxMessage)
+
+	app.Get("/api/template", manageUsers, controllers.GetAllEmailTemplates)
+	app.Get("/api/template/:name/:language", manageUsers, controllers.GetEmailTemplate)
+	app.Put("/api/template/:name/:language", manageUsers, controllers.SaveEmailTemplate)
+	app.Delete("/api/template/:name/:language", manageUsers, controllers.DeleteEmailTemplate)
+	app.Get("/api/template/:name/:language/preview", manageUsers, controllers.PreviewEmailTemplate)
+	app.Post("/api/template/:name/:language/preview", manageUsers, controllers.PreviewEmailTemplateDraft)
+
+	app.Get("/api/patron", readPatrons, controllers.GetAllPatrons)
+	app.Post("/api/patron/sync", writePatrons, controllers.SyncPatrons)
+	app.Get("/api/patron/:patronid", readPatrons, controllers.GetPatronByID)
+	app.Get("/api/patron/:patronid/loans", readLoans, controllers.GetPatronLoans)
+	app.Post("/api/patron", writePatrons, controllers.CreatePatron)
+	app.Put("/api/patron/:patronid", writePatrons, controllers.UpdatePatron)
+	app.Delete("/api/patron/:patronid", writePatrons, controllers.DeletePatron)
+
+	app.Get("/oai", controllers.OaiPmh)
+	app.Post("/oai", controllers.OaiPmh)
+
+	app.Get("/opds", controllers.OpdsRoot)
+	app.Get("/opds/new", controllers.OpdsNewArrivals)
+	app.Get("/opds/authors", controllers.OpdsAuthors)
+	app.Get("/opds/authors/:authorid", controllers.OpdsAuthorBooks)
+	app.Get("/opds/subjects", controllers.OpdsSubjects)
+	app.Get("/opds/subjects/:subject", controllers.OpdsSubjectBooks)
+	app.Get("/opds/search", controllers.OpdsSearch)
+	app.Get("/opds/opensearch.xml", controllers.OpdsOpenSearch)
+	app.Get("/opds2", controllers.OpdsRoot)
+	app.Get("/opds2/new", controllers.OpdsNewArrivals)
+	app.Get("/opds2/authors", controllers.OpdsAuthors)
+	app.Get("/opds2/authors/:authorid", controllers.OpdsAuthorBooks)
+	app.Get("/opds2/subjects", controllers.OpdsSubjects)
+	app.Get("/opds2/subjects/:subject", controllers.OpdsSubjectBooks)
+	app.Get("/opds2/search", controllers.OpdsSearch)
+
+	app.Get("/sru", controllers.Sru)
+
+	app.Get("/feeds/new.atom", controllers.NewAcquisitionsFeed)
+	app.Get("/feeds/new.rss", controllers.NewAcquisitionsFeed)
 }
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// The middleware answers before any handler so no database is needed
+func TestAPIRoutesNeedAccessToken(t *testing.T) {
+	// Every route is called from the same IP
+	t.Setenv("RATE_LIMIT_IP_READ", "0")
+	t.Setenv("RATE_LIMIT_IP_WRITE", "0")
+
+	app := fiber.New()
+	Library_Management_System_Routes(app)
+
+	public := map[string]bool{
+		"/api/auth/login":         true,
+		"/api/auth/refresh":       true,
+		"/api/auth/logout":        true,
+		"/api/auth/oidc/login":    true,
+		"/api/auth/oidc/callback": true,
+	}
+
+	for _, route := range app.GetRoutes(true) {
+		if !strings.HasPrefix(route.Path, "/api/") || public[route.Path] || route.Method == fiber.MethodHead {
+			continue
+		}
+		path := strings.NewReplacer(":bookid", "1", ":authorid", "1", ":userid", "1", ":patronid", "1", ":version", "1", ":id", "1").Replace(route.Path)
+
+		req := httptest.NewRequest(route.Method, path, nil)
+		resp, err := app.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, route.Method+" "+route.Path)
+	}
+}
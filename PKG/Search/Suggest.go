@@ -0,0 +1,203 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+// Suggestion is one typeahead result returned to the front-end search box.
+type Suggestion struct {
+	Type  string `json:"type"` // "book" or "author"
+	ID    uint   `json:"id"`
+	Text  string `json:"text"`
+	Score uint   `json:"score"`
+}
+
+// key is one searchable prefix entry, every word of a title or a name starts its own key
+// so "pot" finds "Harry Potter" and not only the titles starting with "pot".
+type key struct {
+	text  string
+	entry int
+}
+
+type entry struct {
+	kind string
+	id   uint
+	text string
+}
+
+type index struct {
+	mu         sync.RWMutex
+	rebuild    sync.Mutex // only one refresh loads from the database at a time
+	generation uint64     // bumped by every Invalidate
+	built      uint64     // generation the entries were built from
+	entries    []entry
+	keys       []key
+	books      map[uint][]uint // author ID ==> IDs of their books
+	views      map[uint]uint   // book ID ==> number of times it was opened
+}
+
+var idx = &index{generation: 1, views: map[uint]uint{}}
+
+// Watch registers GORM callbacks so that any create, update or delete on books or authors
+// marks the index as stale, the next Suggest call then rebuilds it from the database.
+func Watch(db *gorm.DB) {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil {
+			return
+		}
+		switch tx.Statement.Schema.Table {
+		case "books", "authors":
+			Invalidate()
+		}
+	}
+
+	db.Callback().Create().After("gorm:create").Register("search:invalidate_create", invalidate)
+	db.Callback().Update().After("gorm:update").Register("search:invalidate_update", invalidate)
+	db.Callback().Delete().After("gorm:delete").Register("search:invalidate_delete", invalidate)
+}
+
+// Invalidate marks the in-memory index as stale.
+func Invalidate() {
+	idx.mu.Lock()
+	idx.generation++
+	idx.mu.Unlock()
+}
+
+// RecordView counts one visit of a book, it is the popularity used to rank the suggestions.
+func RecordView(bookID uint) {
+	idx.mu.Lock()
+	idx.views[bookID]++
+	idx.mu.Unlock()
+}
+
+// Suggest returns at most limit titles and author names having a word starting with prefix,
+// ordered by popularity (book views, and for authors the views of all their books plus their book count).
+func Suggest(db *gorm.DB, prefix string, limit int) ([]Suggestion, error) {
+	if err := idx.refresh(db); err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.lookup(normalize(prefix), limit), nil
+}
+
+// refresh rebuilds the index when it was invalidated since the last build. The generation is read
+// before loading, so an Invalidate arriving while the rows are loaded leaves the index stale
+// and the next call loads them again.
+func (i *index) refresh(db *gorm.DB) error {
+	if i.fresh() {
+		return nil
+	}
+
+	i.rebuild.Lock()
+	defer i.rebuild.Unlock()
+
+	i.mu.RLock()
+	generation, built := i.generation, i.built
+	i.mu.RUnlock()
+	if generation == built {
+		return nil // rebuilt by another call while waiting
+	}
+
+	var books []models.Book
+	if err := db.Select("id", "title", "author_id").Find(&books).Error; err != nil {
+		return err
+	}
+	var authors []models.Author
+	if err := db.Select("id", "name").Find(&authors).Error; err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.build(books, authors)
+	i.built = generation
+	i.mu.Unlock()
+	return nil
+}
+
+func (i *index) fresh() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.generation == i.built
+}
+
+// build must be called with the write lock held.
+func (i *index) build(books []models.Book, authors []models.Author) {
+	i.entries = i.entries[:0]
+	i.keys = i.keys[:0]
+	i.books = map[uint][]uint{}
+
+	add := func(e entry) {
+		i.entries = append(i.entries, e)
+		words := strings.Fields(strings.ToLower(e.text))
+		for w := range words {
+			i.keys = append(i.keys, key{text: strings.Join(words[w:], " "), entry: len(i.entries) - 1})
+		}
+	}
+
+	for _, b := range books {
+		add(entry{kind: "book", id: b.ID, text: b.Title})
+		i.books[b.AuthorID] = append(i.books[b.AuthorID], b.ID)
+	}
+	for _, a := range authors {
+		add(entry{kind: "author", id: a.ID, text: a.Name})
+	}
+
+	sort.Slice(i.keys, func(a, b int) bool { return i.keys[a].text < i.keys[b].text })
+}
+
+// lookup must be called with the read lock held.
+func (i *index) lookup(prefix string, limit int) []Suggestion {
+	results := []Suggestion{}
+	if prefix == "" || limit <= 0 {
+		return results
+	}
+
+	// The keys are sorted so all the keys having this prefix are next to each other
+	start := sort.Search(len(i.keys), func(k int) bool { return i.keys[k].text >= prefix })
+
+	seen := map[int]bool{}
+	for k := start; k < len(i.keys) && strings.HasPrefix(i.keys[k].text, prefix); k++ {
+		if seen[i.keys[k].entry] {
+			continue
+		}
+		seen[i.keys[k].entry] = true
+
+		e := i.entries[i.keys[k].entry]
+		results = append(results, Suggestion{Type: e.kind, ID: e.id, Text: e.text, Score: i.score(e)})
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].Text < results[b].Text
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (i *index) score(e entry) uint {
+	if e.kind == "book" {
+		return i.views[e.id]
+	}
+
+	var score uint
+	for _, bookID := range i.books[e.id] {
+		score += i.views[bookID] + 1
+	}
+	return score
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
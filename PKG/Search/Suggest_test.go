@@ -0,0 +1,62 @@
+package search
+
+import (
+	"testing"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIndex() *index {
+	i := &index{views: map[uint]uint{}}
+	i.build(
+		[]models.Book{
+			{ID: 1, Title: "Harry Potter and the Chamber of Secrets", AuthorID: 1},
+			{ID: 2, Title: "Harry Potter and the Goblet of Fire", AuthorID: 1},
+			{ID: 3, Title: "The Hobbit", AuthorID: 2},
+		},
+		[]models.Author{
+			{ID: 1, Name: "J. K. Rowling"},
+			{ID: 2, Name: "J. R. R. Tolkien"},
+		},
+	)
+	return i
+}
+
+func TestSuggestMatchesAnyWordPrefix(t *testing.T) {
+	i := newTestIndex()
+
+	results := i.lookup(normalize("pot"), 10)
+
+	assert.Len(t, results, 2)
+	for _, r := range results {
+		assert.Equal(t, "book", r.Type)
+	}
+}
+
+func TestSuggestRanksByPopularity(t *testing.T) {
+	i := newTestIndex()
+	i.views[2] = 5
+
+	results := i.lookup(normalize("Harry"), 1)
+
+	assert.Len(t, results, 1)
+	assert.Equal(t, uint(2), results[0].ID)
+}
+
+func TestSuggestAuthorsAndTitles(t *testing.T) {
+	i := newTestIndex()
+
+	results := i.lookup(normalize("  T"), 10)
+
+	// "The Hobbit", "the Chamber ...", "the Goblet ..." and "Tolkien" (ranked first as author of one book)
+	assert.Len(t, results, 4)
+	assert.Equal(t, "author", results[0].Type)
+	assert.Equal(t, uint(2), results[0].ID)
+}
+
+func TestSuggestEmptyPrefix(t *testing.T) {
+	i := newTestIndex()
+
+	assert.Empty(t, i.lookup(normalize(""), 10))
+}
@@ -0,0 +1,191 @@
+package sip2
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message identifiers of the requests (SC ==> ACS) and their responses
+const (
+	CheckinRequest          = "09"
+	CheckinResponse         = "10"
+	CheckoutRequest         = "11"
+	CheckoutResponse        = "12"
+	ItemInformationRequest  = "17"
+	ItemInformationResponse = "18"
+	PatronStatusRequest     = "23"
+	PatronStatusResponse    = "24"
+	RenewRequest            = "29"
+	RenewResponse           = "30"
+	EndPatronSessionRequest = "35"
+	EndSessionResponse      = "36"
+	LoginRequest            = "93"
+	LoginResponse           = "94"
+	RequestSCResend         = "96"
+	RequestACSResend        = "97"
+	ACSStatus               = "98"
+	SCStatus                = "99"
+)
+
+// Length of the fixed fields that follow the identifier of each request
+var fixedLengths = map[string]int{
+	CheckinRequest:          37,
+	CheckoutRequest:         38,
+	ItemInformationRequest:  18,
+	PatronStatusRequest:     21,
+	RenewRequest:            38,
+	EndPatronSessionRequest: 18,
+	LoginRequest:            2,
+	RequestACSResend:        0,
+	SCStatus:                8,
+}
+
+// DateLayout is the 18 characters date of the protocol, the 4 spaces are the local time zone ==> 20240131    153000
+const DateLayout = "20060102    150405"
+
+var (
+	ErrChecksum       = errors.New("invalid checksum")
+	ErrUnknownMessage = errors.New("unknown message")
+)
+
+// Message is a SIP2 request, Sequence is -1 when it has no error detection fields (AY and AZ).
+type Message struct {
+	Code     string
+	Fixed    string
+	Fields   map[string][]string
+	Sequence int
+}
+
+// Field returns the first value of a variable field ==> AA patron identifier
+func (m *Message) Field(id string) string {
+	if values := m.Fields[id]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Has reports if the variable field is present, even empty.
+func (m *Message) Has(id string) bool {
+	_, ok := m.Fields[id]
+	return ok
+}
+
+// Parse parses a request, the checksum is verified when the message has one.
+// An unsupported request is returned with ErrUnknownMessage so its identifier can be logged.
+func Parse(raw string) (*Message, error) {
+	raw = strings.TrimRight(raw, "\r\n")
+	if len(raw) < 2 {
+		return nil, ErrUnknownMessage
+	}
+
+	m := &Message{Code: raw[:2], Fields: map[string][]string{}, Sequence: -1}
+
+	// The error detection fields end the message ==> ...|AY1AZF3A2
+	if i := strings.LastIndex(raw, "AZ"); i >= 2 && len(raw)-i == 6 {
+		if Checksum(raw[:i+2]) != strings.ToUpper(raw[i+2:]) {
+			return nil, ErrChecksum
+		}
+		raw = raw[:i]
+		if j := len(raw) - 3; j >= 2 && raw[j:j+2] == "AY" {
+			seq, err := strconv.Atoi(raw[j+2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid sequence number %q", raw[j+2:])
+			}
+			m.Sequence = seq
+			raw = raw[:j]
+		}
+	}
+
+	length, ok := fixedLengths[m.Code]
+	if !ok {
+		return m, ErrUnknownMessage
+	}
+	if len(raw) < 2+length {
+		return nil, fmt.Errorf("message %s is too short", m.Code)
+	}
+	m.Fixed = raw[2 : 2+length]
+
+	for _, field := range strings.Split(raw[2+length:], "|") {
+		if len(field) < 2 {
+			continue
+		}
+		m.Fields[field[:2]] = append(m.Fields[field[:2]], field[2:])
+	}
+	return m, nil
+}
+
+// Checksum returns the checksum of a message up to and including AZ, the two's complement of the sum of its bytes.
+func Checksum(s string) string {
+	var sum uint16
+	for i := 0; i < len(s); i++ {
+		sum += uint16(s[i])
+	}
+	return fmt.Sprintf("%04X", -sum)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Response builds a message sent by the ACS.
+type Response struct {
+	b strings.Builder
+}
+
+// NewResponse starts a response with its identifier and fixed fields.
+func NewResponse(code string, fixed ...string) *Response {
+	r := &Response{}
+	r.b.WriteString(code)
+	for _, f := range fixed {
+		r.b.WriteString(f)
+	}
+	return r
+}
+
+// Add appends a variable field, the field delimiter is removed from the value.
+func (r *Response) Add(id, value string) *Response {
+	r.b.WriteString(id)
+	r.b.WriteString(strings.ReplaceAll(value, "|", " "))
+	r.b.WriteString("|")
+	return r
+}
+
+// AddIf appends a variable field when its value isn't empty.
+func (r *Response) AddIf(id, value string) *Response {
+	if value != "" {
+		r.Add(id, value)
+	}
+	return r
+}
+
+// Encode returns the message terminated by a carriage return, with the error detection fields when sequence isn't -1.
+func (r *Response) Encode(sequence int) string {
+	s := r.b.String()
+	if sequence >= 0 {
+		s += "AY" + strconv.Itoa(sequence) + "AZ"
+		s += Checksum(s)
+	}
+	return s + "\r"
+}
+
+// Date formats a time in the protocol layout.
+func Date(t time.Time) string {
+	return t.Format(DateLayout)
+}
+
+// YN returns Y or N ==> the boolean fixed fields
+func YN(b bool) string {
+	if b {
+		return "Y"
+	}
+	return "N"
+}
+
+// Bit returns 1 or 0 ==> the ok fixed fields
+func Bit(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,56 @@
+package sip2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	assert.Equal(t, "FCA5", Checksum("9900302.00AY1AZ"))
+}
+
+func TestParse(t *testing.T) {
+	m, err := Parse("9300CNkiosk|COsecret|CPMain|AY0AZF479\r")
+	if assert.NoError(t, err) {
+		assert.Equal(t, LoginRequest, m.Code)
+		assert.Equal(t, "00", m.Fixed)
+		assert.Equal(t, "kiosk", m.Field("CN"))
+		assert.Equal(t, "secret", m.Field("CO"))
+		assert.Equal(t, 0, m.Sequence)
+	}
+
+	m, err = Parse("2300120240131    153000AOlibrary|AA1001|AD|")
+	if assert.NoError(t, err) {
+		assert.Equal(t, -1, m.Sequence)
+		assert.Equal(t, "1001", m.Field("AA"))
+		assert.True(t, m.Has("AD"))
+		assert.False(t, m.Has("AC"))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse("9900302.00AY1AZFCA4")
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	m, err := Parse("6300120240131    153000          AOlibrary|AA1001|")
+	assert.ErrorIs(t, err, ErrUnknownMessage)
+	assert.Equal(t, "63", m.Code)
+
+	_, err = Parse("17202401")
+	assert.Error(t, err)
+}
+
+func TestResponseEncode(t *testing.T) {
+	now := time.Date(2024, 1, 31, 15, 30, 0, 0, time.Local)
+	out := NewResponse(CheckoutResponse, Bit(true), YN(false), "U", YN(true), Date(now)).
+		Add("AO", "library").
+		Add("AJ", "Title | Subtitle").
+		AddIf("AF", "").
+		Encode(3)
+
+	assert.Equal(t, "121NUY20240131    153000AOlibrary|AJTitle   Subtitle|AY3AZ", out[:len(out)-5])
+	assert.Equal(t, Checksum(out[:len(out)-5]), out[len(out)-5:len(out)-1])
+	assert.Equal(t, "941\r", NewResponse(LoginResponse, Bit(true)).Encode(-1))
+}
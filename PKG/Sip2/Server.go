@@ -0,0 +1,461 @@
+package sip2
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	circulation "github.com/Pyramakerz/Library_Management_System/PKG/Circulation"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+// Messages answered by the server, in the order of the BX field of the ACS status:
+// patron status, checkout, checkin, block patron, SC/ACS status, resend, login, patron information,
+// end patron session, fee paid, item information, item status update, patron enable, hold, renew, renew all
+const supportedMessages = "YYYNYYYNYNYNNNYN"
+
+const (
+	// A kiosk that sends nothing for this long, or doesn't read its response, is disconnected
+	messageTimeout = 5 * time.Minute
+	// The SIP2 messages are a few hundred bytes, a longer one closes the connection
+	maxMessageLength = 4096
+
+	// After maxPinFailures wrong PINs in a row a patron waits pinBackoff, doubled after each next wrong PIN
+	maxPinFailures = 3
+	pinBackoff     = 30 * time.Second
+	maxPinBackoff  = 15 * time.Minute
+)
+
+var (
+	errPatronNotFound = errors.New("patron not found")
+	errNoPin          = errors.New("no PIN is set, please ask the library staff")
+	errInvalidPin     = errors.New("invalid PIN")
+	errItemNotFound   = errors.New("item not found")
+	errPinLocked      = errors.New("too many invalid PINs, please try again later")
+
+	// ErrLoginRequired is returned by Serve when the kiosks could connect from other machines without a login
+	ErrLoginRequired = errors.New("SIP2_LOGIN_USER and SIP2_LOGIN_PASSWORD must be set to listen on another address than localhost")
+)
+
+// Server is an ACS (automated circulation system) answering the SIP2 requests of the self-checkout kiosks.
+// Patrons are identified by their barcode and items by the ISBN of the book.
+type Server struct {
+	DB            *gorm.DB
+	InstitutionID string
+	LibraryName   string
+	// The kiosks must login with these credentials when LoginUser is set
+	LoginUser     string
+	LoginPassword string
+	// Now is replaced in the tests
+	Now func() time.Time
+
+	mu          sync.Mutex
+	pinFailures map[uint]*pinFailures // patron ID ==> wrong PINs in a row
+}
+
+// pinFailures counts the wrong PINs in a row of a patron
+type pinFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+// NewServer returns a server configured with the SIP2_* environment variables.
+func NewServer(db *gorm.DB) *Server {
+	return &Server{
+		DB:            db,
+		InstitutionID: config.Getenv("SIP2_INSTITUTION_ID", "library"),
+		LibraryName:   config.Getenv("SIP2_LIBRARY_NAME", "Library Management System"),
+		LoginUser:     config.Getenv("SIP2_LOGIN_USER", ""),
+		LoginPassword: config.Getenv("SIP2_LOGIN_PASSWORD", ""),
+		Now:           time.Now,
+	}
+}
+
+// ListenAndServe accepts the kiosk connections on a TCP address ==> localhost:6001
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve handles each connection of the listener in its own goroutine. Without the login credentials
+// it only serves a loopback address, the kiosks could otherwise check out in the name of any patron.
+func (s *Server) Serve(listener net.Listener) error {
+	if (s.LoginUser == "" || s.LoginPassword == "") && !isLoopback(listener.Addr()) {
+		listener.Close()
+		return ErrLoginRequired
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// isLoopback reports if only this machine can connect to addr, a TCP listener without host listens on every interface
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return !ok || tcp.IP.IsLoopback()
+}
+
+// session is the state of a kiosk connection
+type session struct {
+	loggedIn     bool
+	lastRequest  string
+	lastResponse string
+}
+
+// ServeConn answers the messages of a connection until it is closed, the messages end with a carriage return.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	defer func() {
+		// A failing message only closes the connection of its kiosk
+		if r := recover(); r != nil {
+			fmt.Printf("Failed to serve the SIP2 connection of %s: %v\n", conn.RemoteAddr(), r)
+		}
+	}()
+
+	sess := &session{loggedIn: s.LoginUser == ""}
+	// ReadSlice fails with bufio.ErrBufferFull when no carriage return is found in maxMessageLength bytes
+	reader := bufio.NewReaderSize(conn, maxMessageLength)
+	for {
+		// The deadline covers reading a message and writing its response
+		if err := conn.SetDeadline(time.Now().Add(messageTimeout)); err != nil {
+			return
+		}
+
+		line, err := reader.ReadSlice('\r')
+		if err != nil {
+			return
+		}
+
+		raw := strings.Trim(string(line), "\r\n")
+		if raw == "" {
+			continue
+		}
+
+		response, ok := s.handle(sess, raw)
+		if !ok {
+			return
+		}
+		if response == "" {
+			continue
+		}
+		if _, err := conn.Write([]byte(response)); err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the response to a message, ok is false when the connection must be closed.
+func (s *Server) handle(sess *session, raw string) (response string, ok bool) {
+	m, err := Parse(raw)
+	if errors.Is(err, ErrUnknownMessage) {
+		// The kiosks learn the supported messages from the ACS status, the others are ignored
+		return "", true
+	}
+	if err != nil {
+		// The kiosk sends the message again
+		return NewResponse(RequestSCResend).Encode(-1), true
+	}
+
+	if m.Code == RequestACSResend {
+		return sess.lastResponse, true
+	}
+
+	// A kiosk that didn't get the response retries with the same sequence number, the message isn't processed twice
+	if m.Sequence >= 0 && raw == sess.lastRequest {
+		return sess.lastResponse, true
+	}
+
+	if !sess.loggedIn && m.Code != LoginRequest {
+		return "", false
+	}
+
+	var r *Response
+	switch m.Code {
+	case LoginRequest:
+		r = s.login(sess, m)
+	case SCStatus:
+		r = s.status()
+	case PatronStatusRequest:
+		r = s.patronStatus(m)
+	case ItemInformationRequest:
+		r = s.itemInformation(m)
+	case CheckoutRequest:
+		r = s.checkout(m)
+	case CheckinRequest:
+		r = s.checkin(m)
+	case RenewRequest:
+		r = s.renew(m)
+	case EndPatronSessionRequest:
+		r = NewResponse(EndSessionResponse, "Y", Date(s.Now())).Add("AO", s.InstitutionID).Add("AA", m.Field("AA"))
+	}
+
+	sess.lastRequest = raw
+	sess.lastResponse = r.Encode(m.Sequence)
+	return sess.lastResponse, true
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func (s *Server) login(sess *session, m *Message) *Response {
+	ok := s.LoginUser == "" ||
+		(subtle.ConstantTimeCompare([]byte(m.Field("CN")), []byte(s.LoginUser)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(m.Field("CO")), []byte(s.LoginPassword)) == 1)
+	sess.loggedIn = ok
+	return NewResponse(LoginResponse, Bit(ok))
+}
+
+func (s *Server) status() *Response {
+	// online, checkin, checkout, renewal policy, status update, offline, timeout, retries
+	return NewResponse(ACSStatus, "YYYYNN", "030", "003", Date(s.Now()), "2.00").
+		Add("AO", s.InstitutionID).
+		Add("AM", s.LibraryName).
+		Add("BX", supportedMessages)
+}
+
+func (s *Server) patronStatus(m *Message) *Response {
+	now := s.Now()
+	patron, err := s.findPatron(m.Field("AA"))
+	expired := err == nil && circulation.Expired(patron, now)
+
+	// Charge, renewal, recall and hold privileges are denied to an unknown, blocked or expired patron
+	status := strings.Repeat(" ", 14)
+	if err != nil || patron.Blocked || expired {
+		status = "YYYY" + strings.Repeat(" ", 10)
+	}
+
+	r := NewResponse(PatronStatusResponse, status, m.Fixed[:3], Date(now)).
+		Add("AO", s.InstitutionID).
+		Add("AA", m.Field("AA")).
+		Add("AE", patron.Name).
+		Add("BL", YN(err == nil))
+	var pinErr error
+	if m.Has("AD") {
+		if err == nil && patron.PinHash != "" {
+			pinErr = s.checkPin(patron, m.Field("AD"))
+		}
+		r.Add("CQ", YN(err == nil && patron.PinHash != "" && pinErr == nil))
+	}
+	if err != nil {
+		r.Add("AF", screenMessage(err))
+	} else if errors.Is(pinErr, errPinLocked) {
+		r.Add("AF", screenMessage(pinErr))
+	} else if patron.Blocked {
+		r.Add("AF", screenMessage(circulation.ErrPatronBlocked))
+	} else if expired {
+		r.Add("AF", screenMessage(circulation.ErrPatronExpired))
+	}
+	return r
+}
+
+func (s *Server) itemInformation(m *Message) *Response {
+	book, err := s.findItem(m.Field("AB"))
+	if err != nil {
+		// circulation status 01 ==> other
+		return NewResponse(ItemInformationResponse, "01", "00", "01", Date(s.Now())).
+			Add("AB", m.Field("AB")).
+			Add("AJ", "").
+			Add("AF", screenMessage(err))
+	}
+
+	// circulation status 03 ==> available, 04 ==> charged
+	loan, err := circulation.ActiveLoan(s.DB, book.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return NewResponse(ItemInformationResponse, "01", "00", "01", Date(s.Now())).
+			Add("AB", m.Field("AB")).
+			Add("AJ", book.Title).
+			Add("AF", screenMessage(err))
+	}
+	if err != nil {
+		return NewResponse(ItemInformationResponse, "03", "00", "01", Date(s.Now())).
+			Add("AB", m.Field("AB")).
+			Add("AJ", book.Title)
+	}
+	return NewResponse(ItemInformationResponse, "04", "00", "01", Date(s.Now())).
+		Add("AB", m.Field("AB")).
+		Add("AJ", book.Title).
+		Add("AH", Date(loan.DueAt))
+}
+
+func (s *Server) checkout(m *Message) *Response {
+	now := s.Now()
+	renewed := false
+
+	book, err := s.findItem(m.Field("AB"))
+	patron, patronErr := s.authenticate(m)
+	if err == nil {
+		err = patronErr
+	}
+
+	var loan models.Loan
+	if err == nil {
+		loan, err = circulation.Checkout(s.DB, patron, book, now)
+
+		// With the SC renewal policy a checkout of an item the patron already has is a renewal
+		if errors.Is(err, circulation.ErrAlreadyCheckedOut) && m.Fixed[0] == 'Y' {
+			if active, activeErr := circulation.ActiveLoan(s.DB, book.ID); activeErr == nil && active.PatronID == patron.ID {
+				loan, err = circulation.Renew(s.DB, patron, book, now)
+				renewed = err == nil
+			}
+		}
+	}
+
+	// ok, renewal ok, magnetic media (unknown), desensitize
+	r := NewResponse(CheckoutResponse, Bit(err == nil), YN(renewed), "U", YN(err == nil), Date(now)).
+		Add("AO", s.InstitutionID).
+		Add("AA", m.Field("AA")).
+		Add("AB", m.Field("AB")).
+		Add("AJ", book.Title)
+	if err != nil {
+		return r.Add("AH", "").Add("AF", screenMessage(err))
+	}
+	return r.Add("AH", Date(loan.DueAt))
+}
+
+func (s *Server) checkin(m *Message) *Response {
+	now := s.Now()
+
+	book, err := s.findItem(m.Field("AB"))
+	var loan models.Loan
+	if err == nil {
+		loan, err = circulation.Checkin(s.DB, book, now)
+	}
+
+	// ok, resensitize, magnetic media (unknown), alert
+	r := NewResponse(CheckinResponse, Bit(err == nil), YN(err == nil), "U", "N", Date(now)).
+		Add("AO", s.InstitutionID).
+		Add("AB", m.Field("AB")).
+		Add("AQ", s.LibraryName).
+		Add("AJ", book.Title).
+		AddIf("AA", loan.Patron.Barcode)
+	if err != nil {
+		r.Add("AF", screenMessage(err))
+	}
+	return r
+}
+
+func (s *Server) renew(m *Message) *Response {
+	now := s.Now()
+
+	book, err := s.findItem(m.Field("AB"))
+	patron, patronErr := s.authenticate(m)
+	if err == nil {
+		err = patronErr
+	}
+
+	var loan models.Loan
+	if err == nil {
+		loan, err = circulation.Renew(s.DB, patron, book, now)
+	}
+
+	// ok, renewal ok, magnetic media (unknown), desensitize
+	r := NewResponse(RenewResponse, Bit(err == nil), YN(err == nil), "U", "N", Date(now)).
+		Add("AO", s.InstitutionID).
+		Add("AA", m.Field("AA")).
+		Add("AB", m.Field("AB")).
+		Add("AJ", book.Title)
+	if err != nil {
+		return r.Add("AH", "").Add("AF", screenMessage(err))
+	}
+	return r.Add("AH", Date(loan.DueAt))
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+func (s *Server) findPatron(barcode string) (models.Patron, error) {
+	var patron models.Patron
+	err := s.DB.Where("barcode = ?", barcode).First(&patron).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return patron, errPatronNotFound
+	}
+	return patron, err
+}
+
+// authenticate returns the patron of the AA field if the PIN (AD field) is theirs, a patron without a PIN can't use the kiosks.
+func (s *Server) authenticate(m *Message) (models.Patron, error) {
+	patron, err := s.findPatron(m.Field("AA"))
+	if err != nil {
+		return patron, err
+	}
+	if patron.PinHash == "" {
+		return patron, errNoPin
+	}
+	return patron, s.checkPin(patron, m.Field("AD"))
+}
+
+// checkPin checks the PIN of a patron having one. After maxPinFailures wrong PINs in a row the patron is locked out
+// for a delay growing with each next wrong PIN, so a PIN can't be guessed by trying them all at a kiosk.
+func (s *Server) checkPin(patron models.Patron, pin string) error {
+	now := s.Now()
+
+	s.mu.Lock()
+	failures := s.pinFailures[patron.ID]
+	locked := failures != nil && now.Before(failures.lockedUntil)
+	s.mu.Unlock()
+	if locked {
+		return errPinLocked
+	}
+
+	// The hash is compared without the lock, it is slow and the other kiosks don't wait for it
+	ok := circulation.CheckPin(patron, pin)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok {
+		delete(s.pinFailures, patron.ID)
+		return nil
+	}
+
+	if s.pinFailures == nil {
+		s.pinFailures = map[uint]*pinFailures{}
+	}
+	failures = s.pinFailures[patron.ID]
+	if failures == nil {
+		failures = &pinFailures{}
+		s.pinFailures[patron.ID] = failures
+	}
+	failures.count++
+	if failures.count >= maxPinFailures {
+		delay := pinBackoff
+		for i := maxPinFailures; i < failures.count && delay < maxPinBackoff; i++ {
+			delay *= 2
+		}
+		failures.lockedUntil = now.Add(min(delay, maxPinBackoff))
+	}
+	return errInvalidPin
+}
+
+func (s *Server) findItem(identifier string) (models.Book, error) {
+	var book models.Book
+	err := s.DB.Where("isbn = ?", identifier).First(&book).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return book, errItemNotFound
+	}
+	return book, err
+}
+
+// screenMessage returns the message shown on the kiosk for an error, the database errors aren't shown.
+func screenMessage(err error) string {
+	for _, known := range []error{errPatronNotFound, errNoPin, errInvalidPin, errPinLocked, errItemNotFound, circulation.ErrPatronBlocked, circulation.ErrPatronExpired,
+		circulation.ErrAlreadyCheckedOut, circulation.ErrNotCheckedOut, circulation.ErrNotBorrower, circulation.ErrRenewalLimit} {
+		if errors.Is(err, known) {
+			message := known.Error()
+			return strings.ToUpper(message[:1]) + message[1:]
+		}
+	}
+	return "System error, please ask the library staff"
+}
@@ -0,0 +1,183 @@
+package sip2
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	circulation "github.com/Pyramakerz/Library_Management_System/PKG/Circulation"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+// sign adds the error detection fields to a request
+func sign(request string, sequence int) string {
+	request += "AY" + strconv.Itoa(sequence) + "AZ"
+	return request + Checksum(request) + "\r"
+}
+
+func TestServerSession(t *testing.T) {
+	config.Connect()
+	db := config.GetDB()
+	db.AutoMigrate(&models.Author{}, &models.Book{}, &models.Patron{}, &models.Loan{})
+
+	// The rows are removed one by one, the controller tests may use the same database at the same time
+	author := models.Author{Name: "John Doe", Email: "sip2@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Sample Book", ISBN: "SIP2-1234567890", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+	pin, _ := circulation.HashPin("4321")
+	patron := models.Patron{Barcode: "K1001", Name: "Jane Doe", PinHash: pin}
+	db.Create(&patron)
+	withoutPin := models.Patron{Barcode: "K1002", Name: "John Roe"}
+	db.Create(&withoutPin)
+	defer func() {
+		db.Where("patron_id = ?", patron.ID).Delete(&models.Loan{})
+		db.Unscoped().Delete(&patron)
+		db.Unscoped().Delete(&withoutPin)
+		db.Unscoped().Delete(&book)
+		db.Unscoped().Delete(&author)
+	}()
+
+	server := NewServer(db)
+	server.LoginUser, server.LoginPassword = "kiosk", "secret"
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(conn)
+
+	reader := bufio.NewReader(client)
+	send := func(request string) string {
+		client.Write([]byte(request))
+		response, _ := reader.ReadString('\r')
+		return response
+	}
+	date := Date(time.Now())
+
+	assert.True(t, strings.HasPrefix(send(sign("9300CNkiosk|COsecret|CPMain|", 0)), "941AY0AZ"))
+	assert.Contains(t, send(sign("9900302.00", 1)), "BX"+supportedMessages)
+
+	status := send(sign("23000"+date+"AOlibrary|AAK1001|AD4321|", 2))
+	assert.Contains(t, status, "BLY|CQY|")
+
+	checkout := send(sign("11NN"+date+date+"AOlibrary|AAK1001|ABSIP2-1234567890|AC|AD4321|", 3))
+	assert.True(t, strings.HasPrefix(checkout, "121NUY"), checkout)
+
+	// The retried message isn't processed twice
+	assert.Equal(t, checkout, send(sign("11NN"+date+date+"AOlibrary|AAK1001|ABSIP2-1234567890|AC|AD4321|", 3)))
+
+	assert.True(t, strings.HasPrefix(send(sign("17"+date+"AOlibrary|ABSIP2-1234567890|", 4)), "18040001"))
+	assert.True(t, strings.HasPrefix(send(sign("29NN"+date+date+"AOlibrary|AAK1001|AD4321|ABSIP2-1234567890|", 5)), "301YUN"))
+	assert.True(t, strings.HasPrefix(send(sign("09N"+date+date+"APMain|AOlibrary|ABSIP2-1234567890|AC|", 6)), "101YUN"))
+	assert.True(t, strings.HasPrefix(send(sign("09N"+date+date+"APMain|AOlibrary|ABSIP2-1234567890|AC|", 7)), "100NUN"))
+
+	// Wrong PIN and wrong checksum
+	assert.True(t, strings.HasPrefix(send(sign("11NN"+date+date+"AOlibrary|AAK1001|ABSIP2-1234567890|AC|AD0000|", 8)), "120NUN"))
+	assert.Equal(t, "96\r", send("9900302.00AY1AZFCA4\r"))
+
+	// A patron without a PIN can't use the kiosks, whatever PIN is sent
+	checkout = send(sign("11NN"+date+date+"AOlibrary|AAK1002|ABSIP2-1234567890|AC|AD|", 1))
+	assert.True(t, strings.HasPrefix(checkout, "120"), checkout)
+	assert.Contains(t, checkout, "AFNo PIN is set, please ask the library staff|")
+
+	// An expired card can't borrow anymore
+	db.Model(&patron).Update("expires_at", time.Now().Add(-time.Hour))
+	status = send(sign("23000"+date+"AOlibrary|AAK1001|AD4321|", 9))
+	assert.True(t, strings.HasPrefix(status, "24YYYY"), status)
+	assert.Contains(t, status, "AFPatron card is expired|")
+	checkout = send(sign("11NN"+date+date+"AOlibrary|AAK1001|ABSIP2-1234567890|AC|AD4321|", 0))
+	assert.True(t, strings.HasPrefix(checkout, "120"), checkout)
+	assert.Contains(t, checkout, "AFPatron card is expired|")
+}
+
+func TestServerMessageTooLong(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	go NewServer(nil).ServeConn(conn)
+
+	// No carriage return in the first maxMessageLength bytes ==> the connection is closed
+	_, err := client.Write([]byte(strings.Repeat("9", maxMessageLength+1)))
+	assert.Error(t, err)
+
+	_, err = bufio.NewReader(client).ReadString('\r')
+	assert.Error(t, err)
+}
+
+func TestServerPinBackoff(t *testing.T) {
+	config.Connect()
+	db := config.GetDB()
+	db.AutoMigrate(&models.Author{}, &models.Book{}, &models.Patron{}, &models.Loan{})
+
+	author := models.Author{Name: "John Doe", Email: "sip2-pin@example.com"}
+	db.Create(&author)
+	book := models.Book{Title: "Sample Book", ISBN: "SIP2-1234567891", PublishedDate: time.Now(), AuthorID: author.ID}
+	db.Create(&book)
+	pin, _ := circulation.HashPin("4321")
+	patron := models.Patron{Barcode: "K1003", Name: "Jane Doe", PinHash: pin}
+	db.Create(&patron)
+	defer func() {
+		db.Where("patron_id = ?", patron.ID).Delete(&models.Loan{})
+		db.Unscoped().Delete(&patron)
+		db.Unscoped().Delete(&book)
+		db.Unscoped().Delete(&author)
+	}()
+
+	now := time.Now()
+	server := NewServer(db)
+	server.Now = func() time.Time { return now }
+	renew := func(pin string) string {
+		m, _ := Parse("29NN" + Date(now) + Date(now) + "AOlibrary|AAK1003|AD" + pin + "|ABSIP2-1234567891|")
+		return server.renew(m).Encode(-1)
+	}
+
+	for range maxPinFailures {
+		assert.Contains(t, renew("0000"), "AFInvalid PIN|")
+	}
+
+	// Locked out, even the right PIN is refused and the patron status doesn't tell it either
+	assert.Contains(t, renew("4321"), "AFToo many invalid PINs, please try again later|")
+	m, _ := Parse("23000" + Date(now) + "AOlibrary|AAK1003|AD4321|")
+	assert.Contains(t, server.patronStatus(m).Encode(-1), "CQN|")
+
+	// The right PIN after the delay resets the count
+	now = now.Add(pinBackoff)
+	assert.Contains(t, renew("4321"), "AFItem is not checked out|")
+	assert.Contains(t, renew("0000"), "AFInvalid PIN|")
+	assert.Contains(t, renew("4321"), "AFItem is not checked out|")
+
+	// The next wrong PIN after the delay doubles it
+	for range maxPinFailures {
+		renew("0000")
+	}
+	now = now.Add(pinBackoff)
+	assert.Contains(t, renew("0000"), "AFInvalid PIN|")
+	now = now.Add(pinBackoff)
+	assert.Contains(t, renew("4321"), "AFToo many invalid PINs")
+	now = now.Add(pinBackoff)
+	assert.NotContains(t, renew("4321"), "AFToo many invalid PINs")
+}
+
+func TestServerRequiresLogin(t *testing.T) {
+	everywhere, err := net.Listen("tcp", ":0")
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, NewServer(nil).Serve(everywhere), ErrLoginRequired)
+	}
+
+	// Localhost is served without a login
+	local, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan error)
+	go func() { done <- NewServer(nil).Serve(local) }()
+	conn, err := net.Dial("tcp", local.Addr().String())
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+	local.Close()
+	assert.NotErrorIs(t, <-done, ErrLoginRequired)
+}
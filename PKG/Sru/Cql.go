@@ -0,0 +1,201 @@
+package sru
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Node is a parsed CQL query: a *Clause or a *Boolean.
+type Node interface {
+	node()
+}
+
+// Clause is a search clause ==> dc.title any "lord rings"
+type Clause struct {
+	Index    string
+	Relation string
+	Term     string
+}
+
+// Boolean joins two sub queries ==> title=hobbit and author=tolkien
+type Boolean struct {
+	Operator string
+	Left     Node
+	Right    Node
+}
+
+func (*Clause) node()  {}
+func (*Boolean) node() {}
+
+// Relations and boolean operators are compared lowercased
+var (
+	relationWords    = map[string]bool{"any": true, "all": true, "exact": true, "adj": true, "within": true, "encloses": true}
+	relationSymbols  = map[string]bool{"=": true, "==": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true}
+	booleanOperators = map[string]bool{"and": true, "or": true, "not": true, "prox": true}
+)
+
+type token struct {
+	value  string
+	quoted bool
+}
+
+// ParseCQL parses a CQL query, a malformed query returns a query syntax error diagnostic.
+func ParseCQL(query string) (Node, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, NewDiagnostic(DiagnosticQuerySyntax, "empty query")
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		if strings.EqualFold(p.peek().value, "sortby") && !p.peek().quoted {
+			return nil, NewDiagnostic(DiagnosticSortUnsupported, "sortBy")
+		}
+		return nil, NewDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("unexpected %q", p.peek().value))
+	}
+	return node, nil
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '/':
+			tokens = append(tokens, token{value: string(r)})
+			i++
+		case r == '=' || r == '<' || r == '>':
+			// =, ==, <, >, <=, >=, <>
+			j := i + 1
+			if j < len(runes) && (runes[j] == '=' || (r == '<' && runes[j] == '>')) {
+				j++
+			}
+			tokens = append(tokens, token{value: string(runes[i:j])})
+			i = j
+		case r == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				// \" is a quote inside the term, other escapes (\*, \?) are kept for the wildcards
+				if runes[j] == '\\' && j+1 < len(runes) && runes[j+1] == '"' {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, NewDiagnostic(DiagnosticQuerySyntax, "unterminated quoted term")
+			}
+			tokens = append(tokens, token{value: b.String(), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()=<>"/`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{value: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) isBoolean() bool {
+	t := p.peek()
+	return !t.quoted && booleanOperators[strings.ToLower(t.value)]
+}
+
+// query ==> searchClause (boolean searchClause)*, the booleans are left associative and have the same precedence
+func (p *parser) query() (Node, error) {
+	left, err := p.searchClause()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.pos < len(p.tokens) && p.isBoolean() {
+		operator := strings.ToLower(p.next().value)
+		if p.peek().value == "/" && !p.peek().quoted {
+			return nil, NewDiagnostic(DiagnosticBooleanModifierUnsupported, operator)
+		}
+
+		right, err := p.searchClause()
+		if err != nil {
+			return nil, err
+		}
+		left = &Boolean{Operator: operator, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// searchClause ==> "(" query ")" | [index relation] term
+func (p *parser) searchClause() (Node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, NewDiagnostic(DiagnosticQuerySyntax, "missing search term")
+	}
+
+	if t := p.peek(); t.value == "(" && !t.quoted {
+		p.next()
+		node, err := p.query()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.value != ")" || t.quoted {
+			return nil, NewDiagnostic(DiagnosticQuerySyntax, "missing )")
+		}
+		return node, nil
+	}
+
+	first := p.next()
+	if !first.quoted && (first.value == ")" || first.value == "/" || relationSymbols[first.value]) {
+		return nil, NewDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("unexpected %q", first.value))
+	}
+
+	// A term alone searches the server choice index
+	relation := p.peek()
+	isRelation := !relation.quoted && (relationSymbols[relation.value] || relationWords[strings.ToLower(relation.value)])
+	if first.quoted || !isRelation || p.pos+1 >= len(p.tokens) {
+		return &Clause{Index: "cql.serverchoice", Relation: "=", Term: first.value}, nil
+	}
+
+	p.next()
+	if p.peek().value == "/" && !p.peek().quoted {
+		return nil, NewDiagnostic(DiagnosticRelationModifierUnsupported, relation.value)
+	}
+
+	term := p.next()
+	if !term.quoted && (term.value == "(" || term.value == ")" || relationSymbols[term.value]) {
+		return nil, NewDiagnostic(DiagnosticQuerySyntax, fmt.Sprintf("unexpected %q", term.value))
+	}
+
+	return &Clause{Index: strings.ToLower(first.value), Relation: strings.ToLower(relation.value), Term: term.value}, nil
+}
@@ -0,0 +1,83 @@
+package sru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testIndexes = map[string][]string{
+	"cql.serverchoice": {"books.title", "authors.name"},
+	"title":            {"books.title"},
+	"author":           {"authors.name"},
+	"isbn":             {"books.isbn"},
+}
+
+func TestParseCQL(t *testing.T) {
+	node, err := ParseCQL(`title any "lord rings" and (author=tolkien or isbn==0261103342) not hobbit`)
+	assert.NoError(t, err)
+
+	not, ok := node.(*Boolean)
+	assert.True(t, ok)
+	assert.Equal(t, "not", not.Operator)
+	assert.Equal(t, &Clause{Index: "cql.serverchoice", Relation: "=", Term: "hobbit"}, not.Right)
+
+	and := not.Left.(*Boolean)
+	assert.Equal(t, "and", and.Operator)
+	assert.Equal(t, &Clause{Index: "title", Relation: "any", Term: "lord rings"}, and.Left)
+
+	or := and.Right.(*Boolean)
+	assert.Equal(t, &Clause{Index: "author", Relation: "=", Term: "tolkien"}, or.Left)
+	assert.Equal(t, &Clause{Index: "isbn", Relation: "==", Term: "0261103342"}, or.Right)
+}
+
+func TestParseCQLErrors(t *testing.T) {
+	for query, code := range map[string]int{
+		"":                       DiagnosticQuerySyntax,
+		"(title=hobbit":          DiagnosticQuerySyntax,
+		`title="hobbit`:          DiagnosticQuerySyntax,
+		"title=hobbit and":       DiagnosticQuerySyntax,
+		"title=hobbit sortby id": DiagnosticSortUnsupported,
+		"title =/stem hobbit":    DiagnosticRelationModifierUnsupported,
+	} {
+		_, err := ParseCQL(query)
+		d, ok := err.(*Diagnostic)
+		if assert.True(t, ok, query) {
+			assert.Equal(t, code, d.Code, query)
+		}
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	node, _ := ParseCQL(`title all "lord rings" or author==tolk*`)
+	condition, args, err := ToSQL(node, testIndexes)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "((books.title LIKE ? AND books.title LIKE ?) OR authors.name LIKE ?)", condition)
+	assert.Equal(t, []any{"%lord%", "%rings%", "tolk%"}, args)
+
+	node, _ = ParseCQL(`"50%_off"`)
+	condition, args, err = ToSQL(node, testIndexes)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "(books.title LIKE ? OR authors.name LIKE ?)", condition)
+	assert.Equal(t, []any{`%50\%\_off%`, `%50\%\_off%`}, args)
+}
+
+func TestToSQLDiagnostics(t *testing.T) {
+	for query, code := range map[string]int{
+		"publisher=penguin":          DiagnosticIndexUnsupported,
+		"title within hobbit":        DiagnosticRelationUnsupported,
+		"title=a prox title=b":       DiagnosticBooleanUnsupported,
+		"title=hobbit and isbn>1000": DiagnosticRelationUnsupported,
+	} {
+		node, err := ParseCQL(query)
+		assert.NoError(t, err, query)
+
+		_, _, err = ToSQL(node, testIndexes)
+		d, ok := err.(*Diagnostic)
+		if assert.True(t, ok, query) {
+			assert.Equal(t, code, d.Code, query)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package sru
+
+import (
+	"strings"
+)
+
+// ToSQL translates a CQL query into a SQL condition, indexes maps each supported CQL index to the columns it searches
+// (a term matching any of the columns matches the index).
+func ToSQL(node Node, indexes map[string][]string) (string, []any, error) {
+	switch n := node.(type) {
+	case *Boolean:
+		left, leftArgs, err := ToSQL(n.Left, indexes)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := ToSQL(n.Right, indexes)
+		if err != nil {
+			return "", nil, err
+		}
+
+		args := append(leftArgs, rightArgs...)
+		switch n.Operator {
+		case "and":
+			return "(" + left + " AND " + right + ")", args, nil
+		case "or":
+			return "(" + left + " OR " + right + ")", args, nil
+		case "not":
+			return "(" + left + " AND NOT " + right + ")", args, nil
+		}
+		return "", nil, NewDiagnostic(DiagnosticBooleanUnsupported, n.Operator)
+
+	case *Clause:
+		if n.Index == "cql.allrecords" {
+			return "1 = 1", nil, nil
+		}
+
+		columns, ok := indexes[n.Index]
+		if !ok {
+			return "", nil, NewDiagnostic(DiagnosticIndexUnsupported, n.Index)
+		}
+
+		var conditions []string
+		var args []any
+		for _, column := range columns {
+			condition, conditionArgs, err := clauseSQL(column, n.Relation, n.Term)
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, condition)
+			args = append(args, conditionArgs...)
+		}
+		if len(conditions) == 1 {
+			return conditions[0], args, nil
+		}
+		return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+	}
+
+	return "", nil, NewDiagnostic(DiagnosticQuerySyntax, "empty query")
+}
+
+func clauseSQL(column, relation, term string) (string, []any, error) {
+	switch relation {
+	case "=", "adj":
+		// The term is searched as a phrase anywhere in the column
+		return column + " LIKE ?", []any{"%" + likePattern(term) + "%"}, nil
+	case "==", "exact":
+		if hasWildcard(term) {
+			return column + " LIKE ?", []any{likePattern(term)}, nil
+		}
+		return column + " = ?", []any{unescape(term)}, nil
+	case "<>":
+		return column + " <> ?", []any{unescape(term)}, nil
+	case "any", "all":
+		words := strings.Fields(term)
+		if len(words) == 0 {
+			return "", nil, NewDiagnostic(DiagnosticQuerySyntax, "empty term")
+		}
+
+		var conditions []string
+		var args []any
+		for _, word := range words {
+			conditions = append(conditions, column+" LIKE ?")
+			args = append(args, "%"+likePattern(word)+"%")
+		}
+		separator := " OR "
+		if relation == "all" {
+			separator = " AND "
+		}
+		return "(" + strings.Join(conditions, separator) + ")", args, nil
+	}
+
+	return "", nil, NewDiagnostic(DiagnosticRelationUnsupported, relation)
+}
+
+// likePattern escapes the LIKE special characters of a term and turns the CQL wildcards into LIKE ones (* ==> %, ? ==> _),
+// the wildcards escaped with a backslash are searched literally.
+func likePattern(term string) string {
+	var b strings.Builder
+	runes := []rune(term)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				if runes[i] == '%' || runes[i] == '_' || runes[i] == '\\' {
+					b.WriteRune('\\')
+				}
+				b.WriteRune(runes[i])
+			}
+		case '%', '_':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '*':
+			b.WriteRune('%')
+		case '?':
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func hasWildcard(term string) bool {
+	runes := []rune(term)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if runes[i] == '*' || runes[i] == '?' {
+			return true
+		}
+	}
+	return false
+}
+
+func unescape(term string) string {
+	var b strings.Builder
+	runes := []rune(term)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
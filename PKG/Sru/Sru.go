@@ -0,0 +1,318 @@
+package sru
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+)
+
+// SRU 1.2 (http://www.loc.gov/standards/sru/) and 2.0 (http://docs.oasis-open.org/search-ws/)
+const (
+	Version12 = "1.2"
+	Version20 = "2.0"
+
+	namespace12           = "http://www.loc.gov/zing/srw/"
+	namespace20           = "http://docs.oasis-open.org/ns/search-ws/sruResponse"
+	diagnosticNamespace12 = "http://www.loc.gov/zing/srw/diagnostic/"
+	diagnosticNamespace20 = "http://docs.oasis-open.org/ns/search-ws/diagnostic"
+	explainNamespace      = "http://explain.z3950.org/dtd/2.0/"
+
+	// ExplainSchema is the schema of the explain record
+	ExplainSchema = explainNamespace
+)
+
+// Record schemas that can be returned
+const (
+	SchemaDC      = "dc"
+	SchemaMARCXML = "marcxml"
+)
+
+var SchemaIdentifiers = map[string]string{
+	SchemaDC:      "info:srw/schema/1/dc-v1.1",
+	SchemaMARCXML: "info:srw/schema/1/marcxml-v1.1",
+}
+
+// Diagnostics (http://www.loc.gov/standards/sru/diagnostics/diagnosticsList.html)
+const (
+	DiagnosticSystemError                 = 1
+	DiagnosticUnsupportedOperation        = 4
+	DiagnosticUnsupportedVersion          = 5
+	DiagnosticUnsupportedParameterValue   = 6
+	DiagnosticMandatoryParameter          = 7
+	DiagnosticQuerySyntax                 = 10
+	DiagnosticIndexUnsupported            = 16
+	DiagnosticRelationUnsupported         = 19
+	DiagnosticRelationModifierUnsupported = 20
+	DiagnosticBooleanUnsupported          = 37
+	DiagnosticBooleanModifierUnsupported  = 46
+	DiagnosticFirstRecordOutOfRange       = 61
+	DiagnosticUnknownSchema               = 66
+	DiagnosticSortUnsupported             = 80
+)
+
+var diagnosticMessages = map[int]string{
+	DiagnosticSystemError:                 "General system error",
+	DiagnosticUnsupportedOperation:        "Unsupported operation",
+	DiagnosticUnsupportedVersion:          "Unsupported version",
+	DiagnosticUnsupportedParameterValue:   "Unsupported parameter value",
+	DiagnosticMandatoryParameter:          "Mandatory parameter not supplied",
+	DiagnosticQuerySyntax:                 "Query syntax error",
+	DiagnosticIndexUnsupported:            "Unsupported index",
+	DiagnosticRelationUnsupported:         "Unsupported relation",
+	DiagnosticRelationModifierUnsupported: "Unsupported relation modifier",
+	DiagnosticBooleanUnsupported:          "Unsupported boolean operator",
+	DiagnosticBooleanModifierUnsupported:  "Unsupported combination of boolean operator and modifier",
+	DiagnosticFirstRecordOutOfRange:       "First record position out of range",
+	DiagnosticUnknownSchema:               "Unknown schema for retrieval",
+	DiagnosticSortUnsupported:             "Sort not supported",
+}
+
+// Diagnostic is an SRU error, it is returned in the response instead of an HTTP error.
+type Diagnostic struct {
+	Code    int
+	Details string
+}
+
+func NewDiagnostic(code int, details string) *Diagnostic {
+	return &Diagnostic{Code: code, Details: details}
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Details == "" {
+		return diagnosticMessages[d.Code]
+	}
+	return fmt.Sprintf("%s: %s", diagnosticMessages[d.Code], d.Details)
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// SearchRetrieveResponse is the searchRetrieve response, the namespace of the elements depends on the version.
+type SearchRetrieveResponse struct {
+	XMLName            xml.Name     `xml:"searchRetrieveResponse"`
+	Xmlns              string       `xml:"xmlns,attr"`
+	Version            string       `xml:"version,omitempty"`
+	NumberOfRecords    int64        `xml:"numberOfRecords"`
+	Records            *Records     `xml:"records,omitempty"`
+	NextRecordPosition int          `xml:"nextRecordPosition,omitempty"`
+	Diagnostics        *Diagnostics `xml:"diagnostics,omitempty"`
+}
+
+// ExplainResponse describes the server and its indexes.
+type ExplainResponse struct {
+	XMLName     xml.Name     `xml:"explainResponse"`
+	Xmlns       string       `xml:"xmlns,attr"`
+	Version     string       `xml:"version,omitempty"`
+	Record      *Record      `xml:"record,omitempty"`
+	Diagnostics *Diagnostics `xml:"diagnostics,omitempty"`
+}
+
+type Records struct {
+	Records []Record `xml:"record"`
+}
+
+// Record wraps the record data, RecordPacking is sent by 1.2 and RecordXMLEscaping by 2.0.
+type Record struct {
+	RecordSchema      string     `xml:"recordSchema"`
+	RecordPacking     string     `xml:"recordPacking,omitempty"`
+	RecordXMLEscaping string     `xml:"recordXMLEscaping,omitempty"`
+	RecordData        RecordData `xml:"recordData"`
+	RecordPosition    int        `xml:"recordPosition,omitempty"`
+}
+
+type RecordData struct {
+	Content any
+}
+
+type Diagnostics struct {
+	Xmlns       string              `xml:"xmlns,attr"`
+	Diagnostics []diagnosticElement `xml:"diagnostic"`
+}
+
+type diagnosticElement struct {
+	URI     string `xml:"uri"`
+	Details string `xml:"details,omitempty"`
+	Message string `xml:"message"`
+}
+
+// NewSearchRetrieveResponse returns an empty searchRetrieve response of a version.
+func NewSearchRetrieveResponse(version string) *SearchRetrieveResponse {
+	response := &SearchRetrieveResponse{Xmlns: namespace12, Version: version}
+	if version == Version20 {
+		// 2.0 dropped the version element
+		response.Xmlns, response.Version = namespace20, ""
+	}
+	return response
+}
+
+// NewExplainResponse returns an empty explain response of a version.
+func NewExplainResponse(version string) *ExplainResponse {
+	response := &ExplainResponse{Xmlns: namespace12, Version: version}
+	if version == Version20 {
+		response.Xmlns, response.Version = namespace20, ""
+	}
+	return response
+}
+
+// NewRecord wraps the record data of a schema at a position of the result set.
+func NewRecord(version, schema string, position int, content any) Record {
+	record := Record{RecordSchema: SchemaIdentifiers[schema], RecordData: RecordData{Content: content}, RecordPosition: position}
+	if version == Version20 {
+		record.RecordXMLEscaping = "xml"
+	} else {
+		record.RecordPacking = "xml"
+	}
+	return record
+}
+
+// NewDiagnostics returns the diagnostics element of a version for an error, errors that aren't a *Diagnostic are system errors.
+func NewDiagnostics(version string, err error) *Diagnostics {
+	d, ok := err.(*Diagnostic)
+	if !ok {
+		d = NewDiagnostic(DiagnosticSystemError, "")
+	}
+
+	diagnostics := &Diagnostics{Xmlns: diagnosticNamespace12}
+	if version == Version20 {
+		diagnostics.Xmlns = diagnosticNamespace20
+	}
+	diagnostics.Diagnostics = []diagnosticElement{{
+		URI:     fmt.Sprintf("info:srw/diagnostic/1/%d", d.Code),
+		Details: d.Details,
+		Message: diagnosticMessages[d.Code],
+	}}
+	return diagnostics
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+// Index is a CQL index advertised by explain
+type Index struct {
+	Set   string
+	Name  string
+	Title string
+}
+
+type explain struct {
+	XMLName    xml.Name          `xml:"explain"`
+	Xmlns      string            `xml:"xmlns,attr"`
+	ServerInfo explainServerInfo `xml:"serverInfo"`
+	Database   explainDatabase   `xml:"databaseInfo"`
+	IndexInfo  explainIndexInfo  `xml:"indexInfo"`
+	SchemaInfo explainSchemaInfo `xml:"schemaInfo"`
+	ConfigInfo explainConfigInfo `xml:"configInfo"`
+}
+
+type explainServerInfo struct {
+	Protocol string `xml:"protocol,attr"`
+	Version  string `xml:"version,attr"`
+	Host     string `xml:"host"`
+	Port     string `xml:"port"`
+	Database string `xml:"database"`
+}
+
+type explainDatabase struct {
+	Title string `xml:"title"`
+}
+
+type explainIndexInfo struct {
+	Sets    []explainSet   `xml:"set"`
+	Indexes []explainIndex `xml:"index"`
+}
+
+type explainSet struct {
+	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr"`
+}
+
+type explainIndex struct {
+	Title string         `xml:"title"`
+	Map   explainNameMap `xml:"map"`
+}
+
+type explainNameMap struct {
+	Name explainName `xml:"name"`
+}
+
+type explainName struct {
+	Set  string `xml:"set,attr"`
+	Name string `xml:",chardata"`
+}
+
+type explainSchemaInfo struct {
+	Schemas []explainSchema `xml:"schema"`
+}
+
+type explainSchema struct {
+	Identifier string `xml:"identifier,attr"`
+	Name       string `xml:"name,attr"`
+}
+
+type explainConfigInfo struct {
+	Defaults []explainSetting `xml:"default"`
+}
+
+type explainSetting struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ContextSets identifies the prefixes of the advertised indexes
+var ContextSets = map[string]string{
+	"cql":  "info:srw/cql-context-set/1/cql-v1.2",
+	"dc":   "info:srw/cql-context-set/1/dc-v1.1",
+	"bath": "http://zing.z3950.org/cql/bath/2.0/",
+}
+
+// Explain returns the ZeeRex description of the server.
+func Explain(version, host, port, database, title string, indexes []Index, defaultRecords, maxRecords int) any {
+	x := explain{
+		Xmlns:      explainNamespace,
+		ServerInfo: explainServerInfo{Protocol: "SRU", Version: version, Host: host, Port: port, Database: database},
+		Database:   explainDatabase{Title: title},
+		ConfigInfo: explainConfigInfo{Defaults: []explainSetting{
+			{Type: "numberOfRecords", Value: fmt.Sprint(defaultRecords)},
+			{Type: "maximumRecords", Value: fmt.Sprint(maxRecords)},
+			{Type: "retrieveSchema", Value: SchemaDC},
+		}},
+	}
+
+	for _, name := range []string{"cql", "dc", "bath"} {
+		x.IndexInfo.Sets = append(x.IndexInfo.Sets, explainSet{Name: name, Identifier: ContextSets[name]})
+	}
+	for _, index := range indexes {
+		x.IndexInfo.Indexes = append(x.IndexInfo.Indexes, explainIndex{Title: index.Title, Map: explainNameMap{Name: explainName{Set: index.Set, Name: index.Name}}})
+	}
+	for _, schema := range []string{SchemaDC, SchemaMARCXML} {
+		x.SchemaInfo.Schemas = append(x.SchemaInfo.Schemas, explainSchema{Identifier: SchemaIdentifiers[schema], Name: schema})
+	}
+	return x
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------
+
+type dublinCore struct {
+	XMLName    xml.Name `xml:"srw_dc:dc"`
+	XmlnsSrwDC string   `xml:"xmlns:srw_dc,attr"`
+	XmlnsDC    string   `xml:"xmlns:dc,attr"`
+	Title      string   `xml:"dc:title"`
+	Creator    string   `xml:"dc:creator,omitempty"`
+	Subject    string   `xml:"dc:subject,omitempty"`
+	Date       string   `xml:"dc:date"`
+	Type       string   `xml:"dc:type"`
+	Identifier []string `xml:"dc:identifier"`
+}
+
+// DublinCore returns the SRU Dublin Core (srw_dc) description of a book, its Author must be preloaded.
+func DublinCore(book models.Book) any {
+	return dublinCore{
+		XmlnsSrwDC: "info:srw/schema/1/dc-schema",
+		XmlnsDC:    "http://purl.org/dc/elements/1.1/",
+		Title:      book.Title,
+		Creator:    book.Author.Name,
+		Subject:    book.Subject,
+		Date:       book.PublishedDate.Format("2006-01-02"),
+		Type:       "Text",
+		Identifier: []string{"urn:isbn:" + book.ISBN},
+	}
+}
@@ -0,0 +1,41 @@
+package sru
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchRetrieveResponse(t *testing.T) {
+	book := models.Book{Title: "The Hobbit", ISBN: "0261103342", PublishedDate: time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC), Author: models.Author{Name: "J. R. R. Tolkien"}}
+
+	response := NewSearchRetrieveResponse(Version12)
+	response.NumberOfRecords = 1
+	response.Records = &Records{Records: []Record{NewRecord(Version12, SchemaDC, 1, DublinCore(book))}}
+
+	out, err := xml.Marshal(response)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), `<searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/"><version>1.2</version>`))
+	assert.Contains(t, string(out), "<recordSchema>info:srw/schema/1/dc-v1.1</recordSchema><recordPacking>xml</recordPacking>")
+	assert.Contains(t, string(out), "<dc:creator>J. R. R. Tolkien</dc:creator>")
+
+	response = NewSearchRetrieveResponse(Version20)
+	response.Diagnostics = NewDiagnostics(Version20, NewDiagnostic(DiagnosticIndexUnsupported, "publisher"))
+
+	out, err = xml.Marshal(response)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "<version>")
+	assert.Contains(t, string(out), "<uri>info:srw/diagnostic/1/16</uri><details>publisher</details>")
+}
+
+func TestNewDiagnosticsSystemError(t *testing.T) {
+	diagnostics := NewDiagnostics(Version12, errors.New("connection refused"))
+
+	assert.Equal(t, "info:srw/diagnostic/1/1", diagnostics.Diagnostics[0].URI)
+	assert.Empty(t, diagnostics.Diagnostics[0].Details)
+}
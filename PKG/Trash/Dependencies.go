@@ -0,0 +1,76 @@
+package trash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+// Dependencies are the records removed with a book or an author by the OnDelete:CASCADE constraints.
+// The books count the ones in the trash, the loans count the returned ones (the active ones prevent the deletion).
+type Dependencies struct {
+	Books             int64  `json:"books"`
+	Loans             int64  `json:"loans"`
+	ActiveLoans       int64  `json:"activeLoans"`
+	ConfirmationToken string `json:"confirmationToken,omitempty"`
+}
+
+// Cascades tells if deleting the record removes other records
+func (d Dependencies) Cascades() bool {
+	return d.Books > 0 || d.Loans > 0
+}
+
+// AuthorDependencies returns the books and loans deleted with an author.
+func AuthorDependencies(db *gorm.DB, author models.Author) (Dependencies, error) {
+	var deps Dependencies
+	books := db.Unscoped().Model(&models.Book{}).Select("id").Where("author_id = ?", author.ID)
+
+	if err := db.Unscoped().Model(&models.Book{}).Where("author_id = ?", author.ID).Count(&deps.Books).Error; err != nil {
+		return deps, err
+	}
+	if err := countLoans(db, books, &deps); err != nil {
+		return deps, err
+	}
+	deps.ConfirmationToken = token("author", author.ID, author.UpdatedAt.UnixNano(), deps)
+	return deps, nil
+}
+
+// BookDependencies returns the loans deleted with a book.
+func BookDependencies(db *gorm.DB, book models.Book) (Dependencies, error) {
+	var deps Dependencies
+	if err := countLoans(db, []uint{book.ID}, &deps); err != nil {
+		return deps, err
+	}
+	deps.ConfirmationToken = token("book", book.ID, book.UpdatedAt.UnixNano(), deps)
+	return deps, nil
+}
+
+// countLoans counts the loans of books, a list of IDs or a subquery
+func countLoans(db *gorm.DB, books any, deps *Dependencies) error {
+	var loans []struct {
+		Returned bool
+		Count    int64
+	}
+	err := db.Model(&models.Loan{}).
+		Select("returned_at IS NOT NULL AS returned, COUNT(*) AS count").
+		Where("book_id IN (?)", books).
+		Group("returned_at IS NOT NULL").
+		Scan(&loans).Error
+	for _, l := range loans {
+		if l.Returned {
+			deps.Loans = l.Count
+		} else {
+			deps.ActiveLoans = l.Count
+		}
+	}
+	return err
+}
+
+// token changes with the record and its dependencies, a deletion confirmed with it deletes what the client was shown
+func token(entityType string, id uint, updatedAt int64, deps Dependencies) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d:%d:%d", entityType, id, updatedAt, deps.Books, deps.Loans)))
+	return hex.EncodeToString(sum[:16])
+}
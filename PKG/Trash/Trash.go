@@ -0,0 +1,124 @@
+package trash
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	audit "github.com/Pyramakerz/Library_Management_System/PKG/Audit"
+	config "github.com/Pyramakerz/Library_Management_System/PKG/Config"
+	history "github.com/Pyramakerz/Library_Management_System/PKG/History"
+	models "github.com/Pyramakerz/Library_Management_System/PKG/Models"
+	"gorm.io/gorm"
+)
+
+// Actor of the purges in the history and the audit log
+const Actor = "system"
+
+// What soft deleting an author does to their books, set with SOFT_DELETE_AUTHOR_BOOKS
+const (
+	CascadeBooks  = "cascade"  // the books are soft deleted with the author and restored with them
+	RestrictBooks = "restrict" // the author can't be soft deleted while they have books
+)
+
+// AuthorBooks returns CascadeBooks or RestrictBooks, CascadeBooks by default.
+func AuthorBooks() string {
+	if config.Getenv("SOFT_DELETE_AUTHOR_BOOKS", CascadeBooks) == RestrictBooks {
+		return RestrictBooks
+	}
+	return CascadeBooks
+}
+
+// Retention is how long the soft-deleted books and authors are kept, set in days with TRASH_RETENTION_DAYS (0 keeps them forever).
+func Retention() time.Duration {
+	days, err := strconv.Atoi(config.Getenv("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Purged is the IDs of the books and authors removed by a purge
+type Purged struct {
+	Books   []uint `json:"books"`
+	Authors []uint `json:"authors"`
+}
+
+// Purge hard deletes the books and authors soft-deleted before cutoff, each one with its history and audit log.
+// A book still checked out and an author who still has books (even in the trash) are kept for a later purge,
+// deleting them would cascade to the loan or to the books.
+func Purge(db *gorm.DB, cutoff time.Time) (Purged, error) {
+	var purged Purged
+
+	var books []models.Book
+	err := db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM loans WHERE loans.book_id = books.id AND loans.returned_at IS NULL)").
+		Find(&books).Error
+	if err != nil {
+		return purged, err
+	}
+	for _, book := range books {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Delete(&book).Error; err != nil {
+				return err
+			}
+			if _, err := history.Record(tx, history.Book(book, history.ActionPurge, Actor)); err != nil {
+				return err
+			}
+			_, err := audit.Record(tx, audit.Entry{Actor: Actor, Action: history.ActionPurge, EntityType: history.EntityBook, EntityID: book.ID, Before: book})
+			return err
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged.Books = append(purged.Books, book.ID)
+	}
+
+	var authors []models.Author
+	err = db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM books WHERE books.author_id = authors.id)").
+		Find(&authors).Error
+	if err != nil {
+		return purged, err
+	}
+	for _, author := range authors {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Delete(&author).Error; err != nil {
+				return err
+			}
+			if _, err := history.Record(tx, history.Author(author, history.ActionPurge, Actor)); err != nil {
+				return err
+			}
+			_, err := audit.Record(tx, audit.Entry{Actor: Actor, Action: history.ActionPurge, EntityType: history.EntityAuthor, EntityID: author.ID, Before: author})
+			return err
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged.Authors = append(purged.Authors, author.ID)
+	}
+
+	return purged, nil
+}
+
+// Schedule purges the trash now and then every interval in the background, nothing is purged when the retention is 0.
+func Schedule(db *gorm.DB, interval time.Duration) {
+	retention := Retention()
+	if retention == 0 {
+		return
+	}
+
+	go func() {
+		for {
+			purged, err := Purge(db, time.Now().Add(-retention))
+			if err != nil {
+				fmt.Printf("Failed to purge the trash: %v\n", err)
+			} else if len(purged.Books) > 0 || len(purged.Authors) > 0 {
+				fmt.Printf("Purged %d books and %d authors from the trash\n", len(purged.Books), len(purged.Authors))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}